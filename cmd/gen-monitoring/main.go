@@ -0,0 +1,53 @@
+// Command gen-monitoring writes the PrometheusRule and Grafana dashboard shipped with
+// k8s-node-killer. It fails without writing anything when they reference a metric that
+// pkg/metrics does not register.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/supporttools/k8s-node-killer/pkg/metrics"
+	"sigs.k8s.io/yaml"
+)
+
+const header = "# Code generated by cmd/gen-monitoring. DO NOT EDIT.\n"
+
+func main() {
+	out := flag.String("out", "deploy/monitoring", "directory to write the generated files to")
+	flag.Parse()
+
+	rule, err := metrics.Alerts()
+	if err != nil {
+		log.Fatal(err)
+	}
+	ruleYAML, err := yaml.Marshal(rule)
+	if err != nil {
+		log.Fatalf("encode PrometheusRule: %v", err)
+	}
+
+	dashboard, err := metrics.GrafanaDashboard()
+	if err != nil {
+		log.Fatal(err)
+	}
+	dashboardJSON, err := json.MarshalIndent(dashboard, "", "  ")
+	if err != nil {
+		log.Fatalf("encode dashboard: %v", err)
+	}
+
+	if err := os.MkdirAll(*out, 0o755); err != nil {
+		log.Fatal(err)
+	}
+	files := map[string][]byte{
+		"prometheusrule.yaml":    append([]byte(header), ruleYAML...),
+		"grafana-dashboard.json": append(dashboardJSON, '\n'),
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(*out, name), content, 0o644); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
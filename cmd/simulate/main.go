@@ -0,0 +1,97 @@
+// Command simulate replays a scenario against the remediation policy and prints the
+// decisions and actions it leads to. With -expect, it compares them with a previous run and
+// fails on any difference, so policy changes can be regression-tested in CI.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/supporttools/k8s-node-killer/pkg/logging"
+	"github.com/supporttools/k8s-node-killer/pkg/simulate"
+)
+
+func main() {
+	output := flag.String("o", "text", "output format, text or json")
+	expect := flag.String("expect", "", "file holding the expected output; exit 1 when the output differs")
+	logLevel := flag.String("log-level", "warn", "level of the controller's logs, written to stderr")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] scenario.yaml\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := logging.Configure(*logLevel, "text"); err != nil {
+		log.Fatal(err)
+	}
+
+	data, err := os.ReadFile(flag.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	scenario, err := simulate.LoadScenario(data)
+	if err != nil {
+		log.Fatalf("%s: %v", flag.Arg(0), err)
+	}
+	simulator, err := simulate.New(scenario)
+	if err != nil {
+		log.Fatalf("%s: %v", flag.Arg(0), err)
+	}
+	entries := simulator.Run()
+
+	var out bytes.Buffer
+	switch *output {
+	case "text":
+		for _, entry := range entries {
+			fmt.Fprintln(&out, entry)
+		}
+	case "json":
+		encoder := json.NewEncoder(&out)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(entries); err != nil {
+			log.Fatalf("encode output: %v", err)
+		}
+	default:
+		log.Fatalf("invalid output format %q; must be text or json", *output)
+	}
+
+	if *expect == "" {
+		os.Stdout.Write(out.Bytes())
+		return
+	}
+	expected, err := os.ReadFile(*expect)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if line, want, got, differs := firstDifference(string(expected), out.String()); differs {
+		fmt.Fprintf(os.Stderr, "%s: output differs from %s at line %d\n  want: %s\n  got:  %s\n", flag.Arg(0), *expect, line, want, got)
+		os.Exit(1)
+	}
+}
+
+// firstDifference returns the first line at which two outputs differ.
+func firstDifference(expected, actual string) (int, string, string, bool) {
+	want, got := strings.Split(expected, "\n"), strings.Split(actual, "\n")
+	for i := 0; i < len(want) || i < len(got); i++ {
+		var w, g string
+		if i < len(want) {
+			w = want[i]
+		}
+		if i < len(got) {
+			g = got[i]
+		}
+		if w != g {
+			return i + 1, w, g, true
+		}
+	}
+	return 0, "", "", false
+}
@@ -2,159 +2,248 @@ package main
 
 import (
 	"context"
+	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
-	"sync"
 	"syscall"
 	"time"
 
-	v1 "k8s.io/api/core/v1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/rest"
 
 	"github.com/supporttools/k8s-node-killer/pkg/config"
+	"github.com/supporttools/k8s-node-killer/pkg/controller"
 	"github.com/supporttools/k8s-node-killer/pkg/health"
 	"github.com/supporttools/k8s-node-killer/pkg/k8sutils"
 	"github.com/supporttools/k8s-node-killer/pkg/logging"
 	"github.com/supporttools/k8s-node-killer/pkg/metrics"
+	"github.com/supporttools/k8s-node-killer/pkg/policy"
 	"github.com/supporttools/k8s-node-killer/pkg/recovery"
+	"github.com/supporttools/k8s-node-killer/pkg/tracing"
 )
 
-var (
-	logger       = logging.SetupLogging()
-	nodeLocks    = make(map[string]*sync.Mutex)
-	mutexMapLock = sync.Mutex{} // Protects access to the nodeLocks map
+var logger = logging.SetupLogging()
+
+// Exit codes.
+const (
+	exitOK      = 0
+	exitAborted = 2 // Remediations still running at the shutdown deadline were cut off
+	exitForced  = 3 // A second signal skipped the graceful shutdown
 )
 
-func getNodeMutex(nodeName string) *sync.Mutex {
-	mutexMapLock.Lock()
-	defer mutexMapLock.Unlock()
+// setupSignalHandler closes requested on the first SIGINT or SIGTERM. A second signal
+// exits immediately.
+func setupSignalHandler(requested chan<- struct{}) {
+	sigChan := make(chan os.Signal, 2)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	<-sigChan // Block until a signal is received.
+	logger.Println("Shutting down gracefully, signal again to force...")
+	close(requested)
+	<-sigChan
+	logger.Errorf("Forced shutdown.")
+	os.Exit(exitForced)
+}
+
+// shutdown stops the controller. New remediations are refused and running steps get
+// shutdownTimeout to reach a safe point, after which they are cut off. Then every
+// controller, the HTTP server and the trace exporter are stopped. It returns the exit code.
+func shutdown(cancel context.CancelFunc, server *http.Server, shutdownTracing func(context.Context) error) int {
+	cfg := config.Get()
+	code := exitOK
+	health.SetShuttingDown()
+
+	drainCtx, drainCancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	running := recovery.Drain(drainCtx)
+	drainCancel()
+	if running > 0 {
+		logger.Errorf("%d remediations did not reach a safe point within %s, aborting them.", running, cfg.ShutdownTimeout)
+		code = exitAborted
+	}
 
-	if lock, exists := nodeLocks[nodeName]; exists {
-		return lock
-	} else {
-		nodeLocks[nodeName] = &sync.Mutex{}
-		return nodeLocks[nodeName]
+	cancel()
+	if running > 0 {
+		// Give the aborted steps a moment to record that they were interrupted.
+		abortCtx, abortCancel := context.WithTimeout(context.Background(), 5*time.Second)
+		recovery.Drain(abortCtx)
+		abortCancel()
 	}
+
+	stopCtx, stopCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer stopCancel()
+	if err := server.Shutdown(stopCtx); err != nil {
+		logger.Errorf("Error stopping the metrics server: %v", err)
+	}
+	if err := shutdownTracing(stopCtx); err != nil {
+		logger.Errorf("Error flushing traces: %v", err)
+	}
+	logger.Println("Shutdown complete.")
+	return code
 }
 
-func scanNodes(ctx context.Context, clientset *kubernetes.Clientset) {
-	nodes, err := clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+// homeClientset returns a clientset for the cluster the controller runs in, which holds
+// its ConfigMap and credentials Secret.
+func homeClientset() (*kubernetes.Clientset, error) {
+	kubeConfig, err := rest.InClusterConfig()
 	if err != nil {
-		logger.Errorf("Failed to list nodes: %v", err)
+		return nil, fmt.Errorf("not running in a cluster: %w", err)
+	}
+	return kubernetes.NewForConfig(kubeConfig)
+}
+
+// watchConfigMap reloads the configuration when the watched ConfigMap changes.
+func watchConfigMap(ctx context.Context) {
+	ref := config.Get().ConfigMap
+	clientset, err := homeClientset()
+	if err != nil {
+		logger.Errorf("Configuration reload disabled: %v", err)
 		return
 	}
-	for _, node := range nodes.Items {
-		logger.Infof("Scanning node %s...", node.Name)
-		nodeMutex := getNodeMutex(node.Name)
-		nodeMutex.Lock()
-		recovery.AttemptRecovery(ctx, clientset, &node)
-		nodeMutex.Unlock()
+
+	logger.Printf("Watching ConfigMap %s for configuration changes...", ref)
+	config.WatchConfigMap(ctx, clientset, func(err error) {
+		if err != nil {
+			metrics.ConfigReloads.WithLabelValues("rejected").Inc()
+			logger.Errorf("Rejected configuration reload from ConfigMap %s: %v", ref, err)
+			return
+		}
+		metrics.ConfigReloads.WithLabelValues("applied").Inc()
+		cfg := config.Get()
+		if err := logging.Configure(cfg.LogLevel, cfg.LogFormat); err != nil {
+			logger.Errorf("Failed to apply logging configuration: %v", err)
+		}
+		logger.Printf("Configuration reloaded from ConfigMap %s.", ref)
+	})
+}
+
+// loadSecrets loads the credentials from their files and the credentials Secret, and keeps
+// watching both for rotation.
+func loadSecrets(ctx context.Context) error {
+	cfg := config.Get()
+	if _, err := config.LoadSecretFiles(); err != nil {
+		return err
+	}
+	go config.WatchSecretFiles(ctx, 30*time.Second, func(err error) {
+		if err != nil {
+			logger.Errorf("Failed to reload credential files: %v", err)
+			return
+		}
+		logger.Println("Credentials reloaded from files.")
+	})
+
+	if cfg.CredentialsSecret == "" {
+		return nil
+	}
+	clientset, err := homeClientset()
+	if err != nil {
+		return fmt.Errorf("load credentials secret: %w", err)
 	}
+	return config.WatchCredentialsSecret(ctx, clientset, func(err error) {
+		if err != nil {
+			logger.Errorf("Credentials secret %s: %v", cfg.CredentialsSecret, err)
+			return
+		}
+		logger.Printf("Credentials loaded from secret %s.", cfg.CredentialsSecret)
+	})
 }
 
-func setupSignalHandler(cancelFunc context.CancelFunc) {
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-	<-sigChan // Block until a signal is received.
-	logger.Println("Shutting down gracefully...")
-	cancelFunc()
+// runControllers remediates the nodes of the cluster, or of the downstream clusters in
+// multi-cluster mode, until ctx is cancelled and the controllers stopped.
+func runControllers(ctx context.Context) {
+	cfg := config.FromContext(ctx)
+	if cfg.MultiCluster {
+		manager, err := controller.NewManager()
+		if err != nil {
+			logger.Fatalf("Error creating multi-cluster manager: %v", err)
+		}
+		manager.Run(ctx)
+	} else {
+		kubeConfig, err := k8sutils.GetConfig(ctx)
+		if err != nil {
+			logger.Fatalf("Error getting Kubernetes config: %v", err)
+		}
+
+		clientset, err := kubernetes.NewForConfig(kubeConfig)
+		if err != nil {
+			logger.Fatalf("Error creating clientset: %v", err)
+		}
+
+		controller.New(cfg.ClusterName, clientset).Run(ctx)
+	}
 }
 
 func main() {
 	logger.Println("Starting k8s-node-killer...")
 
-	config.LoadConfiguration()
-	if err := config.ValidateConfiguration(&config.CFG); err != nil {
+	if err := config.LoadConfiguration(); err != nil {
+		logger.Fatalf("Configuration error: %v", err)
+	}
+	cfg := config.Get()
+	if err := logging.Configure(cfg.LogLevel, cfg.LogFormat); err != nil {
 		logger.Fatalf("Configuration validation error: %v", err)
 	}
-	if config.CFG.Debug {
-		logger.Println("Debug mode enabled")
-		logger.Println("Configuration:")
-		logger.Printf(" - Metrics Port: %d", config.CFG.MetricsPort)
-		logger.Printf(" - Harvester API: %s", config.CFG.HarvesterAPI)
-		logger.Printf(" - Rancher API: %s", config.CFG.RancherAPI)
+	logger.Debugf("Configuration: %v", cfg) // Credentials are redacted
+
+	shutdownTracing, err := tracing.Setup(context.Background())
+	if err != nil {
+		logger.Fatalf("Error setting up tracing: %v", err)
 	}
 
 	logger.Printf("Version: %s", health.Version)
 	logger.Printf("Git Commit: %s", health.GitCommit)
 	logger.Printf("Build Time: %s", health.BuildTime)
 
-	go func() {
-		logger.Println("Starting metrics server...")
-		metrics.StartMetricsServer()
-	}()
-
-	kubeConfig, err := k8sutils.GetConfig(context.Background())
-	if err != nil {
-		logger.Fatalf("Error getting Kubernetes config: %v", err)
+	var home kubernetes.Interface
+	if clientset, err := homeClientset(); err != nil {
+		logger.Warnf("Controller-wide admin actions will not be recorded as Events: %v", err)
+	} else {
+		home = clientset
 	}
+	adminAPI := controller.NewAdminAPI(home)
 
-	clientset, err := kubernetes.NewForConfig(kubeConfig)
-	if err != nil {
-		logger.Fatalf("Error creating clientset: %v", err)
-	}
+	logger.Println("Starting metrics server...")
+	server := metrics.StartMetricsServer(policy.RegisterAPI, adminAPI.Register)
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
 	// Set up a signal handler for graceful shutdown
-	go setupSignalHandler(cancel)
-
-	nodeInformer := cache.NewSharedIndexInformer(
-		&cache.ListWatch{
-			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
-				return clientset.CoreV1().Nodes().List(ctx, options)
-			},
-			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
-				return clientset.CoreV1().Nodes().Watch(ctx, options)
-			},
-		},
-		&v1.Node{},
-		0, // Resync period
-		cache.Indexers{},
-	)
-
-	nodeInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
-		AddFunc: func(obj interface{}) {},
-		UpdateFunc: func(oldObj, newObj interface{}) {
-			node := newObj.(*v1.Node)
-			nodeMutex := getNodeMutex(node.Name)
-			nodeMutex.Lock()
-			recovery.AttemptRecovery(ctx, clientset, node)
-			nodeMutex.Unlock()
-		},
-		DeleteFunc: func(obj interface{}) {
-			if node, ok := obj.(*v1.Node); ok {
-				nodeMutex := getNodeMutex(node.Name)
-				nodeMutex.Lock()
-				defer nodeMutex.Unlock()
-				delete(nodeLocks, node.Name)
-			}
-		},
-	})
+	shutdownRequested := make(chan struct{})
+	go setupSignalHandler(shutdownRequested)
 
-	go nodeInformer.Run(ctx.Done())
-
-	// Initial scan of all nodes
-	scanNodes(ctx, clientset)
-
-	// Start periodic checks
-	ticker := time.NewTicker(config.CFG.RescanInterval * time.Minute)
-	go func() {
-		for {
-			select {
-			case <-ticker.C:
-				scanNodes(ctx, clientset)
-			case <-ctx.Done():
-				ticker.Stop()
-				return
-			}
+	if err := loadSecrets(ctx); err != nil {
+		logger.Fatalf("Error loading credentials: %v", err)
+	}
+
+	// The kill switch state must be known before any remediation starts.
+	if cfg.KillSwitchConfigMap != "" || cfg.KillSwitchDeployment != "" {
+		if home == nil {
+			logger.Fatalf("The kill switch requires running in a cluster.")
+		}
+		if err := controller.WatchKillSwitch(ctx, home); err != nil {
+			logger.Fatalf("Error loading the kill switch: %v", err)
+		}
+	}
+
+	if cfg.LeaderElection {
+		if home == nil {
+			logger.Fatalf("Leader election requires running in a cluster.")
 		}
-	}()
+		go func() {
+			if err := controller.RunLeaderElection(ctx, home, runControllers); err != nil {
+				logger.Fatalf("Error running leader election: %v", err)
+			}
+		}()
+	} else {
+		// Without leader election every instance remediates, so every instance leads.
+		health.SetLeader(true)
+		go runControllers(ctx)
+	}
+
+	if cfg.ConfigMap != "" {
+		go watchConfigMap(ctx)
+	}
 
-	select {}
+	<-shutdownRequested
+	os.Exit(shutdown(cancel, server, shutdownTracing))
 }
@@ -1,82 +1,359 @@
 package config
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
 	"os"
+	"regexp"
 	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 )
 
-// AppConfig structure for environment-based configurations.
+// AppConfig structure for file and environment-based configurations.
 type AppConfig struct {
-	Debug                   bool          `json:"debug"`
+	Debug                   bool          `json:"debug"` // Shorthand for logLevel debug
+	LogLevel                string        `json:"logLevel"`
+	LogFormat               string        `json:"logFormat"`
 	MetricsPort             int           `json:"metricsPort"`
+	MetricsNodeLabel        string        `json:"metricsNodeLabel"` // "node" or "pool"
+	TracingEnabled          bool          `json:"tracingEnabled"`
+	OTLPEndpoint            string        `json:"otlpEndpoint"`
+	ConfigFile              string        `json:"configFile"`
+	ConfigMap               string        `json:"configMap"`
+	ConfigMapKey            string        `json:"configMapKey"`
+	KillSwitchConfigMap     string        `json:"killSwitchConfigMap"`
+	KillSwitchKey           string        `json:"killSwitchKey"`
+	KillSwitchDeployment    string        `json:"killSwitchDeployment"`
+	PodName                 string        `json:"podName"`
+	PodNamespace            string        `json:"podNamespace"`
+	LeaderElection          bool          `json:"leaderElection"`      // Only the holder of the lease remediates
+	LeaderElectionLease     string        `json:"leaderElectionLease"` // Lease in podNamespace
+	AdminToken              string        `json:"adminToken"`
+	AdminTokenFile          string        `json:"adminTokenFile"`
+	AuthMode                string        `json:"authMode"`
+	Kubeconfig              string        `json:"kubeconfig"`
+	KubeContext             string        `json:"kubeContext"`
+	Policy                  PolicyConfig  `json:"policy"`
 	InsecureSkipVerify      bool          `json:"insecureSkipVerify"`
 	HarvesterAPI            string        `json:"harvesterAPI"`
 	HarvesterKey            string        `json:"harvesterKey"`
+	HarvesterKeyFile        string        `json:"harvesterKeyFile"`
 	HarvesterNamespace      string        `json:"harvesterNamespace"`
+	HardRebootProvider      string        `json:"hardRebootProvider"`
+	RedfishUsername         string        `json:"redfishUsername"`
+	RedfishPassword         string        `json:"redfishPassword"`
+	RedfishPasswordFile     string        `json:"redfishPasswordFile"`
+	RedfishResetType        string        `json:"redfishResetType"`
+	RedfishSecretNamespace  string        `json:"redfishSecretNamespace"`
 	RancherAPI              string        `json:"rancherAPI"`
 	RancherKey              string        `json:"rancherKey"`
+	RancherKeyFile          string        `json:"rancherKeyFile"`
+	RancherToken            string        `json:"rancherToken"`
+	RancherTokenFile        string        `json:"rancherTokenFile"`
+	CredentialsSecret       string        `json:"credentialsSecret"`
+	RancherCAFile           string        `json:"rancherCAFile"`
 	RancherCluster          string        `json:"rancherCluster"`
+	ClusterName             string        `json:"clusterName"`
+	MultiCluster            bool          `json:"multiCluster"`
+	ClusterSelector         string        `json:"clusterSelector"`
+	ClusterNamePattern      string        `json:"clusterNamePattern"`
+	ClusterDiscovery        time.Duration `json:"clusterDiscovery"`
+	KubeconfigTTL           time.Duration `json:"kubeconfigTTL"`
+	MachineProvider         string        `json:"machineProvider"`
+	CAPIKubeconfig          string        `json:"capiKubeconfig"`
+	CAPINamespace           string        `json:"capiNamespace"`
+	CAPIRemediationMode     string        `json:"capiRemediationMode"`
+	ReplacementTimeout      time.Duration `json:"replacementTimeout"`
+	MachinePoolLabel        string        `json:"machinePoolLabel"`
+	KubeletRestartCommand   string        `json:"kubeletRestartCommand"` // Run over SSH by the restart_kubelet step
 	RecoveryWaitTimeMinutes int           `json:"recoveryWaitTimeMinutes"`
 	DrainTimeoutMinutes     int           `json:"drainTimeoutMinutes"`
 	RecoveryDelayMinutes    int           `json:"recoveryDelayMinutes"`
 	NewNodeThreshold        time.Duration `json:"newNodeThreshold"`
 	RescanInterval          time.Duration `json:"rescanInterval"`
+	InformerResync          time.Duration `json:"informerResync"`  // 0 disables the resync
+	Workers                 int           `json:"workers"`         // Nodes remediated concurrently per cluster
+	ShutdownTimeout         time.Duration `json:"shutdownTimeout"` // Time in-flight steps get to reach a safe point on shutdown
 }
 
-var CFG AppConfig
+// active holds the active configuration. Reloads replace it as a whole and never modify a
+// stored configuration, so a snapshot taken with Get stays consistent while it is used.
+var active atomic.Pointer[AppConfig]
 
-// LoadConfiguration loads configuration from environment variables.
-func LoadConfiguration() {
-	CFG.Debug = parseEnvBool("DEBUG", false)            // Assuming false as the default value
-	CFG.MetricsPort = parseEnvInt("METRICS_PORT", 9090) // Assuming 9090 as the default port
-	CFG.InsecureSkipVerify = parseEnvBool("INSECURE_SKIP_VERIFY", false)
-	CFG.HarvesterAPI = getEnvOrDefault("HARVESTER_API", "https://harvester.example.com")
-	CFG.HarvesterKey = getEnvOrDefault("HARVESTER_KEY", "")
-	CFG.HarvesterNamespace = getEnvOrDefault("HARVESTER_NAMESPACE", "default")
-	CFG.RancherAPI = getEnvOrDefault("RANCHER_API", "https://rancher.example.com")
-	CFG.RancherKey = getEnvOrDefault("RANCHER_KEY", "")
-	CFG.RancherCluster = getEnvOrDefault("RANCHER_CLUSTER", "local")
-	CFG.RecoveryWaitTimeMinutes = parseEnvInt("RECOVERY_WAIT_TIME_MINUTES", 5)
-	CFG.DrainTimeoutMinutes = parseEnvInt("DRAIN_TIMEOUT_MINUTES", 60)
-	CFG.RecoveryDelayMinutes = parseEnvInt("RECOVERY_DELAY_MINUTES", 10)
-	CFG.NewNodeThreshold = time.Duration(parseEnvInt("NEW_NODE_THRESHOLD", 60)) * time.Minute
-	CFG.RescanInterval = time.Duration(parseEnvInt("RESCAN_INTERVAL", 5)) * time.Minute
+func init() {
+	cfg := defaultConfig()
+	active.Store(&cfg)
 }
 
-func getEnvOrDefault(key, defaultValue string) string {
+// Get returns a snapshot of the active configuration. It must not be modified.
+func Get() *AppConfig {
+	return active.Load()
+}
+
+type snapshotKey struct{}
+
+// WithSnapshot returns a context carrying a configuration snapshot, so everything done on
+// behalf of a single scan or recovery attempt uses the same configuration.
+func WithSnapshot(ctx context.Context, cfg *AppConfig) context.Context {
+	return context.WithValue(ctx, snapshotKey{}, cfg)
+}
+
+// FromContext returns the configuration snapshot carried by the context, or the active
+// configuration when it carries none.
+func FromContext(ctx context.Context) *AppConfig {
+	if cfg, ok := ctx.Value(snapshotKey{}).(*AppConfig); ok {
+		return cfg
+	}
+	return Get()
+}
+
+// defaultConfig returns the configuration used when neither the config file nor the
+// environment set a value.
+func defaultConfig() AppConfig {
+	return AppConfig{
+		LogLevel:                "info",
+		LogFormat:               "text",
+		MetricsPort:             9090,
+		MetricsNodeLabel:        "node",
+		OTLPEndpoint:            "http://localhost:4318",
+		ConfigMapKey:            "config.yaml",
+		KillSwitchKey:           "paused",
+		LeaderElectionLease:     "k8s-node-killer",
+		AuthMode:                "rancher",
+		HarvesterAPI:            "https://harvester.example.com",
+		HarvesterNamespace:      "default",
+		HardRebootProvider:      "harvester",
+		RedfishResetType:        "ForceRestart",
+		RedfishSecretNamespace:  "default",
+		RancherAPI:              "https://rancher.example.com",
+		RancherCluster:          "local",
+		ClusterDiscovery:        5 * time.Minute,
+		MachineProvider:         "rancher",
+		CAPINamespace:           "fleet-default",
+		CAPIRemediationMode:     "delete",
+		KubeletRestartCommand:   "systemctl restart kubelet",
+		ReplacementTimeout:      30 * time.Minute,
+		RecoveryWaitTimeMinutes: 5,
+		DrainTimeoutMinutes:     60,
+		RecoveryDelayMinutes:    10,
+		NewNodeThreshold:        60 * time.Minute,
+		RescanInterval:          5 * time.Minute,
+		Workers:                 4,
+		ShutdownTimeout:         25 * time.Second,
+		Policy: PolicyConfig{
+			Partition: PartitionConfig{
+				MaxNotReadyRatio: 0.5,
+				MinNodes:         3,
+				Window:           5 * time.Minute,
+				ProbeTimeout:     3 * time.Second,
+			},
+			Probe: ProbeConfig{
+				SSHPort: 22,
+				Timeout: 3 * time.Second,
+			},
+		},
+	}
+}
+
+// LoadConfiguration loads the configuration from CONFIG_FILE, if set, with environment
+// variables taking precedence, validates it and makes it the active configuration.
+func LoadConfiguration() error {
+	var fileData []byte
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("read config file: %w", err)
+		}
+		fileData = data
+	}
+
+	cfg, err := Load(fileData)
+	if err != nil {
+		return err
+	}
+	if err := ValidateConfiguration(&cfg); err != nil {
+		return fmt.Errorf("validation: %w", err)
+	}
+	active.Store(&cfg)
+	return nil
+}
+
+// Load builds a configuration from the defaults, the given YAML or JSON config file
+// contents and the environment. Unknown keys and unparsable values are errors.
+func Load(fileData []byte) (AppConfig, error) {
+	cfg := defaultConfig()
+	if len(fileData) > 0 {
+		if err := parseFile(fileData, &cfg); err != nil {
+			return cfg, fmt.Errorf("config file: %w", err)
+		}
+	}
+	if err := applyEnv(&cfg); err != nil {
+		return cfg, err
+	}
+
+	// Defaults derived from other settings.
+	if cfg.ClusterName == "" {
+		cfg.ClusterName = cfg.RancherCluster
+	}
+	if cfg.Debug && cfg.LogLevel == "info" {
+		cfg.LogLevel = "debug"
+	}
+	if cfg.Policy.Ladder == nil {
+		cfg.Policy.Ladder = defaultRecoveryLadder(cfg.MachineProvider, cfg.Policy.Probe.Enabled)
+	}
+	return cfg, nil
+}
+
+// applyEnv overrides the configuration with the environment variables that are set.
+func applyEnv(cfg *AppConfig) error {
+	env := &envLoader{}
+	env.bool("DEBUG", &cfg.Debug)
+	env.string("LOG_LEVEL", &cfg.LogLevel)
+	env.string("LOG_FORMAT", &cfg.LogFormat)
+	env.int("METRICS_PORT", &cfg.MetricsPort)
+	env.string("METRICS_NODE_LABEL", &cfg.MetricsNodeLabel)
+	env.bool("TRACING_ENABLED", &cfg.TracingEnabled)
+	env.string("OTEL_EXPORTER_OTLP_ENDPOINT", &cfg.OTLPEndpoint)
+	env.string("CONFIG_FILE", &cfg.ConfigFile)
+	env.string("CONFIG_CONFIGMAP", &cfg.ConfigMap)
+	env.string("CONFIG_CONFIGMAP_KEY", &cfg.ConfigMapKey)
+	env.string("KILL_SWITCH_CONFIGMAP", &cfg.KillSwitchConfigMap)
+	env.string("KILL_SWITCH_KEY", &cfg.KillSwitchKey)
+	env.string("KILL_SWITCH_DEPLOYMENT", &cfg.KillSwitchDeployment)
+	env.string("POD_NAME", &cfg.PodName)
+	env.string("POD_NAMESPACE", &cfg.PodNamespace)
+	env.bool("LEADER_ELECTION", &cfg.LeaderElection)
+	env.string("LEADER_ELECTION_LEASE", &cfg.LeaderElectionLease)
+	env.string("ADMIN_TOKEN", &cfg.AdminToken)
+	env.string("ADMIN_TOKEN_FILE", &cfg.AdminTokenFile)
+	env.string("AUTH_MODE", &cfg.AuthMode)
+	env.string("KUBECONFIG", &cfg.Kubeconfig)
+	env.string("KUBE_CONTEXT", &cfg.KubeContext)
+	env.list("RECOVERY_LADDER", &cfg.Policy.Ladder)
+	env.string("NODE_SELECTOR", &cfg.Policy.Selectors.Include)
+	env.string("EXCLUDE_NODE_SELECTOR", &cfg.Policy.Selectors.Exclude)
+	env.int("MAX_CONCURRENT_REMEDIATIONS", &cfg.Policy.Budgets.MaxConcurrent)
+	env.int("MAX_REMEDIATIONS_PER_HOUR", &cfg.Policy.Budgets.MaxPerHour)
+	env.bool("INSECURE_SKIP_VERIFY", &cfg.InsecureSkipVerify)
+	env.string("HARVESTER_API", &cfg.HarvesterAPI)
+	env.string("HARVESTER_KEY", &cfg.HarvesterKey)
+	env.string("HARVESTER_KEY_FILE", &cfg.HarvesterKeyFile)
+	env.string("HARVESTER_NAMESPACE", &cfg.HarvesterNamespace)
+	env.string("HARD_REBOOT_PROVIDER", &cfg.HardRebootProvider)
+	env.string("REDFISH_USERNAME", &cfg.RedfishUsername)
+	env.string("REDFISH_PASSWORD", &cfg.RedfishPassword)
+	env.string("REDFISH_PASSWORD_FILE", &cfg.RedfishPasswordFile)
+	env.string("REDFISH_RESET_TYPE", &cfg.RedfishResetType)
+	env.string("REDFISH_SECRET_NAMESPACE", &cfg.RedfishSecretNamespace)
+	env.string("RANCHER_API", &cfg.RancherAPI)
+	env.string("RANCHER_KEY", &cfg.RancherKey)
+	env.string("RANCHER_KEY_FILE", &cfg.RancherKeyFile)
+	env.string("RANCHER_TOKEN", &cfg.RancherToken)
+	env.string("RANCHER_TOKEN_FILE", &cfg.RancherTokenFile)
+	env.string("CREDENTIALS_SECRET", &cfg.CredentialsSecret)
+	env.string("RANCHER_CA_FILE", &cfg.RancherCAFile)
+	env.string("RANCHER_CLUSTER", &cfg.RancherCluster)
+	env.string("CLUSTER_NAME", &cfg.ClusterName)
+	env.bool("MULTI_CLUSTER", &cfg.MultiCluster)
+	env.string("CLUSTER_SELECTOR", &cfg.ClusterSelector)
+	env.string("CLUSTER_NAME_PATTERN", &cfg.ClusterNamePattern)
+	env.minutes("CLUSTER_DISCOVERY_INTERVAL_MINUTES", &cfg.ClusterDiscovery)
+	env.minutes("KUBECONFIG_TTL_MINUTES", &cfg.KubeconfigTTL)
+	env.string("MACHINE_PROVIDER", &cfg.MachineProvider)
+	env.string("CAPI_KUBECONFIG", &cfg.CAPIKubeconfig)
+	env.string("CAPI_NAMESPACE", &cfg.CAPINamespace)
+	env.string("CAPI_REMEDIATION_MODE", &cfg.CAPIRemediationMode)
+	env.minutes("REPLACEMENT_TIMEOUT_MINUTES", &cfg.ReplacementTimeout)
+	env.string("MACHINE_POOL_LABEL", &cfg.MachinePoolLabel)
+	env.string("KUBELET_RESTART_COMMAND", &cfg.KubeletRestartCommand)
+	env.int("RECOVERY_WAIT_TIME_MINUTES", &cfg.RecoveryWaitTimeMinutes)
+	env.int("DRAIN_TIMEOUT_MINUTES", &cfg.DrainTimeoutMinutes)
+	env.int("RECOVERY_DELAY_MINUTES", &cfg.RecoveryDelayMinutes)
+	env.minutes("NEW_NODE_THRESHOLD", &cfg.NewNodeThreshold)
+	env.minutes("RESCAN_INTERVAL", &cfg.RescanInterval)
+	env.minutes("INFORMER_RESYNC_MINUTES", &cfg.InformerResync)
+	env.int("WORKERS", &cfg.Workers)
+	env.seconds("SHUTDOWN_TIMEOUT_SECONDS", &cfg.ShutdownTimeout)
+	return env.err()
+}
+
+// envLoader reads environment variables into configuration fields, collecting parse errors.
+type envLoader struct {
+	errs []error
+}
+
+func (e *envLoader) string(key string, target *string) {
 	if value, exists := os.LookupEnv(key); exists {
-		return value
+		*target = value
 	}
-	return defaultValue
 }
 
-func parseEnvInt(key string, defaultValue int) int {
+// list parses a comma-separated list, ignoring empty entries.
+func (e *envLoader) list(key string, target *[]string) {
 	value, exists := os.LookupEnv(key)
 	if !exists {
-		return defaultValue
+		return
+	}
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	*target = list
+}
+
+func (e *envLoader) int(key string, target *int) {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return
 	}
 	intValue, err := strconv.Atoi(value)
 	if err != nil {
-		log.Printf("Error parsing %s as int: %v. Using default value: %d", key, err, defaultValue)
-		return defaultValue
+		e.errs = append(e.errs, fmt.Errorf("error parsing %s as int: %w", key, err))
+		return
 	}
-	return intValue
+	*target = intValue
 }
 
-func parseEnvBool(key string, defaultValue bool) bool {
+func (e *envLoader) bool(key string, target *bool) {
 	value, exists := os.LookupEnv(key)
 	if !exists {
-		return defaultValue
+		return
 	}
 	boolValue, err := strconv.ParseBool(value)
 	if err != nil {
-		log.Printf("Error parsing %s as bool: %v. Using default value: %t", key, err, defaultValue)
-		return defaultValue
+		e.errs = append(e.errs, fmt.Errorf("error parsing %s as bool: %w", key, err))
+		return
 	}
-	return boolValue
+	*target = boolValue
+}
+
+// minutes parses an integer number of minutes into a duration.
+func (e *envLoader) minutes(key string, target *time.Duration) {
+	var value int
+	before := len(e.errs)
+	e.int(key, &value)
+	if _, exists := os.LookupEnv(key); exists && len(e.errs) == before {
+		*target = time.Duration(value) * time.Minute
+	}
+}
+
+// seconds parses an integer number of seconds into a duration.
+func (e *envLoader) seconds(key string, target *time.Duration) {
+	var value int
+	before := len(e.errs)
+	e.int(key, &value)
+	if _, exists := os.LookupEnv(key); exists && len(e.errs) == before {
+		*target = time.Duration(value) * time.Second
+	}
+}
+
+func (e *envLoader) err() error {
+	return errors.Join(e.errs...)
 }
 
 func validatePort(port int) error {
@@ -93,27 +370,190 @@ func validateNonEmpty(field, value string) error {
 	return nil
 }
 
+func validateOneOf(field, value string, allowed ...string) error {
+	for _, a := range allowed {
+		if value == a {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid %s %q; must be one of %v", field, value, allowed)
+}
+
+// Recovery steps that can appear in the recovery ladder.
+const (
+	StepRestartKubelet   = "restart_kubelet"
+	StepSSHAndReboot     = "ssh_and_reboot"
+	StepHardReboot       = "hard_reboot"
+	StepDeleteViaRancher = "delete_via_rancher"
+	StepRemediateViaCAPI = "remediate_via_capi"
+)
+
+// RecoverySteps lists every recovery step, from least to most disruptive.
+var RecoverySteps = []string{StepRestartKubelet, StepSSHAndReboot, StepHardReboot, StepDeleteViaRancher, StepRemediateViaCAPI}
+
+// defaultRecoveryLadder returns the ladder used when neither the config file nor
+// RECOVERY_LADDER set one. With probing enabled it starts at restart_kubelet, which the
+// probe result skips when the host does not answer SSH.
+func defaultRecoveryLadder(machineProvider string, probe bool) []string {
+	ladder := []string{StepSSHAndReboot, StepHardReboot, StepDeleteViaRancher}
+	if machineProvider == "capi" {
+		ladder = []string{StepSSHAndReboot, StepHardReboot, StepRemediateViaCAPI}
+	}
+	if probe {
+		ladder = append([]string{StepRestartKubelet}, ladder...)
+	}
+	return ladder
+}
+
+// LadderUses reports whether the recovery ladder, or the ladder of a rule, contains the
+// given step.
+func (cfg *AppConfig) LadderUses(step string) bool {
+	ladders := [][]string{cfg.Policy.Ladder}
+	for _, rule := range cfg.Policy.Rules {
+		ladders = append(ladders, rule.Ladder)
+	}
+	for _, ladder := range ladders {
+		for _, s := range ladder {
+			if s == step {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func ValidateConfiguration(cfg *AppConfig) error {
 	if err := validatePort(cfg.MetricsPort); err != nil {
 		return err
 	}
-	if err := validateNonEmpty("harvesterAPI", cfg.HarvesterAPI); err != nil {
+	if err := validateOneOf("metricsNodeLabel", cfg.MetricsNodeLabel, "node", "pool"); err != nil {
 		return err
 	}
-	if err := validateNonEmpty("harvesterKey", cfg.HarvesterKey); err != nil {
+	if err := validateOneOf("logLevel", cfg.LogLevel, "trace", "debug", "info", "warn", "error"); err != nil {
 		return err
 	}
-	if err := validateNonEmpty("harvesterNamespace", cfg.HarvesterNamespace); err != nil {
+	if err := validateOneOf("logFormat", cfg.LogFormat, "text", "json"); err != nil {
 		return err
 	}
-	if err := validateNonEmpty("rancherAPI", cfg.RancherAPI); err != nil {
-		return err
+	if cfg.TracingEnabled {
+		if err := validateNonEmpty("otlpEndpoint", cfg.OTLPEndpoint); err != nil {
+			return err
+		}
 	}
-	if err := validateNonEmpty("rancherKey", cfg.RancherKey); err != nil {
+	if err := validateOneOf("authMode", cfg.AuthMode, "rancher", "in-cluster", "kubeconfig"); err != nil {
 		return err
 	}
-	if err := validateNonEmpty("rancherCluster", cfg.RancherCluster); err != nil {
+	if err := validateOneOf("machineProvider", cfg.MachineProvider, "rancher", "capi"); err != nil {
 		return err
 	}
+	if err := ValidatePolicy(&cfg.Policy); err != nil {
+		return fmt.Errorf("policy: %w", err)
+	}
+	if cfg.RescanInterval <= 0 {
+		return fmt.Errorf("rescanInterval must be positive")
+	}
+	if cfg.InformerResync < 0 {
+		return fmt.Errorf("informerResync cannot be negative")
+	}
+	if cfg.Workers <= 0 {
+		return fmt.Errorf("workers must be positive")
+	}
+	if cfg.ShutdownTimeout <= 0 {
+		return fmt.Errorf("shutdownTimeout must be positive")
+	}
+	if cfg.RecoveryWaitTimeMinutes <= 0 || cfg.DrainTimeoutMinutes <= 0 {
+		return fmt.Errorf("recoveryWaitTimeMinutes and drainTimeoutMinutes must be positive")
+	}
+
+	// Only require provider settings for the providers the ladder actually uses.
+	if cfg.LadderUses(StepRestartKubelet) {
+		if err := validateNonEmpty("kubeletRestartCommand", cfg.KubeletRestartCommand); err != nil {
+			return err
+		}
+	}
+	if cfg.LadderUses(StepHardReboot) {
+		if err := validateOneOf("hardRebootProvider", cfg.HardRebootProvider, "harvester", "redfish"); err != nil {
+			return err
+		}
+		switch cfg.HardRebootProvider {
+		case "harvester":
+			if err := validateNonEmpty("harvesterAPI", cfg.HarvesterAPI); err != nil {
+				return err
+			}
+			if !cfg.hasSecret(cfg.HarvesterKey, cfg.HarvesterKeyFile) {
+				return fmt.Errorf("one of harvesterKey, harvesterKeyFile or credentialsSecret must be set")
+			}
+			if err := validateNonEmpty("harvesterNamespace", cfg.HarvesterNamespace); err != nil {
+				return err
+			}
+		case "redfish":
+			if err := validateOneOf("redfishResetType", cfg.RedfishResetType, "ForceRestart", "GracefulRestart", "PowerCycle"); err != nil {
+				return err
+			}
+		}
+	}
+	if cfg.AuthMode == "rancher" || cfg.LadderUses(StepDeleteViaRancher) {
+		if err := validateNonEmpty("rancherAPI", cfg.RancherAPI); err != nil {
+			return err
+		}
+		if !cfg.hasSecret(cfg.RancherKey, cfg.RancherKeyFile) && !cfg.hasSecret(cfg.RancherToken, cfg.RancherTokenFile) {
+			return fmt.Errorf("one of rancherKey, rancherToken, their *File variants or credentialsSecret must be set")
+		}
+	}
+	if cfg.AuthMode == "rancher" && !cfg.MultiCluster {
+		if err := validateNonEmpty("rancherCluster", cfg.RancherCluster); err != nil {
+			return err
+		}
+	}
+	for _, ref := range []struct{ name, value string }{
+		{"credentialsSecret", cfg.CredentialsSecret},
+		{"killSwitchConfigMap", cfg.KillSwitchConfigMap},
+		{"killSwitchDeployment", cfg.KillSwitchDeployment},
+	} {
+		if ref.value != "" && !strings.Contains(ref.value, "/") {
+			return fmt.Errorf("%s %q must be in namespace/name form", ref.name, ref.value)
+		}
+	}
+	if cfg.KillSwitchConfigMap != "" {
+		if err := validateNonEmpty("killSwitchKey", cfg.KillSwitchKey); err != nil {
+			return err
+		}
+	}
+	if cfg.LeaderElection {
+		for _, field := range []struct{ name, value string }{
+			{"podName", cfg.PodName},
+			{"podNamespace", cfg.PodNamespace},
+			{"leaderElectionLease", cfg.LeaderElectionLease},
+		} {
+			if err := validateNonEmpty(field.name, field.value); err != nil {
+				return fmt.Errorf("leader election: %w", err)
+			}
+		}
+	}
+	if cfg.MultiCluster {
+		if cfg.AuthMode != "rancher" {
+			return fmt.Errorf("multiCluster requires authMode rancher, got %q", cfg.AuthMode)
+		}
+		if _, err := regexp.Compile(cfg.ClusterNamePattern); err != nil {
+			return fmt.Errorf("invalid clusterNamePattern: %w", err)
+		}
+		if cfg.ClusterDiscovery <= 0 {
+			return fmt.Errorf("clusterDiscovery must be positive")
+		}
+	}
+	if cfg.LadderUses(StepRemediateViaCAPI) {
+		if cfg.CAPIKubeconfig == "" {
+			return fmt.Errorf("capiKubeconfig must point at the management cluster when the ladder uses %s", StepRemediateViaCAPI)
+		}
+		if _, err := os.Stat(cfg.CAPIKubeconfig); err != nil {
+			return fmt.Errorf("invalid capiKubeconfig: %w", err)
+		}
+		if err := validateNonEmpty("capiNamespace", cfg.CAPINamespace); err != nil {
+			return err
+		}
+		if err := validateOneOf("capiRemediationMode", cfg.CAPIRemediationMode, "delete", "annotate"); err != nil {
+			return err
+		}
+	}
 	return nil
 }
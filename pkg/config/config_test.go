@@ -0,0 +1,27 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDefaultRecoveryLadder(t *testing.T) {
+	tests := []struct {
+		file string
+		want []string
+	}{
+		{file: "", want: []string{StepSSHAndReboot, StepHardReboot, StepDeleteViaRancher}},
+		{file: "policy:\n  probe:\n    enabled: true\n", want: []string{StepRestartKubelet, StepSSHAndReboot, StepHardReboot, StepDeleteViaRancher}},
+		{file: "machineProvider: capi\npolicy:\n  probe:\n    enabled: true\n", want: []string{StepRestartKubelet, StepSSHAndReboot, StepHardReboot, StepRemediateViaCAPI}},
+		{file: "policy:\n  ladder: [hard_reboot]\n  probe:\n    enabled: true\n", want: []string{StepHardReboot}},
+	}
+	for _, tt := range tests {
+		cfg, err := Load([]byte(testFile + tt.file))
+		if err != nil {
+			t.Fatalf("Load(%q): %v", tt.file, err)
+		}
+		if !reflect.DeepEqual(cfg.Policy.Ladder, tt.want) {
+			t.Errorf("ladder of %q = %v, want %v", tt.file, cfg.Policy.Ladder, tt.want)
+		}
+	}
+}
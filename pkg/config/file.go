@@ -0,0 +1,154 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"sigs.k8s.io/yaml"
+)
+
+// parseFile decodes YAML or JSON config file contents on top of cfg.
+func parseFile(data []byte, cfg *AppConfig) error {
+	jsonData, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return fmt.Errorf("parse YAML: %w", err)
+	}
+	return cfg.UnmarshalJSON(jsonData)
+}
+
+// duration is a time.Duration written as a Go duration string such as "30m".
+type duration time.Duration
+
+func (d *duration) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return fmt.Errorf("duration must be a string such as \"30m\", got %s", string(data))
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	*d = duration(parsed)
+	return nil
+}
+
+func (d duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON decodes a configuration strictly: unknown keys are rejected and durations
+// are read as strings. Keys that are absent keep their current value.
+func (cfg *AppConfig) UnmarshalJSON(data []byte) error {
+	type plain AppConfig
+	aux := struct {
+		*plain
+		ClusterDiscovery   *duration `json:"clusterDiscovery"`
+		KubeconfigTTL      *duration `json:"kubeconfigTTL"`
+		ReplacementTimeout *duration `json:"replacementTimeout"`
+		NewNodeThreshold   *duration `json:"newNodeThreshold"`
+		RescanInterval     *duration `json:"rescanInterval"`
+		InformerResync     *duration `json:"informerResync"`
+		ShutdownTimeout    *duration `json:"shutdownTimeout"`
+	}{
+		plain:              (*plain)(cfg),
+		ClusterDiscovery:   (*duration)(&cfg.ClusterDiscovery),
+		KubeconfigTTL:      (*duration)(&cfg.KubeconfigTTL),
+		ReplacementTimeout: (*duration)(&cfg.ReplacementTimeout),
+		NewNodeThreshold:   (*duration)(&cfg.NewNodeThreshold),
+		RescanInterval:     (*duration)(&cfg.RescanInterval),
+		InformerResync:     (*duration)(&cfg.InformerResync),
+		ShutdownTimeout:    (*duration)(&cfg.ShutdownTimeout),
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(&aux)
+}
+
+// MarshalJSON encodes a configuration with durations written as strings and all
+// credentials redacted.
+func (cfg AppConfig) MarshalJSON() ([]byte, error) {
+	type plain AppConfig
+	cfg = cfg.Redacted()
+	return json.Marshal(struct {
+		plain
+		ClusterDiscovery   duration `json:"clusterDiscovery"`
+		KubeconfigTTL      duration `json:"kubeconfigTTL"`
+		ReplacementTimeout duration `json:"replacementTimeout"`
+		NewNodeThreshold   duration `json:"newNodeThreshold"`
+		RescanInterval     duration `json:"rescanInterval"`
+		InformerResync     duration `json:"informerResync"`
+		ShutdownTimeout    duration `json:"shutdownTimeout"`
+	}{
+		plain:              plain(cfg),
+		ClusterDiscovery:   duration(cfg.ClusterDiscovery),
+		KubeconfigTTL:      duration(cfg.KubeconfigTTL),
+		ReplacementTimeout: duration(cfg.ReplacementTimeout),
+		NewNodeThreshold:   duration(cfg.NewNodeThreshold),
+		RescanInterval:     duration(cfg.RescanInterval),
+		InformerResync:     duration(cfg.InformerResync),
+		ShutdownTimeout:    duration(cfg.ShutdownTimeout),
+	})
+}
+
+// UnmarshalJSON decodes the partition settings with durations read as strings.
+func (pc *PartitionConfig) UnmarshalJSON(data []byte) error {
+	type plain PartitionConfig
+	aux := struct {
+		*plain
+		Window       *duration `json:"window"`
+		ProbeTimeout *duration `json:"probeTimeout"`
+	}{
+		plain:        (*plain)(pc),
+		Window:       (*duration)(&pc.Window),
+		ProbeTimeout: (*duration)(&pc.ProbeTimeout),
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(&aux)
+}
+
+// MarshalJSON encodes the partition settings with durations written as strings.
+func (pc PartitionConfig) MarshalJSON() ([]byte, error) {
+	type plain PartitionConfig
+	return json.Marshal(struct {
+		plain
+		Window       duration `json:"window"`
+		ProbeTimeout duration `json:"probeTimeout"`
+	}{
+		plain:        plain(pc),
+		Window:       duration(pc.Window),
+		ProbeTimeout: duration(pc.ProbeTimeout),
+	})
+}
+
+// UnmarshalJSON decodes the probe settings with the timeout read as a string.
+func (pc *ProbeConfig) UnmarshalJSON(data []byte) error {
+	type plain ProbeConfig
+	aux := struct {
+		*plain
+		Timeout *duration `json:"timeout"`
+	}{
+		plain:   (*plain)(pc),
+		Timeout: (*duration)(&pc.Timeout),
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(&aux)
+}
+
+// MarshalJSON encodes the probe settings with the timeout written as a string.
+func (pc ProbeConfig) MarshalJSON() ([]byte, error) {
+	type plain ProbeConfig
+	return json.Marshal(struct {
+		plain
+		Timeout duration `json:"timeout"`
+	}{
+		plain:   plain(pc),
+		Timeout: duration(pc.Timeout),
+	})
+}
@@ -0,0 +1,216 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// PolicyConfig holds the rules deciding whether and how nodes are remediated.
+type PolicyConfig struct {
+	Ladder    []string            `json:"ladder"`
+	Windows   []MaintenanceWindow `json:"windows"`
+	Selectors NodeSelectors       `json:"selectors"`
+	Budgets   Budgets             `json:"budgets"`
+	Partition PartitionConfig     `json:"partition"`
+	Probe     ProbeConfig         `json:"probe"`
+	Rules     []RuleConfig        `json:"rules"`
+
+	compiled []*Rule // Set by validation
+}
+
+// MaintenanceWindow is a recurring period during which remediation is allowed. When no
+// windows are configured, remediation is allowed at any time.
+type MaintenanceWindow struct {
+	Days     []string `json:"days"`     // Mon through Sun; empty means every day
+	Start    string   `json:"start"`    // HH:MM
+	End      string   `json:"end"`      // HH:MM; may be earlier than Start to wrap past midnight
+	Timezone string   `json:"timezone"` // IANA time zone; defaults to UTC
+}
+
+// NodeSelectors restrict remediation to a subset of nodes using label selectors.
+type NodeSelectors struct {
+	Include string `json:"include"` // Nodes must match this selector to be remediated
+	Exclude string `json:"exclude"` // Nodes matching this selector are never remediated
+}
+
+// Budgets limit how much remediation may happen at once in each cluster. Zero means unlimited.
+type Budgets struct {
+	MaxConcurrent int `json:"maxConcurrent"`
+	MaxPerHour    int `json:"maxPerHour"`
+}
+
+// PartitionConfig tells a network partition between the controller and the nodes apart
+// from nodes actually failing. Remediation is suppressed while the fault looks to be on
+// the controller's side.
+type PartitionConfig struct {
+	MaxNotReadyRatio float64       `json:"maxNotReadyRatio"` // Share of nodes NotReady together that suggests a partition; 0 disables the check
+	MinNodes         int           `json:"minNodes"`         // Clusters with fewer nodes skip the ratio check
+	Window           time.Duration `json:"window"`           // How close together nodes must have gone NotReady to count together
+	ProbeTimeout     time.Duration `json:"probeTimeout"`     // Timeout of the API server check
+	MaxSuppression   time.Duration `json:"maxSuppression"`   // Nodes NotReady for longer are remediated despite a suspected partition; 0 suppresses for as long as it lasts
+}
+
+// ProbeConfig configures the direct liveness probes of NotReady nodes, whose results choose
+// where on the ladder remediation starts: past the steps needing SSH when the host does not
+// answer, and at restart_kubelet when only the kubelet is down. A node whose kubelet answers
+// while it stopped reporting to the API server is left alone as partitioned. Enabling the
+// probes starts the default ladder at restart_kubelet.
+type ProbeConfig struct {
+	Enabled     bool          `json:"enabled"`
+	SSHPort     int           `json:"sshPort"`
+	KubeletPort int           `json:"kubeletPort"` // Defaults to the port the node reports for its kubelet
+	HTTPURL     string        `json:"httpURL"`     // Optional endpoint expected to answer 2xx; {address} is replaced by the node address
+	Timeout     time.Duration `json:"timeout"`
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// Contains reports whether t falls within the window.
+func (w MaintenanceWindow) Contains(t time.Time) bool {
+	location, err := time.LoadLocation(w.Timezone)
+	if err != nil {
+		return false
+	}
+	t = t.In(location)
+
+	start, _ := time.Parse("15:04", w.Start)
+	end, _ := time.Parse("15:04", w.End)
+	minute := t.Hour()*60 + t.Minute()
+	startMinute := start.Hour()*60 + start.Minute()
+	endMinute := end.Hour()*60 + end.Minute()
+
+	// For windows wrapping past midnight, the early morning part belongs to the previous day.
+	day := t.Weekday()
+	inWindow := minute >= startMinute && minute < endMinute
+	if endMinute <= startMinute {
+		inWindow = minute >= startMinute || minute < endMinute
+		if minute < endMinute {
+			day = (day + 6) % 7
+		}
+	}
+	return inWindow && w.onDay(day)
+}
+
+func (w MaintenanceWindow) onDay(day time.Weekday) bool {
+	if len(w.Days) == 0 {
+		return true
+	}
+	for _, d := range w.Days {
+		if weekdays[strings.ToLower(d)[:3]] == day {
+			return true
+		}
+	}
+	return false
+}
+
+// InWindow reports whether remediation is allowed at t.
+func (p *PolicyConfig) InWindow(t time.Time) bool {
+	if len(p.Windows) == 0 {
+		return true
+	}
+	for _, w := range p.Windows {
+		if w.Contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// SelectsNode reports whether a node with the given labels may be remediated.
+func (p *PolicyConfig) SelectsNode(nodeLabels map[string]string) bool {
+	if p.Selectors.Include != "" {
+		include, err := labels.Parse(p.Selectors.Include)
+		if err != nil || !include.Matches(labels.Set(nodeLabels)) {
+			return false
+		}
+	}
+	if p.Selectors.Exclude != "" {
+		exclude, err := labels.Parse(p.Selectors.Exclude)
+		if err != nil || exclude.Matches(labels.Set(nodeLabels)) {
+			return false
+		}
+	}
+	return true
+}
+
+// ValidatePolicy checks a policy and compiles its rules. ValidateConfiguration calls it;
+// it is exported for tools working on a policy alone, such as the simulator.
+func ValidatePolicy(p *PolicyConfig) error {
+	if len(p.Ladder) == 0 {
+		return fmt.Errorf("ladder cannot be empty")
+	}
+	for _, step := range p.Ladder {
+		if err := validateOneOf("recovery step", step, RecoverySteps...); err != nil {
+			return err
+		}
+	}
+
+	for i, w := range p.Windows {
+		if _, err := time.Parse("15:04", w.Start); err != nil {
+			return fmt.Errorf("windows[%d]: invalid start %q; must be HH:MM", i, w.Start)
+		}
+		if _, err := time.Parse("15:04", w.End); err != nil {
+			return fmt.Errorf("windows[%d]: invalid end %q; must be HH:MM", i, w.End)
+		}
+		if w.Start == w.End {
+			return fmt.Errorf("windows[%d]: start and end cannot be equal", i)
+		}
+		if _, err := time.LoadLocation(w.Timezone); err != nil {
+			return fmt.Errorf("windows[%d]: invalid timezone %q: %w", i, w.Timezone, err)
+		}
+		for _, d := range w.Days {
+			if len(d) < 3 {
+				return fmt.Errorf("windows[%d]: invalid day %q", i, d)
+			}
+			if _, ok := weekdays[strings.ToLower(d)[:3]]; !ok {
+				return fmt.Errorf("windows[%d]: invalid day %q", i, d)
+			}
+		}
+	}
+
+	if _, err := labels.Parse(p.Selectors.Include); err != nil {
+		return fmt.Errorf("selectors.include: %w", err)
+	}
+	if _, err := labels.Parse(p.Selectors.Exclude); err != nil {
+		return fmt.Errorf("selectors.exclude: %w", err)
+	}
+
+	if p.Budgets.MaxConcurrent < 0 || p.Budgets.MaxPerHour < 0 {
+		return fmt.Errorf("budgets cannot be negative")
+	}
+	if p.Partition.MaxNotReadyRatio < 0 || p.Partition.MaxNotReadyRatio > 1 {
+		return fmt.Errorf("partition.maxNotReadyRatio must be between 0 and 1")
+	}
+	if p.Partition.MinNodes < 0 || p.Partition.Window < 0 || p.Partition.MaxSuppression < 0 {
+		return fmt.Errorf("partition.minNodes, partition.window and partition.maxSuppression cannot be negative")
+	}
+	if p.Partition.ProbeTimeout <= 0 {
+		return fmt.Errorf("partition.probeTimeout must be positive")
+	}
+	if p.Probe.Enabled {
+		if err := validatePort(p.Probe.SSHPort); err != nil {
+			return fmt.Errorf("probe.sshPort: %w", err)
+		}
+		if p.Probe.KubeletPort != 0 {
+			if err := validatePort(p.Probe.KubeletPort); err != nil {
+				return fmt.Errorf("probe.kubeletPort: %w", err)
+			}
+		}
+		if p.Probe.HTTPURL != "" {
+			if _, err := url.Parse(strings.ReplaceAll(p.Probe.HTTPURL, "{address}", "127.0.0.1")); err != nil {
+				return fmt.Errorf("probe.httpURL: %w", err)
+			}
+		}
+		if p.Probe.Timeout <= 0 {
+			return fmt.Errorf("probe.timeout must be positive")
+		}
+	}
+	return validateRules(p)
+}
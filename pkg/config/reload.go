@@ -0,0 +1,100 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// reloadMu serializes configuration swaps. Readers do not take it, they use Get.
+var reloadMu sync.Mutex
+
+// Reload parses and validates new config file contents and, when valid, makes them the
+// active configuration. The environment still takes precedence over the file.
+func Reload(fileData []byte) error {
+	cfg, err := Load(fileData)
+	if err != nil {
+		return err
+	}
+	if err := ValidateConfiguration(&cfg); err != nil {
+		return err
+	}
+
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	if err := validateReload(Get(), &cfg); err != nil {
+		return err
+	}
+	active.Store(&cfg)
+	return nil
+}
+
+// validateReload rejects changes to settings that only take effect at startup.
+func validateReload(current, next *AppConfig) error {
+	switch {
+	case current.MetricsPort != next.MetricsPort:
+		return fmt.Errorf("metricsPort cannot be changed without a restart")
+	case current.AuthMode != next.AuthMode:
+		return fmt.Errorf("authMode cannot be changed without a restart")
+	case current.TracingEnabled != next.TracingEnabled || current.OTLPEndpoint != next.OTLPEndpoint:
+		return fmt.Errorf("tracing cannot be changed without a restart")
+	case current.LeaderElection != next.LeaderElection || current.LeaderElectionLease != next.LeaderElectionLease:
+		return fmt.Errorf("leader election cannot be changed without a restart")
+	case current.MultiCluster != next.MultiCluster:
+		return fmt.Errorf("multiCluster cannot be changed without a restart")
+	case current.RancherCluster != next.RancherCluster:
+		return fmt.Errorf("rancherCluster cannot be changed without a restart")
+	case current.Workers != next.Workers || current.InformerResync != next.InformerResync:
+		return fmt.Errorf("workers and informerResync cannot be changed without a restart")
+	case current.KillSwitchConfigMap != next.KillSwitchConfigMap || current.KillSwitchKey != next.KillSwitchKey ||
+		current.KillSwitchDeployment != next.KillSwitchDeployment:
+		return fmt.Errorf("the kill switch cannot be changed without a restart")
+	}
+	return nil
+}
+
+// WatchConfigMap watches the ConfigMap referenced by ConfigMap ("namespace/name") and reloads
+// the configuration from its ConfigMapKey whenever it changes. onReload is called with the
+// result of every reload attempt. It blocks until ctx is cancelled.
+func WatchConfigMap(ctx context.Context, clientset kubernetes.Interface, onReload func(error)) {
+	ref, key := Get().ConfigMap, Get().ConfigMapKey
+	namespace, name, found := strings.Cut(ref, "/")
+	if !found {
+		onReload(fmt.Errorf("configMap %q must be in namespace/name form", ref))
+		return
+	}
+
+	var lastApplied string
+	handle := func(obj interface{}) {
+		configMap, ok := obj.(*v1.ConfigMap)
+		if !ok {
+			return
+		}
+		data, exists := configMap.Data[key]
+		if !exists {
+			onReload(fmt.Errorf("configMap %s has no key %s", ref, key))
+			return
+		}
+		if data == lastApplied {
+			return
+		}
+		err := Reload([]byte(data))
+		if err == nil {
+			lastApplied = data
+		}
+		onReload(err)
+	}
+
+	listWatch := cache.NewListWatchFromClient(clientset.CoreV1().RESTClient(), "configmaps", namespace, fields.OneTermEqualSelector("metadata.name", name))
+	_, informer := cache.NewInformer(listWatch, &v1.ConfigMap{}, 0, cache.ResourceEventHandlerFuncs{
+		AddFunc:    handle,
+		UpdateFunc: func(_, newObj interface{}) { handle(newObj) },
+	})
+	informer.Run(ctx.Done())
+}
@@ -0,0 +1,114 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testFile is a minimal valid config file.
+const testFile = "authMode: kubeconfig\nharvesterKey: key\nrancherToken: token\n"
+
+// useConfig makes a valid configuration based on the defaults active for the test.
+func useConfig(t *testing.T, modify func(*AppConfig)) *AppConfig {
+	t.Helper()
+	cfg, err := Load([]byte(testFile))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if modify != nil {
+		modify(&cfg)
+	}
+	if err := ValidateConfiguration(&cfg); err != nil {
+		t.Fatalf("invalid test configuration: %v", err)
+	}
+	previous := Get()
+	active.Store(&cfg)
+	t.Cleanup(func() { active.Store(previous) })
+	return &cfg
+}
+
+// reloadFile returns config file contents whose rescan interval, in minutes, always equals
+// recoveryDelayMinutes, so readers can tell a torn configuration.
+func reloadFile(minutes int) []byte {
+	return []byte(fmt.Sprintf(testFile+"rescanInterval: %dm\nrecoveryDelayMinutes: %d\n", minutes, minutes))
+}
+
+func TestReloadConcurrentWithReaders(t *testing.T) {
+	useConfig(t, func(cfg *AppConfig) {
+		cfg.RescanInterval = time.Minute
+		cfg.RecoveryDelayMinutes = 1
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var readers sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for ctx.Err() == nil {
+				cfg := FromContext(ctx)
+				if cfg.RescanInterval != time.Duration(cfg.RecoveryDelayMinutes)*time.Minute {
+					t.Errorf("torn configuration: rescanInterval %s, recoveryDelayMinutes %d", cfg.RescanInterval, cfg.RecoveryDelayMinutes)
+					return
+				}
+				_ = cfg.Policy.CompiledRules()
+				_ = RancherToken()
+			}
+		}()
+	}
+
+	for i := 0; i < 200; i++ {
+		if err := Reload(reloadFile(1 + i%5)); err != nil {
+			t.Fatalf("Reload: %v", err)
+		}
+	}
+	cancel()
+	readers.Wait()
+
+	if got := Get().RescanInterval; got != 5*time.Minute {
+		t.Errorf("rescanInterval after the last reload = %s, want 5m", got)
+	}
+}
+
+func TestReloadKeepsSnapshots(t *testing.T) {
+	useConfig(t, func(cfg *AppConfig) { cfg.RescanInterval = time.Minute })
+
+	ctx := WithSnapshot(context.Background(), Get())
+	if err := Reload(reloadFile(7)); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if got := FromContext(ctx).RescanInterval; got != time.Minute {
+		t.Errorf("snapshot rescanInterval = %s after a reload, want the 1m it was taken with", got)
+	}
+	if got := FromContext(context.Background()).RescanInterval; got != 7*time.Minute {
+		t.Errorf("active rescanInterval = %s, want 7m", got)
+	}
+}
+
+func TestReloadRejected(t *testing.T) {
+	before := useConfig(t, nil)
+
+	tests := []struct {
+		name string
+		file string
+	}{
+		{name: "unknown key", file: testFile + "rescanIntervall: 1m\n"},
+		{name: "invalid value", file: testFile + "workers: 0\n"},
+		{name: "startup-only setting", file: testFile + "metricsPort: 9091\n"},
+		{name: "leader election", file: testFile + "leaderElection: true\npodName: pod\npodNamespace: ns\n"},
+		{name: "leader election without pod", file: testFile + "leaderElection: true\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Reload([]byte(tt.file)); err == nil {
+				t.Fatal("Reload succeeded")
+			}
+			if Get() != before {
+				t.Error("a rejected reload replaced the active configuration")
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/ext"
+	v1 "k8s.io/api/core/v1"
+)
+
+// Actions a rule may take on the nodes it matches.
+const (
+	RuleActionRemediate = "remediate" // Remediate the node, even if it is Ready
+	RuleActionSuppress  = "suppress"  // Never remediate the node while the rule matches
+	RuleActionIgnore    = "ignore"    // Leave the node alone without counting a suppression
+)
+
+// ruleCostLimit bounds the evaluation cost of a single rule, so that a rule iterating over
+// many pods cannot stall the controller.
+const ruleCostLimit = 1000000
+
+// RuleConfig is a custom remediation rule. Expression is a CEL expression evaluated against
+// the node ("node") and the pods scheduled on it ("pods"), typed as the Node and Pod API
+// types with their fields named as in JSON, for example:
+//
+//	node.status.conditions.exists(c, c.type == 'KernelDeadlock' && c.status == 'True')
+//
+// Rules are evaluated in order and the first one matching decides.
+//
+// The expressions are type-checked when the configuration is loaded, so a misspelled field
+// is rejected. Fields left empty hold their zero value, and has() reports whether a field
+// is set. Timestamps are the Time field of their object, for example
+// node.metadata.creationTimestamp.Time; resource quantities are not visible to rules.
+type RuleConfig struct {
+	Name       string   `json:"name"`
+	Expression string   `json:"expression"`
+	Action     string   `json:"action"` // remediate, suppress or ignore; defaults to remediate
+	Ladder     []string `json:"ladder"` // Steps to run when remediating; defaults to the policy ladder
+}
+
+// Rule is a compiled and type-checked RuleConfig.
+type Rule struct {
+	RuleConfig
+	program  cel.Program
+	usesPods bool
+}
+
+var (
+	ruleEnvOnce sync.Once
+	ruleEnv     *cel.Env
+	ruleEnvErr  error
+)
+
+// newRuleEnv returns the CEL environment rules are compiled in.
+func newRuleEnv() (*cel.Env, error) {
+	ruleEnvOnce.Do(func() {
+		ruleEnv, ruleEnvErr = cel.NewEnv(
+			ext.NativeTypes(ext.ParseStructTag("json"), reflect.TypeOf(v1.Node{}), reflect.TypeOf(v1.Pod{})),
+			cel.Variable("node", cel.ObjectType("v1.Node")),
+			cel.Variable("pods", cel.ListType(cel.ObjectType("v1.Pod"))),
+		)
+	})
+	return ruleEnv, ruleEnvErr
+}
+
+// compileRule parses and type-checks a rule, which must evaluate to a bool.
+func compileRule(rc RuleConfig) (*Rule, error) {
+	env, err := newRuleEnv()
+	if err != nil {
+		return nil, fmt.Errorf("create CEL environment: %w", err)
+	}
+	ast, issues := env.Compile(rc.Expression)
+	if issues != nil && issues.Err() != nil {
+		return nil, issues.Err()
+	}
+	if ast.OutputType() != cel.BoolType {
+		return nil, fmt.Errorf("expression must evaluate to a bool, not %s", ast.OutputType())
+	}
+	checked, err := cel.AstToCheckedExpr(ast)
+	if err != nil {
+		return nil, err
+	}
+	program, err := env.Program(ast, cel.CostLimit(ruleCostLimit))
+	if err != nil {
+		return nil, err
+	}
+
+	rule := &Rule{RuleConfig: rc, program: program}
+	if rule.Action == "" {
+		rule.Action = RuleActionRemediate
+	}
+	for _, ref := range checked.GetReferenceMap() {
+		if ref.GetName() == "pods" {
+			rule.usesPods = true
+		}
+	}
+	return rule, nil
+}
+
+// UsesPods reports whether the rule refers to the pods of the node, which must then be
+// listed before evaluating it.
+func (r *Rule) UsesPods() bool {
+	return r.usesPods
+}
+
+// Matches evaluates the rule against a node and the pods scheduled on it.
+func (r *Rule) Matches(node *v1.Node, pods []v1.Pod) (bool, error) {
+	if pods == nil {
+		pods = []v1.Pod{}
+	}
+	out, _, err := r.program.Eval(map[string]interface{}{"node": node, "pods": pods})
+	if err != nil {
+		return false, err
+	}
+	matched, ok := out.Value().(bool)
+	if !ok {
+		return false, fmt.Errorf("rule evaluated to %v, not a bool", out.Value())
+	}
+	return matched, nil
+}
+
+// validateRules compiles the rules of a policy, keeping the compiled rules for CompiledRules.
+func validateRules(p *PolicyConfig) error {
+	p.compiled = nil
+	seen := make(map[string]bool)
+	for i, rc := range p.Rules {
+		if rc.Name == "" {
+			return fmt.Errorf("rules[%d]: name cannot be empty", i)
+		}
+		if seen[rc.Name] {
+			return fmt.Errorf("rules[%d]: duplicate name %q", i, rc.Name)
+		}
+		seen[rc.Name] = true
+		if rc.Action != "" {
+			if err := validateOneOf(fmt.Sprintf("rules[%d].action", i), rc.Action, RuleActionRemediate, RuleActionSuppress, RuleActionIgnore); err != nil {
+				return err
+			}
+		}
+		for _, step := range rc.Ladder {
+			if err := validateOneOf(fmt.Sprintf("rules[%d]: recovery step", i), step, RecoverySteps...); err != nil {
+				return err
+			}
+		}
+		rule, err := compileRule(rc)
+		if err != nil {
+			return fmt.Errorf("rules[%d] (%s): %w", i, rc.Name, err)
+		}
+		p.compiled = append(p.compiled, rule)
+	}
+	return nil
+}
+
+// CompiledRules returns the rules of the policy, compiled when the configuration was
+// validated.
+func (p *PolicyConfig) CompiledRules() []*Rule {
+	return p.compiled
+}
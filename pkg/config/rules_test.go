@@ -0,0 +1,74 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestCompileRuleChecksFields(t *testing.T) {
+	tests := []struct {
+		expression string
+		wantErr    string // Substring of the error, empty when the rule compiles
+	}{
+		{expression: `node.status.conditions.exists(c, c.type == 'KernelDeadlock' && c.status == 'True')`},
+		{expression: `'role' in node.metadata.labels && node.metadata.labels['role'] == 'gpu'`},
+		{expression: `node.metadata.labels.role == 'gpu'`},
+		{expression: `has(node.spec.taints) && node.spec.taints.exists(t, t.effect == 'NoSchedule')`},
+		{expression: `node.status.nodeInfo.kubeletVersion.startsWith('v1.30')`},
+		{expression: `node.metadata.creationTimestamp.Time < timestamp('2026-01-01T00:00:00Z')`},
+		{expression: `node.spec.unschedulable || node.spec.taints.exists(t, t.key == 'node.kubernetes.io/unreachable')`},
+		{expression: `pods.exists(p, p.metadata.namespace == 'kube-system' && p.status.containerStatuses.exists(s, s.restartCount > 5))`},
+		{expression: `node.status.conditions.map(c, c.type).exists(x, x == 'Ready')`},
+		{expression: `node.status.conditons.exists(c, c.type == 'KernelDeadlock')`, wantErr: `undefined field 'conditons'`},
+		{expression: `node.status.conditions.exists(c, c.typ == 'KernelDeadlock')`, wantErr: `undefined field 'typ'`},
+		{expression: `has(node.spec.taint)`, wantErr: `undefined field 'taint'`},
+		{expression: `node['metadata'].name == 'a'`, wantErr: `no matching overload`},
+		{expression: `pods.all(p, p.spec.nodeNme != '')`, wantErr: `undefined field 'nodeNme'`},
+		{expression: `node.spec.unschedulable == 'true'`, wantErr: `no matching overload`},
+		{expression: `node.status.capacity.cpu == '4'`, wantErr: `no matching overload`},
+		{expression: `node.metadata.name`, wantErr: `must evaluate to a bool`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			_, err := compileRule(RuleConfig{Name: "test", Expression: tt.expression})
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("compileRule: %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("compileRule error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRuleMatches(t *testing.T) {
+	tainted := &v1.Node{Spec: v1.NodeSpec{Taints: []v1.Taint{{Key: "node.kubernetes.io/unreachable", Effect: v1.TaintEffectNoSchedule}}}}
+	crashing := []v1.Pod{{Status: v1.PodStatus{ContainerStatuses: []v1.ContainerStatus{{RestartCount: 10}}}}}
+	tests := []struct {
+		name       string
+		expression string
+		node       *v1.Node
+		pods       []v1.Pod
+		want       bool
+	}{
+		{name: "unset field", expression: `node.spec.taints.exists(t, t.effect == 'NoSchedule')`, node: &v1.Node{}, want: false},
+		{name: "set field", expression: `node.spec.taints.exists(t, t.effect == 'NoSchedule')`, node: tainted, want: true},
+		{name: "has unset field", expression: `has(node.spec.taints)`, node: &v1.Node{}, want: false},
+		{name: "no pods listed", expression: `pods.exists(p, p.status.containerStatuses.exists(s, s.restartCount > 5))`, node: tainted, want: false},
+		{name: "pods", expression: `pods.exists(p, p.status.containerStatuses.exists(s, s.restartCount > 5))`, node: tainted, pods: crashing, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := compileRule(RuleConfig{Name: "test", Expression: tt.expression})
+			if err != nil {
+				t.Fatalf("compileRule: %v", err)
+			}
+			got, err := rule.Matches(tt.node, tt.pods)
+			if err != nil || got != tt.want {
+				t.Errorf("Matches = %v, %v; want %v", got, err, tt.want)
+			}
+		})
+	}
+}
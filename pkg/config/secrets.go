@@ -0,0 +1,200 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// redacted replaces secret values wherever the configuration is logged or served.
+const redacted = "REDACTED"
+
+// secretSyncTimeout bounds the initial load of the credentials Secret. Listing a Secret the
+// service account may not read is retried forever, so startup would hang without it.
+const secretSyncTimeout = 30 * time.Second
+
+// Keys of the credentials Secret; they match the JSON names of the corresponding settings.
+const (
+	secretHarvesterKey    = "harvesterKey"
+	secretRancherKey      = "rancherKey"
+	secretRancherToken    = "rancherToken"
+	secretRedfishPassword = "redfishPassword"
+	secretAdminToken      = "adminToken"
+)
+
+var (
+	secretsMu       sync.RWMutex
+	secretsFromFile = map[string]string{}
+	secretsFromK8s  = map[string]string{}
+)
+
+// HarvesterKey returns the current Harvester API key.
+func HarvesterKey() string { return secretValue(secretHarvesterKey, Get().HarvesterKey) }
+
+// RancherKey returns the current Rancher access/secret key pair.
+func RancherKey() string { return secretValue(secretRancherKey, Get().RancherKey) }
+
+// RancherToken returns the current Rancher bearer token.
+func RancherToken() string { return secretValue(secretRancherToken, Get().RancherToken) }
+
+// RedfishPassword returns the current default BMC password.
+func RedfishPassword() string { return secretValue(secretRedfishPassword, Get().RedfishPassword) }
+
+// AdminToken returns the current bearer token of the admin API.
+func AdminToken() string { return secretValue(secretAdminToken, Get().AdminToken) }
+
+// secretValue returns a credential from the credentials Secret, then from its *_FILE,
+// then from the plain setting.
+func secretValue(key, fallback string) string {
+	secretsMu.RLock()
+	defer secretsMu.RUnlock()
+
+	if value := secretsFromK8s[key]; value != "" {
+		return value
+	}
+	if value := secretsFromFile[key]; value != "" {
+		return value
+	}
+	return fallback
+}
+
+// hasSecret reports whether a credential may be provided by any source.
+func (cfg *AppConfig) hasSecret(value, file string) bool {
+	return value != "" || file != "" || cfg.CredentialsSecret != ""
+}
+
+// Redacted returns a copy of the configuration with all credentials replaced.
+func (cfg AppConfig) Redacted() AppConfig {
+	for _, field := range []*string{&cfg.HarvesterKey, &cfg.RancherKey, &cfg.RancherToken, &cfg.RedfishPassword, &cfg.AdminToken} {
+		if *field != "" {
+			*field = redacted
+		}
+	}
+	return cfg
+}
+
+// String returns the redacted configuration as JSON, so it is safe to log with %v.
+func (cfg AppConfig) String() string {
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return fmt.Sprintf("<invalid configuration: %v>", err)
+	}
+	return string(data)
+}
+
+// LoadSecretFiles reads the credentials referenced by the *_FILE settings. It reports
+// whether any credential changed since the previous call.
+func LoadSecretFiles() (bool, error) {
+	cfg := Get()
+	files := map[string]string{
+		secretHarvesterKey:    cfg.HarvesterKeyFile,
+		secretRancherKey:      cfg.RancherKeyFile,
+		secretRancherToken:    cfg.RancherTokenFile,
+		secretRedfishPassword: cfg.RedfishPasswordFile,
+		secretAdminToken:      cfg.AdminTokenFile,
+	}
+
+	values := make(map[string]string)
+	for key, path := range files {
+		if path == "" {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return false, fmt.Errorf("read %s file: %w", key, err)
+		}
+		values[key] = strings.TrimSpace(string(data))
+	}
+	return storeSecrets(&secretsFromFile, values), nil
+}
+
+// WatchSecretFiles re-reads the credential files every interval so that rotated files, such
+// as a remounted Secret volume, are picked up. onRotate is called when a credential changed
+// or could not be read. It blocks until ctx is cancelled.
+func WatchSecretFiles(ctx context.Context, interval time.Duration, onRotate func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			changed, err := LoadSecretFiles()
+			if err != nil || changed {
+				onRotate(err)
+			}
+		}
+	}
+}
+
+// WatchCredentialsSecret loads the credentials from the Secret referenced by
+// CredentialsSecret ("namespace/name") and keeps them current as the Secret is rotated.
+// It returns once the Secret has been loaded, or with an error when it cannot be loaded
+// within secretSyncTimeout, and keeps watching in the background until ctx is cancelled.
+func WatchCredentialsSecret(ctx context.Context, clientset kubernetes.Interface, onRotate func(error)) error {
+	ref := Get().CredentialsSecret
+	namespace, name, found := strings.Cut(ref, "/")
+	if !found {
+		return fmt.Errorf("credentialsSecret %q must be in namespace/name form", ref)
+	}
+
+	handle := func(obj interface{}) {
+		secret, ok := obj.(*v1.Secret)
+		if !ok {
+			return
+		}
+		values := make(map[string]string)
+		for _, key := range []string{secretHarvesterKey, secretRancherKey, secretRancherToken, secretRedfishPassword, secretAdminToken} {
+			if value := strings.TrimSpace(string(secret.Data[key])); value != "" {
+				values[key] = value
+			}
+		}
+		if storeSecrets(&secretsFromK8s, values) {
+			onRotate(nil)
+		}
+	}
+
+	listWatch := cache.NewListWatchFromClient(clientset.CoreV1().RESTClient(), "secrets", namespace, fields.OneTermEqualSelector("metadata.name", name))
+	_, informer := cache.NewInformer(listWatch, &v1.Secret{}, 0, cache.ResourceEventHandlerFuncs{
+		AddFunc:    handle,
+		UpdateFunc: func(_, newObj interface{}) { handle(newObj) },
+		DeleteFunc: func(interface{}) {
+			if storeSecrets(&secretsFromK8s, map[string]string{}) {
+				onRotate(fmt.Errorf("credentials secret %s was deleted", ref))
+			}
+		},
+	})
+	go informer.Run(ctx.Done())
+
+	syncCtx, cancel := context.WithTimeout(ctx, secretSyncTimeout)
+	defer cancel()
+	if !cache.WaitForCacheSync(syncCtx.Done(), informer.HasSynced) {
+		return fmt.Errorf("credentials secret %s not loaded within %s: check that it exists and that the service account may get, list and watch it", ref, secretSyncTimeout)
+	}
+	return nil
+}
+
+// storeSecrets replaces a set of loaded credentials and reports whether it changed.
+func storeSecrets(target *map[string]string, values map[string]string) bool {
+	secretsMu.Lock()
+	defer secretsMu.Unlock()
+
+	changed := len(values) != len(*target)
+	for key, value := range values {
+		if (*target)[key] != value {
+			changed = true
+		}
+	}
+	*target = values
+	return changed
+}
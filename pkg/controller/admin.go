@@ -0,0 +1,244 @@
+package controller
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/supporttools/k8s-node-killer/pkg/config"
+	"github.com/supporttools/k8s-node-killer/pkg/health"
+	"github.com/supporttools/k8s-node-killer/pkg/metrics"
+	"github.com/supporttools/k8s-node-killer/pkg/recovery"
+)
+
+// AdminResult is the response of every admin API call.
+type AdminResult struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Action     string `json:"action"`
+	Cluster    string `json:"cluster,omitempty"`
+	Node       string `json:"node,omitempty"`
+	Message    string `json:"message"`
+}
+
+// AdminAPI serves the authenticated operator endpoints under /api/v1/admin. Every call is
+// recorded in the recovery state and as a Kubernetes Event.
+type AdminAPI struct {
+	recorder record.EventRecorder // Records controller-wide actions against the controller's Pod
+	self     *v1.ObjectReference
+}
+
+// NewAdminAPI creates the admin API. home is a clientset for the cluster the controller runs
+// in; when it is nil or the Pod is unknown, controller-wide actions are only logged.
+func NewAdminAPI(home kubernetes.Interface) *AdminAPI {
+	cfg := config.Get()
+	api := &AdminAPI{}
+	if home != nil && cfg.PodName != "" && cfg.PodNamespace != "" {
+		api.recorder, _ = newEventRecorder(home) // Lives as long as the process
+		api.self = &v1.ObjectReference{Kind: "Pod", Namespace: cfg.PodNamespace, Name: cfg.PodName}
+	}
+	return api
+}
+
+// Register registers the admin endpoints on the given mux.
+func (a *AdminAPI) Register(mux *http.ServeMux) {
+	mux.Handle("POST /api/v1/admin/pause", a.authenticated(a.setControllerPaused(true)))
+	mux.Handle("POST /api/v1/admin/resume", a.authenticated(a.setControllerPaused(false)))
+	mux.Handle("POST /api/v1/admin/nodes/{name}/pause", a.authenticated(a.setNodePaused(true)))
+	mux.Handle("POST /api/v1/admin/nodes/{name}/resume", a.authenticated(a.setNodePaused(false)))
+	mux.Handle("POST /api/v1/admin/nodes/{name}/steps/{step}", a.authenticated(http.HandlerFunc(a.triggerStep)))
+	mux.Handle("POST /api/v1/admin/nodes/{name}/skip", a.authenticated(http.HandlerFunc(a.skipStep)))
+	mux.Handle("DELETE /api/v1/admin/nodes/{name}", a.authenticated(http.HandlerFunc(a.clearState)))
+}
+
+// authenticated rejects requests without the configured admin bearer token. The admin API
+// is disabled while no token is configured.
+func (a *AdminAPI) authenticated(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := config.AdminToken()
+		if token == "" {
+			health.WriteAPIError(w, http.StatusForbidden, "admin API is disabled, configure adminToken to enable it")
+			return
+		}
+		provided, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			health.WriteAPIError(w, http.StatusUnauthorized, "missing or invalid admin token")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// setControllerPaused pauses or resumes remediation of every node in every cluster.
+func (a *AdminAPI) setControllerPaused(paused bool) http.Handler {
+	action, reason, message := "resume_controller", "OperatorResumed", "Remediation resumed by an operator"
+	if paused {
+		action, reason, message = "pause_controller", "OperatorPaused", "Remediation paused by an operator"
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		health.SetControllerPaused(paused)
+		metrics.RemediationPaused.WithLabelValues("admin").Set(boolToFloat(paused))
+		health.RecordAction("", "", action, "", r.RemoteAddr)
+		logger.Warnf("%s (from %s).", message, r.RemoteAddr)
+		if a.recorder != nil {
+			a.recorder.Event(a.self, v1.EventTypeWarning, reason, message)
+		}
+		health.WriteJSON(w, http.StatusOK, AdminResult{APIVersion: health.APIVersion, Kind: "AdminResult", Action: action, Message: message})
+	})
+}
+
+// setNodePaused pauses or resumes remediation of a single node.
+func (a *AdminAPI) setNodePaused(paused bool) http.Handler {
+	action, reason, verb := "resume", "OperatorResumed", "resumed"
+	if paused {
+		action, reason, verb = "pause", "OperatorPaused", "paused"
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, ok := resolveController(w, r)
+		if !ok {
+			return
+		}
+		name := r.PathValue("name")
+		health.SetNodePaused(c.cluster, name, paused)
+		c.recordAdminAction(r, name, action, reason, "", fmt.Sprintf("Remediation of node %s %s by an operator", name, verb))
+		writeAdminResult(w, http.StatusOK, c, name, action, fmt.Sprintf("Remediation of node %s %s", name, verb))
+	})
+}
+
+// triggerStep runs a named recovery step against a node in the background.
+func (a *AdminAPI) triggerStep(w http.ResponseWriter, r *http.Request) {
+	name, step := r.PathValue("name"), r.PathValue("step")
+	if !recovery.IsKnownStep(step) {
+		health.WriteAPIError(w, http.StatusBadRequest, fmt.Sprintf("unknown recovery step %q", step))
+		return
+	}
+	if engaged, source := health.KillSwitch(); engaged {
+		health.WriteAPIError(w, http.StatusConflict, fmt.Sprintf("the kill switch is engaged by %s", source))
+		return
+	}
+	if recovery.Draining() {
+		health.WriteAPIError(w, http.StatusServiceUnavailable, "the controller is shutting down")
+		return
+	}
+	c, ok := resolveController(w, r)
+	if !ok {
+		return
+	}
+
+	node, err := c.clientset.CoreV1().Nodes().Get(r.Context(), name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		health.WriteAPIError(w, http.StatusNotFound, fmt.Sprintf("node %s not found in cluster %s", name, c.cluster))
+		return
+	} else if err != nil {
+		health.WriteAPIError(w, http.StatusBadGateway, fmt.Sprintf("get node %s: %v", name, err))
+		return
+	}
+
+	nodeMutex := c.getNodeMutex(name)
+	if !nodeMutex.TryLock() {
+		health.WriteAPIError(w, http.StatusConflict, fmt.Sprintf("node %s is being remediated, skip the running step first", name))
+		return
+	}
+	c.recordAdminAction(r, name, "trigger_step", "OperatorTriggeredStep", step, fmt.Sprintf("Recovery step %s triggered on node %s by an operator", step, name))
+
+	go func() {
+		defer c.releaseNode(name, nodeMutex)
+		if err := recovery.RunStep(c.ctx, c.clientset, node, step); err != nil {
+			logger.Errorf("Operator-triggered step '%s' on node %s failed: %v", step, name, err)
+		}
+	}()
+	writeAdminResult(w, http.StatusAccepted, c, name, "trigger_step", fmt.Sprintf("Recovery step %s started on node %s", step, name))
+}
+
+// skipStep abandons the step running on a node so the ladder moves on to the next rung.
+func (a *AdminAPI) skipStep(w http.ResponseWriter, r *http.Request) {
+	c, ok := resolveController(w, r)
+	if !ok {
+		return
+	}
+	name := r.PathValue("name")
+	if !recovery.SkipStep(c.cluster, name) {
+		health.WriteAPIError(w, http.StatusConflict, fmt.Sprintf("no recovery step is running on node %s", name))
+		return
+	}
+	c.recordAdminAction(r, name, "skip_step", "OperatorSkippedStep", "", fmt.Sprintf("Running recovery step on node %s skipped by an operator", name))
+	writeAdminResult(w, http.StatusOK, c, name, "skip_step", fmt.Sprintf("Running recovery step on node %s skipped", name))
+}
+
+// clearState forgets the recorded status and attempt history of a node.
+func (a *AdminAPI) clearState(w http.ResponseWriter, r *http.Request) {
+	c, ok := resolveController(w, r)
+	if !ok {
+		return
+	}
+	name := r.PathValue("name")
+	if !health.ClearNodeState(c.cluster, name) {
+		health.WriteAPIError(w, http.StatusNotFound, fmt.Sprintf("no state recorded for node %s in cluster %s", name, c.cluster))
+		return
+	}
+	c.recordAdminAction(r, name, "clear_state", "OperatorClearedState", "", fmt.Sprintf("Recovery state of node %s cleared by an operator", name))
+	writeAdminResult(w, http.StatusOK, c, name, "clear_state", fmt.Sprintf("Recovery state of node %s cleared", name))
+}
+
+// recordAdminAction records an admin call against a node in the recovery state and as a
+// Kubernetes Event on the node.
+func (c *Controller) recordAdminAction(r *http.Request, nodeName, action, reason, detail, message string) {
+	health.RecordAction(c.cluster, nodeName, action, detail, r.RemoteAddr)
+	logger.Warnf("%s in cluster %s (from %s).", message, c.cluster, r.RemoteAddr)
+	c.recorder.Event(nodeReference(nodeName), v1.EventTypeWarning, reason, message)
+}
+
+// resolveController returns the controller of the cluster named by the cluster query
+// parameter, which may be omitted when a single cluster is managed.
+func resolveController(w http.ResponseWriter, r *http.Request) (*Controller, bool) {
+	controllersMu.RLock()
+	defer controllersMu.RUnlock()
+
+	if cluster := r.URL.Query().Get("cluster"); cluster != "" {
+		c, ok := controllers[cluster]
+		if !ok {
+			health.WriteAPIError(w, http.StatusNotFound, fmt.Sprintf("cluster %s is not managed", cluster))
+		}
+		return c, ok
+	}
+	if len(controllers) == 0 {
+		health.WriteAPIError(w, http.StatusServiceUnavailable, "no cluster is managed yet")
+		return nil, false
+	}
+	if len(controllers) > 1 {
+		health.WriteAPIError(w, http.StatusBadRequest, "the cluster query parameter is required when several clusters are managed")
+		return nil, false
+	}
+	for _, c := range controllers {
+		return c, true
+	}
+	return nil, false
+}
+
+func writeAdminResult(w http.ResponseWriter, status int, c *Controller, nodeName, action, message string) {
+	health.WriteJSON(w, status, AdminResult{
+		APIVersion: health.APIVersion,
+		Kind:       "AdminResult",
+		Action:     action,
+		Cluster:    c.cluster,
+		Node:       nodeName,
+		Message:    message,
+	})
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,68 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/supporttools/k8s-node-killer/pkg/config"
+	"github.com/supporttools/k8s-node-killer/pkg/health"
+	"github.com/supporttools/k8s-node-killer/pkg/recovery"
+)
+
+// livenessScanIntervals is how many rescan intervals may pass without a completed scan
+// before the controller is considered wedged.
+const livenessScanIntervals = 3
+
+// addHealthChecks registers the readiness and liveness checks of the controller and
+// returns their names:
+//   - informer: the node informer cache has synced
+//   - apiserver: the cluster's API server answers, which fails when the credentials died
+//   - scan: the workers evaluated every node of a rescan within a few rescan intervals, and
+//     a queued node within as long; remediations run apart from the workers, and their
+//     steps wait no longer than the recovery wait and the replacement timeout, so a step
+//     running longer means the recovery loop is wedged
+//
+// The informer and apiserver checks of downstream clusters are cluster checks, reported by
+// /readyz without failing it.
+func (c *Controller) addHealthChecks(informer cache.SharedIndexInformer) []string {
+	informerCheck := "informer:" + c.cluster
+	apiServerCheck := "apiserver:" + c.cluster
+	scanCheck := "scan:" + c.cluster
+
+	addCheck := health.AddReadinessCheck
+	if c.downstream {
+		addCheck = health.AddClusterCheck
+	}
+	addCheck(informerCheck, func(context.Context) error {
+		if !informer.HasSynced() {
+			return fmt.Errorf("node informer of cluster %s has not synced", c.cluster)
+		}
+		return nil
+	})
+	addCheck(apiServerCheck, func(ctx context.Context) error {
+		if err := c.clientset.Discovery().RESTClient().Get().AbsPath("/version").Do(ctx).Error(); err != nil {
+			return fmt.Errorf("API server of cluster %s unreachable: %w", c.cluster, err)
+		}
+		return nil
+	})
+	health.AddLivenessCheck(scanCheck, func(context.Context) error {
+		cfg := config.Get()
+		limit := livenessScanIntervals * cfg.RescanInterval
+		stepLimit := time.Duration(cfg.RecoveryWaitTimeMinutes)*time.Minute + cfg.ReplacementTimeout + limit
+		if node, running := recovery.LongestRunningStep(c.cluster); running > stepLimit {
+			return fmt.Errorf("recovery step on node %s of cluster %s running for %s", node, c.cluster, running.Round(time.Second))
+		}
+		if since := time.Since(time.Unix(0, c.lastScan.Load())); since > limit {
+			return fmt.Errorf("no rescan of cluster %s completed in %s", c.cluster, since.Round(time.Second))
+		}
+		since := time.Since(time.Unix(0, c.lastEvaluation.Load()))
+		if c.queue.Len() > 0 && since > limit {
+			return fmt.Errorf("%d nodes of cluster %s queued but none evaluated in %s", c.queue.Len(), c.cluster, since.Round(time.Second))
+		}
+		return nil
+	})
+	return []string{informerCheck, apiServerCheck, scanCheck}
+}
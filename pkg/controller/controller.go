@@ -0,0 +1,303 @@
+package controller
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
+
+	"github.com/supporttools/k8s-node-killer/pkg/config"
+	"github.com/supporttools/k8s-node-killer/pkg/health"
+	"github.com/supporttools/k8s-node-killer/pkg/logging"
+	"github.com/supporttools/k8s-node-killer/pkg/metrics"
+	"github.com/supporttools/k8s-node-killer/pkg/policy"
+	"github.com/supporttools/k8s-node-killer/pkg/recovery"
+)
+
+var logger = logging.SetupLogging()
+
+// Controller watches the nodes of a single cluster and runs recovery on them.
+type Controller struct {
+	cluster      string
+	downstream   bool // Managed in multi-cluster mode, see addHealthChecks
+	clientset    kubernetes.Interface
+	recorder     record.EventRecorder
+	events       record.EventBroadcaster
+	stopEvents   sync.Once
+	ctx          context.Context        // Set by Run, used by admin actions
+	nodeLocks    map[string]*sync.Mutex // Held while a node is remediated or stepped by an operator
+	mutexMapLock sync.Mutex             // Protects access to the nodeLocks map
+	queue        workqueue.Interface    // Keys of the nodes waiting to be evaluated
+
+	evaluateNode func(context.Context, kubernetes.Interface, *v1.Node) func() // recovery.Evaluate
+	remediations sync.WaitGroup                                               // Remediations started by the workers
+
+	scanMu      sync.Mutex
+	scanPending map[string]bool // Keys of the running scan not evaluated yet
+	scanStart   time.Time       // Start of the running scan
+
+	lastScan       atomic.Int64 // Unix nanoseconds of the last scan whose nodes were all evaluated
+	lastEvaluation atomic.Int64 // Unix nanoseconds of the last node evaluation that returned
+}
+
+var (
+	controllersMu sync.RWMutex
+	controllers   = make(map[string]*Controller) // Running controllers, keyed by cluster
+)
+
+// New creates a controller for the named cluster.
+func New(cluster string, clientset kubernetes.Interface) *Controller {
+	recorder, events := newEventRecorder(clientset)
+	return &Controller{
+		cluster:      cluster,
+		clientset:    clientset,
+		recorder:     recorder,
+		events:       events,
+		nodeLocks:    make(map[string]*sync.Mutex),
+		queue:        workqueue.NewWithConfig(workqueue.QueueConfig{Name: "nodes-" + cluster}),
+		evaluateNode: recovery.Evaluate,
+	}
+}
+
+// shutdownEvents stops the Event broadcaster of the controller. Events recorded afterwards
+// are dropped.
+func (c *Controller) shutdownEvents() {
+	c.stopEvents.Do(func() {
+		if c.events != nil {
+			c.events.Shutdown()
+		}
+	})
+}
+
+func (c *Controller) getNodeMutex(nodeName string) *sync.Mutex {
+	c.mutexMapLock.Lock()
+	defer c.mutexMapLock.Unlock()
+
+	if lock, exists := c.nodeLocks[nodeName]; exists {
+		return lock
+	}
+	c.nodeLocks[nodeName] = &sync.Mutex{}
+	return c.nodeLocks[nodeName]
+}
+
+// rescanJitter spreads the rescans of the clusters so they do not all hit the API at once.
+const rescanJitter = 0.1
+
+// scanNodes queues every node known to the informer for evaluation. The scan completes once
+// the workers evaluated all of them, see scanEvaluated. When the previous scan has not
+// completed yet, its remaining nodes are carried over and its start is kept.
+func (c *Controller) scanNodes(store cache.Store) {
+	keys := store.ListKeys()
+	c.scanMu.Lock()
+	if c.scanPending == nil {
+		c.scanPending = make(map[string]bool, len(keys))
+		c.scanStart = time.Now()
+	}
+	for _, key := range keys {
+		c.scanPending[key] = true
+	}
+	if len(c.scanPending) == 0 {
+		c.completeScan()
+	}
+	c.scanMu.Unlock()
+
+	for _, key := range keys {
+		c.queue.Add(key)
+	}
+	logger.Debugf("Queued %d nodes of cluster %s for evaluation.", len(keys), c.cluster)
+}
+
+// scanEvaluated records that the workers evaluated the node with the given key, completing
+// the running scan if it was the last one pending.
+func (c *Controller) scanEvaluated(key string) {
+	c.scanMu.Lock()
+	defer c.scanMu.Unlock()
+	if !c.scanPending[key] {
+		return
+	}
+	delete(c.scanPending, key)
+	if len(c.scanPending) == 0 {
+		c.completeScan()
+	}
+}
+
+// completeScan records the completion of the running scan. The caller must hold c.scanMu.
+func (c *Controller) completeScan() {
+	c.lastScan.Store(time.Now().UnixNano())
+	metrics.ScanDuration.WithLabelValues(c.cluster).Observe(time.Since(c.scanStart).Seconds())
+	c.scanPending = nil
+}
+
+// rescan queues every node for evaluation every rescan interval, with jitter, until ctx is
+// cancelled. The interval is read again after every scan, so reloads apply.
+func (c *Controller) rescan(ctx context.Context, store cache.Store) {
+	for {
+		timer := time.NewTimer(wait.Jitter(config.Get().RescanInterval, rescanJitter))
+		select {
+		case <-timer.C:
+			c.scanNodes(store)
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// runWorker evaluates queued nodes until the queue is shut down.
+func (c *Controller) runWorker(ctx context.Context, store cache.Store) {
+	for {
+		item, shutdown := c.queue.Get()
+		if shutdown {
+			return
+		}
+		c.evaluate(ctx, store, item.(string))
+		c.scanEvaluated(item.(string))
+		c.queue.Done(item)
+	}
+}
+
+// evaluate decides on a queued node, or forgets it when it no longer exists. A remediation
+// runs in its own goroutine, so the workers only decide; the remediations are bounded by the
+// budgets. A node being remediated or stepped by an operator is skipped and queued again
+// once that returned.
+func (c *Controller) evaluate(ctx context.Context, store cache.Store, key string) {
+	defer c.lastEvaluation.Store(time.Now().UnixNano())
+
+	obj, exists, err := store.GetByKey(key)
+	if err != nil {
+		return
+	}
+	nodeMutex := c.getNodeMutex(key)
+	if !nodeMutex.TryLock() {
+		return
+	}
+	if !exists {
+		c.forgetNode(key)
+		return
+	}
+	node := obj.(*v1.Node)
+	metrics.NodesEvaluated.WithLabelValues(c.cluster).Inc()
+
+	remediate := c.evaluateNode(ctx, c.clientset, node)
+	if remediate == nil {
+		nodeMutex.Unlock()
+		return
+	}
+	c.remediations.Add(1)
+	go func() {
+		defer c.remediations.Done()
+		remediate()
+		c.releaseNode(key, nodeMutex)
+	}()
+}
+
+// releaseNode unlocks a node after a remediation or an operator-triggered step, and queues
+// it for evaluation again.
+func (c *Controller) releaseNode(key string, nodeMutex *sync.Mutex) {
+	nodeMutex.Unlock()
+	c.queue.Add(key)
+}
+
+// enqueue queues a node received from the informer for evaluation.
+func (c *Controller) enqueue(obj interface{}) {
+	key, err := cache.MetaNamespaceKeyFunc(obj)
+	if err != nil {
+		logger.Errorf("Failed to queue node of cluster %s: %v", c.cluster, err)
+		return
+	}
+	c.queue.Add(key)
+}
+
+// enqueueDeleted queues a node deleted from the informer, so a worker forgets it once any
+// remediation still running on it returned and queued it again. A deletion missed while the
+// watch was down arrives as a tombstone.
+func (c *Controller) enqueueDeleted(obj interface{}) {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		logger.Errorf("Failed to queue deleted node of cluster %s: %v", c.cluster, err)
+		return
+	}
+	c.queue.Add(key)
+}
+
+// forgetNode drops the lock, state and latest decision of a deleted node.
+func (c *Controller) forgetNode(nodeName string) {
+	c.mutexMapLock.Lock()
+	delete(c.nodeLocks, nodeName)
+	c.mutexMapLock.Unlock()
+	health.ForgetNode(c.cluster, nodeName)
+	policy.ForgetNode(c.cluster, nodeName)
+}
+
+// Run starts the node informer, the workers evaluating nodes and the periodic rescan, and
+// blocks until ctx is cancelled.
+func (c *Controller) Run(ctx context.Context) {
+	cfg := config.FromContext(ctx)
+	ctx = health.WithCluster(ctx, c.cluster)
+	ctx = logging.WithField(ctx, logging.FieldCluster, c.cluster)
+	logger.Infof("Starting controller for cluster %s...", c.cluster)
+
+	c.ctx = ctx
+	controllersMu.Lock()
+	controllers[c.cluster] = c
+	controllersMu.Unlock()
+	defer func() {
+		controllersMu.Lock()
+		delete(controllers, c.cluster)
+		controllersMu.Unlock()
+	}()
+
+	nodeInformer := cache.NewSharedIndexInformer(
+		&cache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				return c.clientset.CoreV1().Nodes().List(ctx, options)
+			},
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				return c.clientset.CoreV1().Nodes().Watch(ctx, options)
+			},
+		},
+		&v1.Node{},
+		cfg.InformerResync,
+		cache.Indexers{},
+	)
+
+	// The informer lists every node on start, which queues them all for a first evaluation.
+	nodeInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    c.enqueue,
+		UpdateFunc: func(_, newObj interface{}) { c.enqueue(newObj) },
+		DeleteFunc: c.enqueueDeleted,
+	})
+
+	go nodeInformer.Run(ctx.Done())
+
+	now := time.Now().UnixNano()
+	c.lastScan.Store(now)
+	c.lastEvaluation.Store(now)
+	defer health.RemoveChecks(c.addHealthChecks(nodeInformer)...)
+
+	var workers sync.WaitGroup
+	for i := 0; i < cfg.Workers; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			c.runWorker(ctx, nodeInformer.GetStore())
+		}()
+	}
+
+	c.rescan(ctx, nodeInformer.GetStore())
+	c.queue.ShutDown()
+	workers.Wait()
+	c.remediations.Wait()
+	c.shutdownEvents()
+	logger.Infof("Stopped controller for cluster %s.", c.cluster)
+}
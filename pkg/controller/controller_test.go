@@ -0,0 +1,234 @@
+package controller
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/supporttools/k8s-node-killer/pkg/config"
+	"github.com/supporttools/k8s-node-killer/pkg/health"
+	"github.com/supporttools/k8s-node-killer/pkg/metrics"
+	"github.com/supporttools/k8s-node-killer/pkg/policy"
+)
+
+func newTestController(t *testing.T) *Controller {
+	t.Helper()
+	c := &Controller{cluster: "test", nodeLocks: make(map[string]*sync.Mutex), queue: workqueue.New()}
+	t.Cleanup(c.queue.ShutDown)
+	return c
+}
+
+func testNode(name string) *v1.Node {
+	return &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: name}}
+}
+
+func TestScanCompletesOnceEveryNodeIsEvaluated(t *testing.T) {
+	c := newTestController(t)
+	store := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	for _, name := range []string{"a", "b"} {
+		store.Add(testNode(name))
+	}
+
+	c.scanNodes(store)
+	if c.lastScan.Load() != 0 {
+		t.Fatal("scan completed when its nodes were only queued")
+	}
+	if c.queue.Len() != 2 {
+		t.Fatalf("queued %d nodes, want 2", c.queue.Len())
+	}
+
+	c.scanEvaluated("a")
+	c.scanNodes(store) // Carries b over, a is pending again
+	c.scanEvaluated("b")
+	if c.lastScan.Load() != 0 {
+		t.Fatal("scan completed with a node pending")
+	}
+	start := time.Now()
+	c.scanEvaluated("a")
+	if c.lastScan.Load() < start.UnixNano() {
+		t.Fatal("scan not completed after every node was evaluated")
+	}
+	if n := testutil.CollectAndCount(metrics.ScanDuration); n != 1 {
+		t.Errorf("scan duration observed for %d clusters, want 1", n)
+	}
+
+	// Nodes evaluated outside of a scan do not complete one.
+	c.lastScan.Store(0)
+	c.scanEvaluated("a")
+	if c.lastScan.Load() != 0 {
+		t.Error("an evaluation outside of a scan completed one")
+	}
+}
+
+func TestDeletedNodesAreForgotten(t *testing.T) {
+	c := newTestController(t)
+	t.Cleanup(func() { health.ForgetCluster(c.cluster); policy.ForgetCluster(c.cluster) })
+	store := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	store.Add(testNode("kept"))
+	for _, name := range []string{"kept", "deleted", "missed"} {
+		c.getNodeMutex(name)
+		health.Transition(c.cluster, name, health.StatusHealthy, "")
+		policy.Record(policy.Decision{Cluster: c.cluster, NodeName: name})
+	}
+
+	// A deletion missed while the watch was down arrives as a tombstone.
+	c.enqueueDeleted(testNode("deleted"))
+	c.enqueueDeleted(cache.DeletedFinalStateUnknown{Key: "missed", Obj: testNode("missed")})
+	if c.queue.Len() != 2 {
+		t.Fatalf("queued %d deleted nodes, want 2", c.queue.Len())
+	}
+	for c.queue.Len() > 0 {
+		key, _ := c.queue.Get()
+		c.evaluate(context.Background(), store, key.(string))
+		c.queue.Done(key)
+	}
+
+	for _, name := range []string{"deleted", "missed"} {
+		if _, ok := c.nodeLocks[name]; ok {
+			t.Errorf("lock of node %s kept", name)
+		}
+		if _, ok := health.GetNodeState(c.cluster, name); ok {
+			t.Errorf("state of node %s kept", name)
+		}
+	}
+	if len(policy.ListDecisions()) != 1 {
+		t.Errorf("decisions = %+v, want only the one of the node kept", policy.ListDecisions())
+	}
+	if _, ok := health.GetNodeState(c.cluster, "kept"); !ok {
+		t.Error("state of a node still in the store dropped")
+	}
+}
+
+func TestBlockedRemediationDoesNotHoldUpEvaluation(t *testing.T) {
+	c := newTestController(t)
+	store := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	store.Add(testNode("stuck"))
+	store.Add(testNode("other"))
+
+	evaluated := make(chan string, 10)
+	release := make(chan struct{})
+	remediated := false
+	c.evaluateNode = func(_ context.Context, _ kubernetes.Interface, node *v1.Node) func() {
+		evaluated <- node.Name
+		if node.Name != "stuck" || remediated {
+			return nil
+		}
+		remediated = true
+		return func() { <-release }
+	}
+	expect := func(want string) {
+		t.Helper()
+		select {
+		case name := <-evaluated:
+			if name != want {
+				t.Fatalf("evaluated %s, want %s", name, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s not evaluated", want)
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.runWorker(context.Background(), store) // A single worker
+	}()
+	c.queue.Add("stuck")
+	expect("stuck")
+	c.queue.Add("other")
+	expect("other")
+
+	// A node being remediated is skipped, and evaluated again once the remediation returned.
+	c.queue.Add("stuck")
+	c.queue.Add("other")
+	expect("other")
+	close(release)
+	expect("stuck")
+
+	c.queue.ShutDown()
+	<-done
+	c.remediations.Wait()
+}
+
+func TestForgetClusterStopsEvents(t *testing.T) {
+	c := newTestController(t)
+	c.recorder, c.events = newEventRecorder(fake.NewSimpleClientset())
+	managed := &managedCluster{controller: c, cancel: func() {}, done: make(chan struct{})}
+	close(managed.done)
+
+	forgetCluster(managed)
+	c.shutdownEvents() // Run's teardown after the cluster was forgotten
+	c.recorder.Event(nodeReference("node-1"), v1.EventTypeNormal, "Test", "dropped after the shutdown")
+}
+
+func TestLeaderElectionRunsOneInstance(t *testing.T) {
+	leaseDuration, renewDeadline, retryPeriod = time.Second, 500*time.Millisecond, 100*time.Millisecond // Leases count whole seconds
+	defer func() {
+		leaseDuration, renewDeadline, retryPeriod = 15*time.Second, 10*time.Second, 2*time.Second
+	}()
+	home := fake.NewSimpleClientset()
+
+	leading := make(chan string, 2)
+	campaign := func(name string) (context.CancelFunc, <-chan struct{}) {
+		cfg, err := config.Load([]byte("authMode: kubeconfig\nharvesterKey: key\nrancherToken: token\nleaderElection: true\npodNamespace: test\npodName: " + name + "\n"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctx, cancel := context.WithCancel(config.WithSnapshot(context.Background(), &cfg))
+		stopped := make(chan struct{})
+		go func() {
+			defer close(stopped)
+			if err := RunLeaderElection(ctx, home, func(ctx context.Context) {
+				leading <- name
+				<-ctx.Done()
+			}); err != nil {
+				t.Error(err)
+			}
+		}()
+		return cancel, stopped
+	}
+
+	cancelA, stoppedA := campaign("a")
+	select {
+	case name := <-leading:
+		if name != "a" {
+			t.Fatalf("%s leads, want a", name)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no instance leads")
+	}
+	if !health.Leader() {
+		t.Error("leader not reported")
+	}
+
+	cancelB, stoppedB := campaign("b")
+	defer func() {
+		cancelB()
+		<-stoppedB
+	}()
+	select {
+	case name := <-leading:
+		t.Fatalf("%s leads while a holds the lease", name)
+	case <-time.After(2 * leaseDuration):
+	}
+
+	cancelA()
+	<-stoppedA
+	select {
+	case name := <-leading:
+		if name != "b" {
+			t.Fatalf("%s leads, want b", name)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("b did not take over the released lease")
+	}
+}
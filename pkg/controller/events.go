@@ -0,0 +1,27 @@
+package controller
+
+import (
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+// eventComponent is the source component of the Kubernetes Events recorded by the controller.
+const eventComponent = "k8s-node-killer"
+
+// newEventRecorder returns a recorder that writes Events to the cluster of the clientset, and
+// its broadcaster, whose goroutines run until it is shut down.
+func newEventRecorder(clientset kubernetes.Interface) (record.EventRecorder, record.EventBroadcaster) {
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: clientset.CoreV1().Events("")})
+	return broadcaster.NewRecorder(scheme.Scheme, v1.EventSource{Component: eventComponent}), broadcaster
+}
+
+// nodeReference returns the object reference used for Events about a node. Like the
+// kubelet, it uses the node name as UID so the Events show up in kubectl describe node.
+func nodeReference(nodeName string) *v1.ObjectReference {
+	return &v1.ObjectReference{Kind: "Node", Name: nodeName, UID: types.UID(nodeName)}
+}
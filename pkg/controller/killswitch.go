@@ -0,0 +1,138 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/supporttools/k8s-node-killer/pkg/config"
+	"github.com/supporttools/k8s-node-killer/pkg/health"
+	"github.com/supporttools/k8s-node-killer/pkg/metrics"
+	"github.com/supporttools/k8s-node-killer/pkg/recovery"
+)
+
+// KillSwitchAnnotation engages the kill switch when set to "true" on the controller's Deployment.
+const KillSwitchAnnotation = "k8s-node-killer.support.tools/paused"
+
+// killSwitchSyncTimeout bounds the initial load of the kill switch state. Watching objects
+// the service account may not read is retried forever, so startup would hang without it.
+const killSwitchSyncTimeout = 30 * time.Second
+
+// killSwitch combines the kill switch sources; it is engaged while any source is set.
+type killSwitch struct {
+	mu      sync.Mutex
+	sources map[string]bool // Keyed by "kind namespace/name"
+}
+
+// set records the state of one source and applies the combined state.
+func (k *killSwitch) set(source string, engaged bool) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if k.sources[source] == engaged {
+		return
+	}
+	k.sources[source] = engaged
+
+	active := ""
+	for name, on := range k.sources {
+		if on && (active == "" || name < active) {
+			active = name
+		}
+	}
+	health.SetKillSwitch(active)
+
+	if active == "" {
+		metrics.RemediationPaused.WithLabelValues("kill_switch").Set(0)
+		logger.Warnf("Kill switch released by %s, remediation resumes.", source)
+		return
+	}
+	metrics.RemediationPaused.WithLabelValues("kill_switch").Set(1)
+	if engaged {
+		logger.Warnf("Kill switch engaged by %s, halting all remediation.", source)
+		recovery.InterruptAll()
+	}
+}
+
+// WatchKillSwitch watches the configured kill switch ConfigMap key and Deployment annotation
+// in the cluster the controller runs in. It returns once the initial state is known, or with
+// an error when it cannot be loaded within killSwitchSyncTimeout, and keeps watching in the
+// background until ctx is cancelled.
+func WatchKillSwitch(ctx context.Context, clientset kubernetes.Interface) error {
+	cfg := config.FromContext(ctx)
+	k := &killSwitch{sources: make(map[string]bool)}
+	metrics.RemediationPaused.WithLabelValues("kill_switch").Set(0)
+	var synced []cache.InformerSynced
+
+	if ref := cfg.KillSwitchConfigMap; ref != "" {
+		namespace, name, _ := strings.Cut(ref, "/")
+		source, key := "ConfigMap "+ref, cfg.KillSwitchKey
+		handle := func(obj interface{}) {
+			if configMap, ok := obj.(*v1.ConfigMap); ok {
+				k.set(source, isTrue(configMap.Data[key]))
+			}
+		}
+		listWatch := cache.NewListWatchFromClient(clientset.CoreV1().RESTClient(), "configmaps", namespace, fields.OneTermEqualSelector("metadata.name", name))
+		_, informer := cache.NewInformer(listWatch, &v1.ConfigMap{}, 0, killSwitchHandlers(handle, func() { k.set(source, false) }))
+		go informer.Run(ctx.Done())
+		synced = append(synced, informer.HasSynced)
+	}
+
+	if ref := cfg.KillSwitchDeployment; ref != "" {
+		namespace, name, _ := strings.Cut(ref, "/")
+		source := "Deployment " + ref
+		handle := func(obj interface{}) {
+			if deployment, ok := obj.(*appsv1.Deployment); ok {
+				k.set(source, isTrue(deployment.Annotations[KillSwitchAnnotation]))
+			}
+		}
+		listWatch := cache.NewListWatchFromClient(clientset.AppsV1().RESTClient(), "deployments", namespace, fields.OneTermEqualSelector("metadata.name", name))
+		_, informer := cache.NewInformer(listWatch, &appsv1.Deployment{}, 0, killSwitchHandlers(handle, func() { k.set(source, false) }))
+		go informer.Run(ctx.Done())
+		synced = append(synced, informer.HasSynced)
+	}
+
+	syncCtx, cancel := context.WithTimeout(ctx, killSwitchSyncTimeout)
+	defer cancel()
+	if !cache.WaitForCacheSync(syncCtx.Done(), synced...) {
+		return fmt.Errorf("kill switch state not loaded within %s: check that the service account may get, list and watch %s", killSwitchSyncTimeout, killSwitchObjects(cfg))
+	}
+	return nil
+}
+
+// killSwitchObjects names the configured kill switch objects.
+func killSwitchObjects(cfg *config.AppConfig) string {
+	var objects []string
+	if cfg.KillSwitchConfigMap != "" {
+		objects = append(objects, "ConfigMap "+cfg.KillSwitchConfigMap)
+	}
+	if cfg.KillSwitchDeployment != "" {
+		objects = append(objects, "Deployment "+cfg.KillSwitchDeployment)
+	}
+	return strings.Join(objects, " and ")
+}
+
+// killSwitchHandlers returns informer handlers calling handle for every version of the
+// watched object and release when it is deleted.
+func killSwitchHandlers(handle func(interface{}), release func()) cache.ResourceEventHandlerFuncs {
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc:    handle,
+		UpdateFunc: func(_, newObj interface{}) { handle(newObj) },
+		DeleteFunc: func(interface{}) { release() },
+	}
+}
+
+// isTrue parses a kill switch value; anything that is not a true boolean releases it.
+func isTrue(value string) bool {
+	engaged, err := strconv.ParseBool(strings.TrimSpace(value))
+	return err == nil && engaged
+}
@@ -0,0 +1,77 @@
+package controller
+
+import (
+	"context"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+
+	"github.com/supporttools/k8s-node-killer/pkg/config"
+	"github.com/supporttools/k8s-node-killer/pkg/health"
+)
+
+// Timings of the leader election, variables so tests can shorten them.
+var (
+	leaseDuration = 15 * time.Second
+	renewDeadline = 10 * time.Second
+	retryPeriod   = 2 * time.Second
+)
+
+// RunLeaderElection campaigns for the leader election Lease in the home cluster until ctx is
+// cancelled, and calls run while this instance holds it. The context given to run is
+// cancelled when the lease is lost, and the lease is only campaigned for again once run
+// returned, so two instances never remediate at the same time. The lease is released when
+// ctx is cancelled, stopping the remediations is then up to the shutdown.
+func RunLeaderElection(ctx context.Context, home kubernetes.Interface, run func(context.Context)) error {
+	cfg := config.FromContext(ctx)
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta: metav1.ObjectMeta{
+			Namespace: cfg.PodNamespace,
+			Name:      cfg.LeaderElectionLease,
+		},
+		Client:     home.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{Identity: cfg.PodName},
+	}
+
+	for ctx.Err() == nil {
+		done := make(chan struct{})
+		elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+			Lock:            lock,
+			LeaseDuration:   leaseDuration,
+			RenewDeadline:   renewDeadline,
+			RetryPeriod:     retryPeriod,
+			ReleaseOnCancel: true,
+			Name:            cfg.LeaderElectionLease,
+			Callbacks: leaderelection.LeaderCallbacks{
+				OnStartedLeading: func(leadCtx context.Context) {
+					defer close(done)
+					logger.Printf("Acquired lease %s/%s, remediating nodes.", cfg.PodNamespace, cfg.LeaderElectionLease)
+					health.SetLeader(true)
+					run(leadCtx)
+				},
+				OnStoppedLeading: func() {
+					health.SetLeader(false)
+					logger.Warnf("Not holding lease %s/%s, standing by.", cfg.PodNamespace, cfg.LeaderElectionLease)
+				},
+				OnNewLeader: func(identity string) {
+					if identity != cfg.PodName {
+						logger.Printf("Instance %s leads.", identity)
+					}
+				},
+			},
+		})
+		if err != nil {
+			return err
+		}
+
+		elector.Run(ctx)
+		if ctx.Err() == nil {
+			// The lease was acquired and lost, run may still be stopping.
+			<-done
+		}
+	}
+	return nil
+}
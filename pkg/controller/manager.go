@@ -0,0 +1,171 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/supporttools/k8s-node-killer/pkg/config"
+	"github.com/supporttools/k8s-node-killer/pkg/health"
+	"github.com/supporttools/k8s-node-killer/pkg/k8sutils"
+	"github.com/supporttools/k8s-node-killer/pkg/metrics"
+	"github.com/supporttools/k8s-node-killer/pkg/policy"
+	"github.com/supporttools/k8s-node-killer/pkg/rancher"
+	"github.com/supporttools/k8s-node-killer/pkg/recovery"
+)
+
+// Manager runs one isolated Controller per Rancher downstream cluster matching the
+// configured selector and name pattern, and starts or stops controllers as clusters
+// are added to or removed from Rancher.
+type Manager struct {
+	selector    labels.Selector
+	namePattern *regexp.Regexp
+
+	mu       sync.Mutex
+	clusters map[string]*managedCluster // Keyed by cluster ID
+}
+
+// managedCluster is a running controller of the manager.
+type managedCluster struct {
+	controller *Controller
+	cancel     context.CancelFunc
+	done       chan struct{} // Closed once the controller has stopped
+}
+
+// NewManager creates a multi-cluster manager from the application configuration.
+func NewManager() (*Manager, error) {
+	cfg := config.Get()
+	selector, err := labels.Parse(cfg.ClusterSelector)
+	if err != nil {
+		return nil, fmt.Errorf("parse cluster selector: %w", err)
+	}
+	namePattern, err := regexp.Compile(cfg.ClusterNamePattern)
+	if err != nil {
+		return nil, fmt.Errorf("parse cluster name pattern: %w", err)
+	}
+
+	return &Manager{
+		selector:    selector,
+		namePattern: namePattern,
+		clusters:    make(map[string]*managedCluster),
+	}, nil
+}
+
+// Run discovers clusters every discovery interval until ctx is cancelled, and then waits for
+// the controllers of the clusters to stop.
+func (m *Manager) Run(ctx context.Context) {
+	ticker := time.NewTicker(config.FromContext(ctx).ClusterDiscovery)
+	defer ticker.Stop()
+
+	for {
+		m.sync(ctx)
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			m.mu.Lock()
+			clusters := m.clusters
+			m.clusters = make(map[string]*managedCluster)
+			m.mu.Unlock()
+			for _, managed := range clusters {
+				<-managed.done
+			}
+			return
+		}
+	}
+}
+
+// sync reconciles the running controllers with the clusters currently known to Rancher.
+func (m *Manager) sync(ctx context.Context) {
+	client, err := k8sutils.RancherClient(ctx)
+	if err != nil {
+		logger.Errorf("Failed to create Rancher API client: %v", err)
+		return
+	}
+	clusters, err := client.ListClusters(ctx, "")
+	if err != nil {
+		logger.Errorf("Failed to discover clusters from Rancher: %v", err)
+		return
+	}
+
+	wanted := make(map[string]rancher.Cluster)
+	for _, cluster := range clusters {
+		if m.selector.Matches(labels.Set(cluster.Labels)) && m.namePattern.MatchString(cluster.Name) {
+			wanted[cluster.ID] = cluster
+		}
+	}
+
+	m.mu.Lock()
+	for id, managed := range m.clusters {
+		if _, ok := wanted[id]; !ok {
+			logger.Infof("Cluster %s no longer matches, stopping its controller.", id)
+			managed.cancel()
+			delete(m.clusters, id)
+			go forgetCluster(managed)
+		}
+	}
+	for id := range m.clusters {
+		delete(wanted, id)
+	}
+	m.mu.Unlock()
+
+	// Generating kubeconfigs calls Rancher, so new controllers are built without the lock.
+	controllers := make(map[string]*Controller)
+	for id, cluster := range wanted {
+		controller, err := newClusterController(ctx, cluster)
+		if err != nil {
+			logger.Errorf("Failed to start controller for cluster %s (%s): %v", cluster.Name, id, err)
+			continue
+		}
+		controllers[id] = controller
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id, controller := range controllers {
+		if _, running := m.clusters[id]; running {
+			controller.shutdownEvents()
+			continue
+		}
+		clusterCtx, cancel := context.WithCancel(ctx)
+		managed := &managedCluster{controller: controller, cancel: cancel, done: make(chan struct{})}
+		m.clusters[id] = managed
+		logger.Infof("Discovered cluster %s (%s).", controller.cluster, id)
+		go func() {
+			defer close(managed.done)
+			controller.Run(clusterCtx)
+		}()
+	}
+	metrics.ManagedClusters.Set(float64(len(m.clusters)))
+}
+
+// newClusterController creates a kubeconfig and clientset for the cluster and a controller
+// using them.
+func newClusterController(ctx context.Context, cluster rancher.Cluster) (*Controller, error) {
+	kubeConfig, err := k8sutils.GetConfigForCluster(ctx, cluster.ID, cluster.Name)
+	if err != nil {
+		return nil, err
+	}
+	clientset, err := kubernetes.NewForConfig(kubeConfig)
+	if err != nil {
+		return nil, fmt.Errorf("create clientset: %w", err)
+	}
+	c := New(cluster.Name, clientset)
+	c.downstream = true
+	return c, nil
+}
+
+// forgetCluster drops the node states, decisions and budget usage of a removed cluster once
+// its controller has stopped, so they are not served forever, and stops its Event
+// broadcaster, which would otherwise keep retrying Events against the cluster.
+func forgetCluster(managed *managedCluster) {
+	<-managed.done
+	managed.controller.shutdownEvents()
+	health.ForgetCluster(managed.controller.cluster)
+	policy.ForgetCluster(managed.controller.cluster)
+	recovery.ForgetCluster(managed.controller.cluster)
+}
@@ -1,89 +1,319 @@
 package health
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"sort"
 	"sync"
 	"time"
 )
 
-var nodeStates sync.Map // A thread-safe map to store node states
+// Status is the recovery status of a node.
+type Status string
+
+const (
+	StatusHealthy            Status = "Healthy"
+	StatusPending            Status = "Pending"            // Not ready, remediation about to start
+	StatusRemediating        Status = "Remediating"        // A recovery step is running, see NodeState.Step
+	StatusRecovered          Status = "Recovered"          // A recovery step brought the node back
+	StatusEscalated          Status = "Escalated"          // A step failed, moving to the next rung
+	StatusManualIntervention Status = "ManualIntervention" // Every step failed
+	StatusSuppressed         Status = "Suppressed"         // Not ready, but remediation is not allowed
+)
+
+// validTransitions lists the statuses each status may move to.
+var validTransitions = map[Status][]Status{
+	"":                       {StatusHealthy, StatusPending, StatusSuppressed},
+	StatusHealthy:            {StatusHealthy, StatusPending, StatusSuppressed},
+	StatusPending:            {StatusHealthy, StatusRemediating, StatusSuppressed, StatusManualIntervention},
+	StatusRemediating:        {StatusRecovered, StatusEscalated, StatusManualIntervention, StatusSuppressed},
+	StatusRecovered:          {StatusHealthy, StatusPending, StatusSuppressed},
+	StatusEscalated:          {StatusRemediating, StatusRecovered, StatusManualIntervention, StatusHealthy, StatusPending, StatusSuppressed},
+	StatusManualIntervention: {StatusHealthy, StatusPending}, // Pending only through the admin API
+	StatusSuppressed:         {StatusHealthy, StatusPending, StatusSuppressed},
+}
+
+// maxAttemptHistory bounds the number of attempts kept per node.
+const maxAttemptHistory = 20
+
+// Attempt results.
+const (
+	ResultInProgress  = "in_progress"
+	ResultSuccess     = "success"
+	ResultFailure     = "failure"
+	ResultInterrupted = "interrupted" // Stopped at a safe point by the kill switch or a shutdown
+)
+
+// ErrInterrupted is wrapped by step errors when a step was stopped at a safe point rather
+// than failing; FinishAttempt records such attempts as interrupted.
+var ErrInterrupted = errors.New("interrupted")
 
 // NodeState holds the recovery state of a node
 type NodeState struct {
-	NodeName      string                        `json:"nodeName"`
-	OverallStatus string                        `json:"overallStatus"`
-	Timestamp     string                        `json:"timestamp"`
-	RecoverySteps map[string]RecoveryStepDetail `json:"recoverySteps"`
+	Cluster        string       `json:"cluster"`
+	NodeName       string       `json:"nodeName"`
+	Status         Status       `json:"status"`
+	Step           string       `json:"step,omitempty"`   // Step being run while Remediating
+	Reason         string       `json:"reason,omitempty"` // Why the node entered its status
+	LastTransition time.Time    `json:"lastTransition"`
+	Paused         bool         `json:"paused"`          // Remediation paused through the admin API
+	Probe          *ProbeResult `json:"probe,omitempty"` // Latest direct probe of the node
+	Attempts       []Attempt    `json:"attempts"`        // Oldest first
+	Actions        []Action     `json:"actions"`         // Admin API calls, oldest first
+}
+
+// Attempt is a single run of a recovery step against a node.
+type Attempt struct {
+	ID              string     `json:"id"`
+	Step            string     `json:"step"`
+	StartedAt       time.Time  `json:"startedAt"`
+	FinishedAt      *time.Time `json:"finishedAt,omitempty"`
+	DurationSeconds float64    `json:"durationSeconds"`
+	Result          string     `json:"result"`
+	Error           string     `json:"error,omitempty"`
 }
 
-// RecoveryStepDetail holds details for each recovery step
+// RecoveryStepDetail is the latest outcome of a recovery step in the deprecated
+// recoverySteps field of /node-states.
 type RecoveryStepDetail struct {
 	Status    string `json:"status"`
 	Timestamp string `json:"timestamp"`
 }
 
-// RegisterNodeState updates the state of a node in the nodeStates map
-func RegisterNodeState(nodeName, step, status string, overallStatus string) {
-	now := time.Now().Format(time.RFC3339)
-	newStepDetail := RecoveryStepDetail{
-		Status:    status,
-		Timestamp: now,
+// legacyNodeState is a node state as served by /node-states. recoverySteps, the latest
+// attempt of each step keyed by step name, is kept for consumers of the format preceding
+// attempts. It is derived from Attempts and will be removed in the next release.
+type legacyNodeState struct {
+	NodeState
+	RecoverySteps     map[string]RecoveryStepDetail `json:"recoverySteps"`
+	RemediationHalted string                        `json:"remediationHalted,omitempty"` // See RemediationHalted
+}
+
+func newLegacyNodeState(state NodeState, halted string) legacyNodeState {
+	steps := make(map[string]RecoveryStepDetail)
+	for _, attempt := range state.Attempts {
+		at := attempt.StartedAt
+		if attempt.FinishedAt != nil {
+			at = *attempt.FinishedAt
+		}
+		steps[attempt.Step] = RecoveryStepDetail{Status: attempt.Result, Timestamp: at.Format(time.RFC3339)}
 	}
+	return legacyNodeState{NodeState: state, RecoverySteps: steps, RemediationHalted: halted}
+}
 
-	existingValue, _ := nodeStates.LoadOrStore(nodeName, NodeState{
-		NodeName:      nodeName,
-		OverallStatus: overallStatus,
-		Timestamp:     now,
-		RecoverySteps: map[string]RecoveryStepDetail{step: newStepDetail},
-	})
+var (
+	nodeStatesMu sync.RWMutex
+	nodeStates   = make(map[string]*NodeState) // Keyed by nodeKey
+)
+
+type clusterKey struct{}
 
-	if nodeState, ok := existingValue.(NodeState); ok {
-		if nodeState.RecoverySteps == nil {
-			nodeState.RecoverySteps = make(map[string]RecoveryStepDetail)
+// WithCluster returns a context carrying the name of the cluster being reconciled.
+func WithCluster(ctx context.Context, cluster string) context.Context {
+	return context.WithValue(ctx, clusterKey{}, cluster)
+}
+
+// ClusterFromContext returns the cluster name carried by the context, if any.
+func ClusterFromContext(ctx context.Context) string {
+	cluster, _ := ctx.Value(clusterKey{}).(string)
+	return cluster
+}
+
+// nodeKey returns the key of a node in the nodeStates map.
+func nodeKey(cluster, nodeName string) string {
+	return cluster + "/" + nodeName
+}
+
+// getOrCreate returns the stored state of a node, creating it if needed. The caller must
+// hold nodeStatesMu for writing.
+func getOrCreate(cluster, nodeName string) *NodeState {
+	key := nodeKey(cluster, nodeName)
+	state, exists := nodeStates[key]
+	if !exists {
+		state = &NodeState{Cluster: cluster, NodeName: nodeName}
+		nodeStates[key] = state
+	}
+	return state
+}
+
+// transition moves a node to a new status if the transition is valid. The caller must hold
+// nodeStatesMu for writing.
+func (s *NodeState) transition(to Status, step, reason string) error {
+	allowed := false
+	for _, next := range validTransitions[s.Status] {
+		if next == to {
+			allowed = true
+			break
 		}
-		nodeState.RecoverySteps[step] = newStepDetail
-		nodeState.Timestamp = now // update the timestamp to the latest update
-		nodeState.OverallStatus = overallStatus
-		nodeStates.Store(nodeName, nodeState)
 	}
+	if !allowed {
+		return fmt.Errorf("invalid transition of node %s from %q to %q", s.NodeName, s.Status, to)
+	}
+
+	if s.Status != to || s.Step != step || s.Reason != reason {
+		s.LastTransition = Now()
+	}
+	s.Status, s.Step, s.Reason = to, step, reason
+	return nil
 }
 
-// NodeStatesHandler returns the current state of all nodes as JSON
-func NodeStatesHandler(w http.ResponseWriter, r *http.Request) {
-	var allStates []NodeState
-	nodeStates.Range(func(_, value interface{}) bool {
-		if state, ok := value.(NodeState); ok {
-			allStates = append(allStates, state)
+// Transition moves a node to a new status, recording why. It returns an error, leaving the
+// state unchanged, when the transition is not allowed.
+func Transition(cluster, nodeName string, to Status, reason string) error {
+	nodeStatesMu.Lock()
+	defer nodeStatesMu.Unlock()
+
+	return getOrCreate(cluster, nodeName).transition(to, "", reason)
+}
+
+// StartAttempt moves a node to Remediating for the given step and records a new attempt.
+// It returns the ID of the attempt, to be passed to FinishAttempt.
+func StartAttempt(cluster, nodeName, step string) (string, error) {
+	nodeStatesMu.Lock()
+	defer nodeStatesMu.Unlock()
+
+	state := getOrCreate(cluster, nodeName)
+	if err := state.transition(StatusRemediating, step, ""); err != nil {
+		return "", err
+	}
+
+	attempt := Attempt{ID: newAttemptID(), Step: step, StartedAt: Now(), Result: ResultInProgress}
+	state.Attempts = append(state.Attempts, attempt)
+	if len(state.Attempts) > maxAttemptHistory {
+		state.Attempts = append([]Attempt(nil), state.Attempts[len(state.Attempts)-maxAttemptHistory:]...)
+	}
+	return attempt.ID, nil
+}
+
+// FinishAttempt records the outcome of an attempt. A nil stepErr marks it successful. It
+// returns the finished attempt, or false when no attempt has the ID.
+func FinishAttempt(cluster, nodeName, attemptID string, stepErr error) (Attempt, bool) {
+	nodeStatesMu.Lock()
+	defer nodeStatesMu.Unlock()
+
+	state := getOrCreate(cluster, nodeName)
+	for i := range state.Attempts {
+		attempt := &state.Attempts[i]
+		if attempt.ID != attemptID {
+			continue
 		}
-		return true
-	})
+		now := Now()
+		attempt.FinishedAt = &now
+		attempt.DurationSeconds = now.Sub(attempt.StartedAt).Seconds()
+		attempt.Result = ResultSuccess
+		if stepErr != nil {
+			attempt.Result = ResultFailure
+			if errors.Is(stepErr, ErrInterrupted) {
+				attempt.Result = ResultInterrupted
+			}
+			attempt.Error = stepErr.Error()
+		}
+		return *attempt, true
+	}
+	return Attempt{}, false
+}
 
-	// Sort states by nodeName
-	sort.Slice(allStates, func(i, j int) bool {
-		return allStates[i].NodeName < allStates[j].NodeName
-	})
+// RestoreAttempt adds a finished attempt of a previous run of the controller to the history
+// of a node, unless the history already holds it. The status of the node is left unchanged.
+func RestoreAttempt(cluster, nodeName string, attempt Attempt) {
+	nodeStatesMu.Lock()
+	defer nodeStatesMu.Unlock()
+
+	state := getOrCreate(cluster, nodeName)
+	for _, existing := range state.Attempts {
+		if existing.ID == attempt.ID {
+			return
+		}
+	}
+	state.Attempts = append(state.Attempts, attempt)
+	sort.SliceStable(state.Attempts, func(i, j int) bool { return state.Attempts[i].StartedAt.Before(state.Attempts[j].StartedAt) })
+	if len(state.Attempts) > maxAttemptHistory {
+		state.Attempts = append([]Attempt(nil), state.Attempts[len(state.Attempts)-maxAttemptHistory:]...)
+	}
+}
+
+// newAttemptID returns a random identifier for an attempt.
+func newAttemptID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// copyState returns a copy of a node state that does not share its history slices.
+func copyState(state *NodeState) NodeState {
+	c := *state
+	c.Attempts = append([]Attempt{}, state.Attempts...)
+	c.Actions = append([]Action{}, state.Actions...)
+	if state.Probe != nil {
+		probe := *state.Probe
+		probe.Errors = append([]string(nil), state.Probe.Errors...)
+		c.Probe = &probe
+	}
+	return c
+}
+
+// RemediationHaltedHeader is set on /node-states responses while remediation is halted,
+// with the reason as value. The reason is also set on every node of the body, as
+// remediationHalted, since the body is a list.
+const RemediationHaltedHeader = "X-Remediation-Halted"
+
+// NodeStatesHandler returns the current state of all nodes as JSON, optionally
+// filtered to a single cluster with the cluster query parameter.
+func NodeStatesHandler(w http.ResponseWriter, r *http.Request) {
+	cluster := r.URL.Query().Get("cluster")
+	_, halted := RemediationHalted()
+	allStates := []legacyNodeState{}
+	for _, state := range ListNodeStates() {
+		if cluster == "" || state.Cluster == cluster {
+			allStates = append(allStates, newLegacyNodeState(state, halted))
+		}
+	}
 
 	jsonData, err := json.Marshal(allStates)
 	if err != nil {
 		http.Error(w, "Failed to encode states", http.StatusInternalServerError)
 		return
 	}
+	if halted != "" {
+		w.Header().Set(RemediationHaltedHeader, halted)
+	}
 	w.Header().Set("Content-Type", "application/json")
 	w.Write(jsonData)
 }
 
+// ListNodeStates returns the state of every known node, sorted by cluster and node name.
+func ListNodeStates() []NodeState {
+	nodeStatesMu.RLock()
+	allStates := make([]NodeState, 0, len(nodeStates))
+	for _, state := range nodeStates {
+		allStates = append(allStates, copyState(state))
+	}
+	nodeStatesMu.RUnlock()
+
+	sort.Slice(allStates, func(i, j int) bool {
+		if allStates[i].Cluster != allStates[j].Cluster {
+			return allStates[i].Cluster < allStates[j].Cluster
+		}
+		return allStates[i].NodeName < allStates[j].NodeName
+	})
+	return allStates
+}
+
 // GetNodeState retrieves the complete state for a given node.
-func GetNodeState(nodeName string) (NodeState, bool) {
-	value, exists := nodeStates.Load(nodeName)
+func GetNodeState(cluster, nodeName string) (NodeState, bool) {
+	nodeStatesMu.RLock()
+	defer nodeStatesMu.RUnlock()
+
+	state, exists := nodeStates[nodeKey(cluster, nodeName)]
 	if !exists {
 		return NodeState{}, false // Return empty if no state is found
 	}
-
-	if state, ok := value.(NodeState); ok {
-		return state, true
-	}
-
-	return NodeState{}, false // Return empty if conversion fails
+	return copyState(state), true
 }
@@ -0,0 +1,122 @@
+package health
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// maxActionHistory bounds the number of admin actions kept per node and for the controller.
+const maxActionHistory = 20
+
+// Action is an operator call made through the admin API.
+type Action struct {
+	Time   time.Time `json:"time"`
+	Action string    `json:"action"`
+	Detail string    `json:"detail,omitempty"`
+	Source string    `json:"source,omitempty"` // Remote address of the caller
+}
+
+// ActionList is the response of GET /api/v1/actions.
+type ActionList struct {
+	APIVersion string   `json:"apiVersion"`
+	Kind       string   `json:"kind"`
+	Paused     bool     `json:"paused"`
+	Items      []Action `json:"items"`
+}
+
+var (
+	controllerPaused    atomic.Bool
+	controllerActionsMu sync.Mutex
+	controllerActions   []Action
+)
+
+// appendAction adds an action to a history, dropping the oldest entries beyond the bound.
+func appendAction(history []Action, action Action) []Action {
+	history = append(history, action)
+	if len(history) > maxActionHistory {
+		history = append([]Action(nil), history[len(history)-maxActionHistory:]...)
+	}
+	return history
+}
+
+// RecordAction records an admin action against a node, or against the controller as a
+// whole when nodeName is empty.
+func RecordAction(cluster, nodeName, action, detail, source string) {
+	entry := Action{Time: Now(), Action: action, Detail: detail, Source: source}
+	if nodeName == "" {
+		controllerActionsMu.Lock()
+		controllerActions = appendAction(controllerActions, entry)
+		controllerActionsMu.Unlock()
+		return
+	}
+
+	nodeStatesMu.Lock()
+	defer nodeStatesMu.Unlock()
+
+	state := getOrCreate(cluster, nodeName)
+	state.Actions = appendAction(state.Actions, entry)
+}
+
+// SetNodePaused pauses or resumes remediation of a single node.
+func SetNodePaused(cluster, nodeName string, paused bool) {
+	nodeStatesMu.Lock()
+	defer nodeStatesMu.Unlock()
+
+	getOrCreate(cluster, nodeName).Paused = paused
+}
+
+// ClearNodeState forgets the status and attempt history of a node, keeping its admin
+// actions. It reports whether the node was known.
+func ClearNodeState(cluster, nodeName string) bool {
+	nodeStatesMu.Lock()
+	defer nodeStatesMu.Unlock()
+
+	key := nodeKey(cluster, nodeName)
+	state, exists := nodeStates[key]
+	if !exists {
+		return false
+	}
+	nodeStates[key] = &NodeState{Cluster: cluster, NodeName: nodeName, Actions: state.Actions}
+	return true
+}
+
+// ForgetCluster drops the state of every node of a cluster, including its admin actions.
+func ForgetCluster(cluster string) {
+	nodeStatesMu.Lock()
+	defer nodeStatesMu.Unlock()
+
+	for key, state := range nodeStates {
+		if state.Cluster == cluster {
+			delete(nodeStates, key)
+		}
+	}
+}
+
+// ForgetNode drops the state of a deleted node.
+func ForgetNode(cluster, nodeName string) {
+	nodeStatesMu.Lock()
+	defer nodeStatesMu.Unlock()
+
+	delete(nodeStates, nodeKey(cluster, nodeName))
+}
+
+// SetControllerPaused pauses or resumes remediation of every node.
+func SetControllerPaused(paused bool) {
+	controllerPaused.Store(paused)
+}
+
+// ControllerPaused reports whether remediation of every node is paused.
+func ControllerPaused() bool {
+	return controllerPaused.Load()
+}
+
+// actionsHandler serves the controller-wide admin actions and pause state.
+func actionsHandler(w http.ResponseWriter, r *http.Request) {
+	controllerActionsMu.Lock()
+	actions := append([]Action{}, controllerActions...)
+	controllerActionsMu.Unlock()
+
+	WriteJSON(w, http.StatusOK, ActionList{APIVersion: APIVersion, Kind: "ActionList", Paused: ControllerPaused(), Items: actions})
+}
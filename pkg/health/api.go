@@ -0,0 +1,232 @@
+package health
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// APIVersion is the version of the JSON schemas served under /api/v1.
+const APIVersion = "v1"
+
+// Pagination defaults of the node list endpoint.
+const (
+	defaultPageLimit = 100
+	maxPageLimit     = 1000
+)
+
+// NodeList is the response of GET /api/v1/nodes.
+type NodeList struct {
+	APIVersion string      `json:"apiVersion"`
+	Kind       string      `json:"kind"`
+	Total      int         `json:"total"`                       // Nodes matching the filters, across all pages
+	Offset     int         `json:"offset"`                      // Index of the first item of this page
+	Limit      int         `json:"limit"`                       // Maximum number of items per page
+	NextOffset *int        `json:"nextOffset,omitempty"`        // Offset of the next page, if any
+	Halted     string      `json:"remediationHalted,omitempty"` // Why no node is remediated, see RemediationHalted
+	Items      []NodeState `json:"items"`
+}
+
+// Node is the response of GET /api/v1/nodes/{name}.
+type Node struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	NodeState
+}
+
+// Summary is the response of GET /api/v1/summary.
+type Summary struct {
+	APIVersion string         `json:"apiVersion"`
+	Kind       string         `json:"kind"`
+	Total      int            `json:"total"`
+	Paused     bool           `json:"paused"`               // Remediation of every node is paused by an operator
+	KillSwitch string         `json:"killSwitch,omitempty"` // Object that engaged the kill switch
+	ByStatus   map[Status]int `json:"byStatus"`
+}
+
+// APIError is the body of every non-2xx response under /api/v1.
+type APIError struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Status     int    `json:"status"`
+	Message    string `json:"message"`
+}
+
+// nodeFilter selects nodes by cluster, status, step and time of last transition.
+type nodeFilter struct {
+	cluster  string
+	statuses map[Status]bool
+	step     string
+	since    time.Time
+	until    time.Time
+}
+
+// RegisterAPI registers the /api/v1 endpoints on the given mux.
+func RegisterAPI(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/v1/nodes", listNodesHandler)
+	mux.HandleFunc("GET /api/v1/nodes/{name}", getNodeHandler)
+	mux.HandleFunc("GET /api/v1/summary", summaryHandler)
+	mux.HandleFunc("GET /api/v1/actions", actionsHandler)
+}
+
+// listNodesHandler serves a page of the nodes matching the query filters. Supported query
+// parameters are cluster, status (comma separated), step, since and until (RFC 3339),
+// limit and offset.
+func listNodesHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter, err := parseNodeFilter(query)
+	if err != nil {
+		WriteAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	limit, err := queryInt(query.Get("limit"), defaultPageLimit)
+	if err != nil || limit < 1 || limit > maxPageLimit {
+		WriteAPIError(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxPageLimit))
+		return
+	}
+	offset, err := queryInt(query.Get("offset"), 0)
+	if err != nil || offset < 0 {
+		WriteAPIError(w, http.StatusBadRequest, "offset must be a non-negative integer")
+		return
+	}
+
+	matching := []NodeState{}
+	for _, state := range ListNodeStates() {
+		if filter.matches(state) {
+			matching = append(matching, state)
+		}
+	}
+
+	list := NodeList{APIVersion: APIVersion, Kind: "NodeList", Total: len(matching), Offset: offset, Limit: limit, Items: []NodeState{}}
+	_, list.Halted = RemediationHalted()
+	if offset < len(matching) {
+		end := min(offset+limit, len(matching))
+		list.Items = matching[offset:end]
+		if end < len(matching) {
+			list.NextOffset = &end
+		}
+	}
+	WriteJSON(w, http.StatusOK, list)
+}
+
+// getNodeHandler serves the full state and attempt history of a single node. The cluster
+// query parameter is only required when nodes of several clusters share the name.
+func getNodeHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	cluster := r.URL.Query().Get("cluster")
+
+	state, found := NodeState{}, false
+	if r.URL.Query().Has("cluster") {
+		state, found = GetNodeState(cluster, name)
+	} else {
+		var clusters []string
+		for _, candidate := range ListNodeStates() {
+			if candidate.NodeName == name {
+				state, found = candidate, true
+				clusters = append(clusters, candidate.Cluster)
+			}
+		}
+		if len(clusters) > 1 {
+			WriteAPIError(w, http.StatusConflict, fmt.Sprintf("node %s exists in clusters %s, set the cluster query parameter", name, strings.Join(clusters, ", ")))
+			return
+		}
+	}
+	if !found {
+		WriteAPIError(w, http.StatusNotFound, fmt.Sprintf("node %s not found", name))
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, Node{APIVersion: APIVersion, Kind: "Node", NodeState: state})
+}
+
+// summaryHandler serves the number of nodes in each status, optionally for a single cluster.
+func summaryHandler(w http.ResponseWriter, r *http.Request) {
+	cluster := r.URL.Query().Get("cluster")
+	summary := Summary{APIVersion: APIVersion, Kind: "Summary", Paused: ControllerPaused(), ByStatus: make(map[Status]int)}
+	_, summary.KillSwitch = KillSwitch()
+	for _, state := range ListNodeStates() {
+		if cluster != "" && state.Cluster != cluster {
+			continue
+		}
+		summary.Total++
+		summary.ByStatus[state.Status]++
+	}
+	WriteJSON(w, http.StatusOK, summary)
+}
+
+// parseNodeFilter builds a node filter from the query parameters of a list request.
+func parseNodeFilter(query url.Values) (nodeFilter, error) {
+	filter := nodeFilter{cluster: query.Get("cluster"), step: query.Get("step")}
+	if statuses := query.Get("status"); statuses != "" {
+		filter.statuses = make(map[Status]bool)
+		for _, status := range strings.Split(statuses, ",") {
+			status := Status(strings.TrimSpace(status))
+			if _, known := validTransitions[status]; !known || status == "" {
+				return nodeFilter{}, fmt.Errorf("unknown status %q", status)
+			}
+			filter.statuses[status] = true
+		}
+	}
+	for key, target := range map[string]*time.Time{"since": &filter.since, "until": &filter.until} {
+		if value := query.Get(key); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return nodeFilter{}, fmt.Errorf("%s must be an RFC 3339 timestamp: %v", key, err)
+			}
+			*target = parsed
+		}
+	}
+	return filter, nil
+}
+
+// matches reports whether a node state passes the filter. The step filter matches the
+// step currently running as well as any step in the attempt history.
+func (f nodeFilter) matches(state NodeState) bool {
+	if f.cluster != "" && state.Cluster != f.cluster {
+		return false
+	}
+	if f.statuses != nil && !f.statuses[state.Status] {
+		return false
+	}
+	if !f.since.IsZero() && state.LastTransition.Before(f.since) {
+		return false
+	}
+	if !f.until.IsZero() && state.LastTransition.After(f.until) {
+		return false
+	}
+	if f.step == "" || state.Step == f.step {
+		return true
+	}
+	for _, attempt := range state.Attempts {
+		if attempt.Step == f.step {
+			return true
+		}
+	}
+	return false
+}
+
+// queryInt parses an integer query parameter, returning def when it is not set.
+func queryInt(value string, def int) (int, error) {
+	if value == "" {
+		return def, nil
+	}
+	return strconv.Atoi(value)
+}
+
+// WriteJSON writes body as the JSON response with the given status code.
+func WriteJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		logger.Errorf("Failed to encode API response: %v", err)
+	}
+}
+
+// WriteAPIError writes a versioned error response.
+func WriteAPIError(w http.ResponseWriter, status int, message string) {
+	WriteJSON(w, status, APIError{APIVersion: APIVersion, Kind: "Error", Status: status, Message: message})
+}
@@ -0,0 +1,193 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Check reports whether one aspect of the controller is healthy.
+type Check func(ctx context.Context) error
+
+// checkTimeout bounds every check, so a hung API server fails its check instead of the probe.
+const checkTimeout = 5 * time.Second
+
+var (
+	checksMu        sync.RWMutex
+	readinessChecks = make(map[string]Check)
+	livenessChecks  = make(map[string]Check)
+	clusterChecks   = make(map[string]Check)
+
+	shuttingDown    atomic.Bool
+	errShuttingDown = errors.New("shutting down")
+
+	leader       atomic.Bool
+	errNotLeader = errors.New("not the leader")
+)
+
+// AddReadinessCheck adds a check /readyz fails on, replacing any check of the same name.
+func AddReadinessCheck(name string, check Check) {
+	checksMu.Lock()
+	defer checksMu.Unlock()
+	readinessChecks[name] = check
+}
+
+// AddLivenessCheck adds a check /healthz fails on, replacing any check of the same name.
+func AddLivenessCheck(name string, check Check) {
+	checksMu.Lock()
+	defer checksMu.Unlock()
+	livenessChecks[name] = check
+}
+
+// AddClusterCheck adds a check of a downstream cluster, replacing any check of the same
+// name. /readyz reports its result without failing on it, so one unreachable cluster does
+// not take the controller out of service for the others.
+func AddClusterCheck(name string, check Check) {
+	checksMu.Lock()
+	defer checksMu.Unlock()
+	clusterChecks[name] = check
+}
+
+// RemoveChecks removes the readiness, liveness and cluster checks with the given names.
+func RemoveChecks(names ...string) {
+	checksMu.Lock()
+	defer checksMu.Unlock()
+	for _, name := range names {
+		delete(readinessChecks, name)
+		delete(livenessChecks, name)
+		delete(clusterChecks, name)
+	}
+}
+
+// SetShuttingDown makes /readyz fail for the rest of the process lifetime.
+func SetShuttingDown() {
+	shuttingDown.Store(true)
+}
+
+// SetLeader records whether this instance is the one remediating nodes.
+func SetLeader(leading bool) {
+	leader.Store(leading)
+}
+
+// Leader returns whether this instance is the one remediating nodes.
+func Leader() bool {
+	return leader.Load()
+}
+
+func init() {
+	AddReadinessCheck("shutdown", func(context.Context) error {
+		if shuttingDown.Load() {
+			return errShuttingDown
+		}
+		return nil
+	})
+	AddReadinessCheck("leader", func(context.Context) error {
+		if !Leader() {
+			return errNotLeader
+		}
+		return nil
+	})
+}
+
+// CheckResult is the outcome of a single check.
+type CheckResult struct {
+	Name    string `json:"name"`
+	Status  string `json:"status"` // "ok" or "failed"
+	Message string `json:"message,omitempty"`
+}
+
+// CheckReport is the detailed form of /healthz and /readyz.
+type CheckReport struct {
+	Status   string        `json:"status"`
+	Checks   []CheckResult `json:"checks"`
+	Clusters []CheckResult `json:"clusters,omitempty"` // Checks of downstream clusters, not affecting status
+	Halted   string        `json:"remediationHalted,omitempty"`
+}
+
+// runChecks runs the checks concurrently and returns their results sorted by name.
+func runChecks(ctx context.Context, checks map[string]Check) []CheckResult {
+	checksMu.RLock()
+	names := make([]string, 0, len(checks))
+	funcs := make([]Check, 0, len(checks))
+	for name, check := range checks {
+		names = append(names, name)
+		funcs = append(funcs, check)
+	}
+	checksMu.RUnlock()
+
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	results := make([]CheckResult, len(names))
+	var wg sync.WaitGroup
+	for i := range names {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = CheckResult{Name: names[i], Status: "ok"}
+			if err := funcs[i](ctx); err != nil {
+				results[i].Status = "failed"
+				results[i].Message = err.Error()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	sort.Slice(results, func(i, j int) bool { return results[i].Name < results[j].Name })
+	return results
+}
+
+// checksHandler serves the result of a set of checks: 200 when every check passes and 503
+// otherwise, as plain text or, with ?format=json, as a CheckReport. The cluster checks, if
+// any, are reported as well but do not change the status.
+func checksHandler(checks, clusters map[string]Check, reportHalted bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := CheckReport{Status: "ok", Checks: runChecks(r.Context(), checks)}
+		if clusters != nil {
+			report.Clusters = runChecks(r.Context(), clusters)
+		}
+		failed, failedClusters := failedChecks(report.Checks), failedChecks(report.Clusters)
+		status := http.StatusOK
+		if len(failed) > 0 {
+			report.Status = "failed"
+			status = http.StatusServiceUnavailable
+		}
+		if reportHalted {
+			if halted, reason := RemediationHalted(); halted {
+				report.Halted = reason
+			}
+		}
+
+		if r.URL.Query().Get("format") == "json" {
+			WriteJSON(w, status, report)
+			return
+		}
+		w.WriteHeader(status)
+		switch {
+		case len(failed) > 0:
+			w.Write([]byte("failed: " + strings.Join(failed, ", ")))
+		case report.Halted != "":
+			w.Write([]byte("ok (remediation halted: " + report.Halted + ")"))
+		case len(failedClusters) > 0:
+			w.Write([]byte("ok (clusters failing: " + strings.Join(failedClusters, ", ") + ")"))
+		default:
+			w.Write([]byte("ok"))
+		}
+	})
+}
+
+// failedChecks returns the names of the failed checks.
+func failedChecks(results []CheckResult) []string {
+	var failed []string
+	for _, result := range results {
+		if result.Status != "ok" {
+			failed = append(failed, result.Name)
+		}
+	}
+	return failed
+}
@@ -0,0 +1,69 @@
+package health
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Clock tells the time of node states and remediations, and times the waits of
+// remediations. The simulator replaces the wall clock with its own.
+type Clock interface {
+	Now() time.Time
+	// Sleep waits for d, returning false when ctx is done first.
+	Sleep(ctx context.Context, d time.Duration) bool
+}
+
+// wallClock is the real time.
+type wallClock struct{}
+
+func (wallClock) Now() time.Time { return time.Now() }
+
+func (wallClock) Sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+var (
+	clockMu sync.RWMutex
+	clock   Clock = wallClock{}
+)
+
+// SetClock replaces the clock, or restores the wall clock when c is nil.
+func SetClock(c Clock) {
+	clockMu.Lock()
+	defer clockMu.Unlock()
+
+	if c == nil {
+		c = wallClock{}
+	}
+	clock = c
+}
+
+func currentClock() Clock {
+	clockMu.RLock()
+	defer clockMu.RUnlock()
+
+	return clock
+}
+
+// Now returns the current time of the clock.
+func Now() time.Time {
+	return currentClock().Now()
+}
+
+// Since returns the time elapsed on the clock since t.
+func Since(t time.Time) time.Duration {
+	return Now().Sub(t)
+}
+
+// Sleep waits for d on the clock, returning false when ctx is done first.
+func Sleep(ctx context.Context, d time.Duration) bool {
+	return currentClock().Sleep(ctx, d)
+}
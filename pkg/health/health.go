@@ -29,18 +29,17 @@ var versionInfo = VersionInfo{
 	BuildTime: BuildTime,
 }
 
+// HealthzHandler reports liveness, failing when a liveness check fails, for example when a
+// controller stopped scanning its nodes.
 func HealthzHandler() http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("ok"))
-	})
+	return checksHandler(livenessChecks, nil, false)
 }
 
+// ReadyzHandler reports readiness, failing when a readiness check fails. A halted
+// controller is still ready, the body says why remediation is halted, and so is one some
+// downstream clusters of which fail their checks, the body lists them.
 func ReadyzHandler() http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("ok"))
-	})
+	return checksHandler(readinessChecks, clusterChecks, true)
 }
 
 func VersionHandler() http.Handler {
@@ -0,0 +1,37 @@
+package health
+
+import "sync"
+
+var (
+	killSwitchMu     sync.RWMutex
+	killSwitchSource string // Object that engaged the kill switch, empty when released
+)
+
+// SetKillSwitch engages the kill switch on behalf of source, or releases it when source
+// is empty. While engaged, no remediation is started and running steps are interrupted.
+func SetKillSwitch(source string) {
+	killSwitchMu.Lock()
+	defer killSwitchMu.Unlock()
+
+	killSwitchSource = source
+}
+
+// KillSwitch reports whether the kill switch is engaged, and by which object.
+func KillSwitch() (bool, string) {
+	killSwitchMu.RLock()
+	defer killSwitchMu.RUnlock()
+
+	return killSwitchSource != "", killSwitchSource
+}
+
+// RemediationHalted reports whether the kill switch is engaged or an operator paused the
+// controller, with a description of why.
+func RemediationHalted() (bool, string) {
+	if engaged, source := KillSwitch(); engaged {
+		return true, "kill switch engaged by " + source
+	}
+	if ControllerPaused() {
+		return true, "paused by an operator"
+	}
+	return false, ""
+}
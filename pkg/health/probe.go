@@ -0,0 +1,26 @@
+package health
+
+import "time"
+
+// ProbeResult is the outcome of probing a NotReady node directly, bypassing the API server.
+type ProbeResult struct {
+	ProbedAt time.Time `json:"probedAt"`
+	Address  string    `json:"address"`
+	SSH      bool      `json:"ssh"`            // The SSH port accepted a connection
+	Kubelet  bool      `json:"kubelet"`        // The kubelet answered on its healthz endpoint
+	HTTP     *bool     `json:"http,omitempty"` // The custom endpoint answered 2xx; nil when not configured
+	Errors   []string  `json:"errors,omitempty"`
+}
+
+// HostReachable reports whether any probe got an answer from the node.
+func (p ProbeResult) HostReachable() bool {
+	return p.SSH || p.Kubelet || (p.HTTP != nil && *p.HTTP)
+}
+
+// RecordProbe keeps the latest probe result of a node in its state.
+func RecordProbe(cluster, nodeName string, result ProbeResult) {
+	nodeStatesMu.Lock()
+	defer nodeStatesMu.Unlock()
+
+	getOrCreate(cluster, nodeName).Probe = &result
+}
@@ -6,17 +6,20 @@ import (
 	"time"
 
 	"github.com/supporttools/k8s-node-killer/pkg/config"
+	"github.com/supporttools/k8s-node-killer/pkg/logging"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/kubectl/pkg/drain"
 )
 
-func CordonNode(ctx context.Context, clientset *kubernetes.Clientset, node *v1.Node, cordon bool) error {
+func CordonNode(ctx context.Context, clientset kubernetes.Interface, node *v1.Node, cordon bool) error {
+	cfg := config.FromContext(ctx)
+	log := logging.FromContext(ctx)
 	action := "cordoning"
 	if !cordon {
 		action = "uncordoning"
 	}
-	logger.Printf("%s node %s with a timeout of %d minutes...", action, node.Name, config.CFG.DrainTimeoutMinutes)
+	log.Printf("%s node %s with a timeout of %d minutes...", action, node.Name, cfg.DrainTimeoutMinutes)
 
 	drainer := &drain.Helper{
 		Client:              clientset,
@@ -24,7 +27,7 @@ func CordonNode(ctx context.Context, clientset *kubernetes.Clientset, node *v1.N
 		IgnoreAllDaemonSets: true,
 		DeleteEmptyDirData:  true,
 		GracePeriodSeconds:  -1,
-		Timeout:             time.Duration(config.CFG.DrainTimeoutMinutes) * time.Minute,
+		Timeout:             time.Duration(cfg.DrainTimeoutMinutes) * time.Minute,
 		Out:                 os.Stdout,
 		ErrOut:              os.Stderr,
 		Ctx:                 ctx,
@@ -32,10 +35,10 @@ func CordonNode(ctx context.Context, clientset *kubernetes.Clientset, node *v1.N
 
 	err := drain.RunCordonOrUncordon(drainer, node, cordon)
 	if err != nil {
-		logger.Printf("Failed to %s node %s: %v", action, node.Name, err)
+		log.Printf("Failed to %s node %s: %v", action, node.Name, err)
 		return err
 	}
 
-	logger.Printf("Successfully %s node %s.", action, node.Name)
+	log.Printf("Successfully %s node %s.", action, node.Name)
 	return nil
 }
@@ -0,0 +1,203 @@
+package k8sutils
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/supporttools/k8s-node-killer/pkg/metrics"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// Regenerations are at least minRefreshInterval apart, so a burst of 401s from concurrent
+// requests results in a single call to Rancher. The interval doubles with every consecutive
+// failure, up to maxRefreshInterval, so an unreachable Rancher is not hammered.
+const (
+	minRefreshInterval = 30 * time.Second
+	maxRefreshInterval = 10 * time.Minute
+)
+
+// CredentialManager keeps the bearer token of a Rancher-generated kubeconfig fresh. It is
+// installed as a transport wrapper on the rest.Config, so running clientsets and informers
+// pick up a regenerated token on their next request without being rebuilt.
+type CredentialManager struct {
+	clusterID   string
+	clusterName string
+	ttl         time.Duration
+
+	generate func(ctx context.Context, clusterID string) (string, error)
+
+	mu          sync.RWMutex
+	token       string
+	refreshedAt time.Time // Last successful regeneration
+	attemptedAt time.Time // Last regeneration, successful or not
+	failures    int       // Consecutive failed regenerations
+
+	refreshMu  sync.Mutex  // Serializes regenerations
+	refreshing atomic.Bool // A background regeneration is running
+}
+
+// NewCredentialManager creates a manager for the given cluster, seeded with the token from
+// the initial kubeconfig. A zero ttl disables proactive refreshes; the token is then only
+// regenerated when the API server rejects it.
+func NewCredentialManager(clusterID, clusterName, token string, ttl time.Duration) *CredentialManager {
+	return &CredentialManager{
+		clusterID:   clusterID,
+		clusterName: clusterName,
+		ttl:         ttl,
+		generate:    GenerateKubeconfig,
+		token:       token,
+		refreshedAt: time.Now(),
+		attemptedAt: time.Now(),
+	}
+}
+
+// Install moves the bearer token of the rest.Config under the manager's control.
+func (m *CredentialManager) Install(kubeConfig *rest.Config) {
+	kubeConfig.BearerToken = ""
+	kubeConfig.BearerTokenFile = ""
+	kubeConfig.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+		return &refreshingRoundTripper{manager: m, base: rt}
+	})
+}
+
+// currentToken returns the token to use. Once the TTL has expired it starts a regeneration
+// in the background and keeps returning the current token until one succeeds.
+func (m *CredentialManager) currentToken() string {
+	m.mu.RLock()
+	token, expired, due := m.token, m.ttl > 0 && time.Since(m.refreshedAt) > m.ttl, m.refreshDue()
+	m.mu.RUnlock()
+
+	if expired && due && m.refreshing.CompareAndSwap(false, true) {
+		go func() {
+			defer m.refreshing.Store(false)
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+			if err := m.refresh(ctx, token, "ttl_expired"); err != nil {
+				logger.Errorf("Failed to refresh expired kubeconfig for cluster %s: %v", m.clusterID, err)
+			}
+		}()
+	}
+	return token
+}
+
+// refreshDue reports whether the backoff since the last regeneration has elapsed. The caller
+// must hold m.mu.
+func (m *CredentialManager) refreshDue() bool {
+	return time.Since(m.attemptedAt) >= m.refreshBackoff()
+}
+
+// refreshBackoff returns the minimum time between the last regeneration and the next one.
+// The caller must hold m.mu.
+func (m *CredentialManager) refreshBackoff() time.Duration {
+	backoff := minRefreshInterval
+	for i := 0; i < m.failures && backoff < maxRefreshInterval; i++ {
+		backoff *= 2
+	}
+	return min(backoff, maxRefreshInterval)
+}
+
+// refresh regenerates the kubeconfig through the Rancher API unless the stale token has
+// already been replaced by a concurrent refresh, or the last regeneration was too recent.
+func (m *CredentialManager) refresh(ctx context.Context, staleToken, reason string) error {
+	m.refreshMu.Lock()
+	defer m.refreshMu.Unlock()
+
+	m.mu.RLock()
+	current, attemptedAt, failures, due := m.token, m.attemptedAt, m.failures, m.refreshDue()
+	m.mu.RUnlock()
+	if current != staleToken {
+		return nil
+	}
+	if !due {
+		return fmt.Errorf("last regeneration %s ago (%d consecutive failures), not refreshing again yet", time.Since(attemptedAt).Round(time.Second), failures)
+	}
+
+	logger.Infof("Regenerating kubeconfig for cluster %s (%s)...", m.clusterID, reason)
+	token, err := m.regenerate(ctx)
+
+	m.mu.Lock()
+	m.attemptedAt = time.Now()
+	if err != nil {
+		m.failures++
+	} else {
+		m.token, m.refreshedAt, m.failures = token, m.attemptedAt, 0
+	}
+	m.mu.Unlock()
+
+	if err != nil {
+		metrics.KubeconfigRefreshes.WithLabelValues(m.clusterName, reason, "failure").Inc()
+		return err
+	}
+	metrics.KubeconfigRefreshes.WithLabelValues(m.clusterName, reason, "success").Inc()
+	logger.Infof("Kubeconfig for cluster %s regenerated successfully.", m.clusterID)
+	return nil
+}
+
+// regenerate generates a new kubeconfig and returns its bearer token.
+func (m *CredentialManager) regenerate(ctx context.Context) (string, error) {
+	kubeconfigString, err := m.generate(ctx, m.clusterID)
+	if err != nil {
+		return "", err
+	}
+	kubeConfig, err := clientcmd.RESTConfigFromKubeConfig([]byte(kubeconfigString))
+	if err != nil {
+		return "", fmt.Errorf("parse regenerated kubeconfig: %w", err)
+	}
+	if kubeConfig.BearerToken == "" {
+		return "", fmt.Errorf("regenerated kubeconfig has no bearer token")
+	}
+	return kubeConfig.BearerToken, nil
+}
+
+// refreshingRoundTripper sets the managed bearer token on every request and retries a
+// request once with a regenerated token when the API server answers 401.
+type refreshingRoundTripper struct {
+	manager *CredentialManager
+	base    http.RoundTripper
+}
+
+func (rt *refreshingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	token := rt.manager.currentToken()
+	resp, err := rt.base.RoundTrip(withBearerToken(req, token))
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	// Regenerate outside the request context, which may be about to expire.
+	refreshCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := rt.manager.refresh(refreshCtx, token, "unauthorized"); err != nil {
+		logger.Warnf("Kubernetes API rejected credentials for cluster %s: %v", rt.manager.clusterID, err)
+		return resp, nil
+	}
+
+	retry := withBearerToken(req, rt.manager.currentToken())
+	if req.Body != nil {
+		if req.GetBody == nil {
+			return resp, nil
+		}
+		body, err := req.GetBody()
+		if err != nil {
+			return resp, nil
+		}
+		retry.Body = body
+	}
+	resp.Body.Close()
+	return rt.base.RoundTrip(retry)
+}
+
+func (rt *refreshingRoundTripper) WrappedRoundTripper() http.RoundTripper {
+	return rt.base
+}
+
+// withBearerToken returns a copy of the request carrying the given bearer token.
+func withBearerToken(req *http.Request, token string) *http.Request {
+	clone := req.Clone(req.Context())
+	clone.Header.Set("Authorization", "Bearer "+token)
+	return clone
+}
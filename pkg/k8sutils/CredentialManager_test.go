@@ -0,0 +1,101 @@
+package k8sutils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func testKubeconfig(token string) string {
+	return fmt.Sprintf(`apiVersion: v1
+kind: Config
+clusters:
+- name: c
+  cluster:
+    server: https://127.0.0.1:6443
+users:
+- name: u
+  user:
+    token: %s
+contexts:
+- name: c
+  context:
+    cluster: c
+    user: u
+current-context: c
+`, token)
+}
+
+func TestCredentialManagerBackoff(t *testing.T) {
+	var calls atomic.Int32
+	m := NewCredentialManager("c-1", "one", "old", 0)
+	m.generate = func(ctx context.Context, clusterID string) (string, error) {
+		calls.Add(1)
+		return "", errors.New("rancher unavailable")
+	}
+	m.attemptedAt = time.Now().Add(-time.Hour)
+
+	if err := m.refresh(context.Background(), "old", "unauthorized"); err == nil {
+		t.Fatal("refresh succeeded with a failing Rancher")
+	}
+	// A failed attempt starts the backoff for every reason.
+	for _, reason := range []string{"unauthorized", "ttl_expired"} {
+		if err := m.refresh(context.Background(), "old", reason); err == nil {
+			t.Errorf("refresh (%s) right after a failure succeeded", reason)
+		}
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("Rancher called %d times, want 1", got)
+	}
+
+	// The backoff doubles with each consecutive failure.
+	m.mu.Lock()
+	m.failures = 3
+	backoff := m.refreshBackoff()
+	m.failures = 100
+	capped := m.refreshBackoff()
+	m.mu.Unlock()
+	if backoff != 8*minRefreshInterval || capped != maxRefreshInterval {
+		t.Errorf("backoff after 3 failures = %s, after 100 = %s", backoff, capped)
+	}
+}
+
+func TestCredentialManagerServesOldTokenUntilRefreshed(t *testing.T) {
+	release := make(chan struct{})
+	var calls atomic.Int32
+	m := NewCredentialManager("c-1", "one", "old", time.Minute)
+	m.generate = func(ctx context.Context, clusterID string) (string, error) {
+		calls.Add(1)
+		<-release
+		return testKubeconfig("new"), nil
+	}
+	m.refreshedAt = time.Now().Add(-time.Hour)
+	m.attemptedAt = m.refreshedAt
+
+	// While the regeneration hangs, requests keep the old token and do not start another.
+	for i := 0; i < 10; i++ {
+		if token := m.currentToken(); token != "old" {
+			t.Fatalf("currentToken = %q during the refresh, want old", token)
+		}
+	}
+	close(release)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for m.currentToken() != "new" {
+		if time.Now().After(deadline) {
+			t.Fatal("token not replaced after the refresh completed")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("Rancher called %d times, want 1", got)
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.failures != 0 || m.refreshedAt != m.attemptedAt {
+		t.Errorf("state after success: failures %d, refreshedAt %s, attemptedAt %s", m.failures, m.refreshedAt, m.attemptedAt)
+	}
+}
@@ -6,13 +6,15 @@ import (
 	"time"
 
 	"github.com/supporttools/k8s-node-killer/pkg/config"
+	"github.com/supporttools/k8s-node-killer/pkg/logging"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/kubectl/pkg/drain"
 )
 
-func DrainNode(ctx context.Context, clientset *kubernetes.Clientset, node *v1.Node) error {
-	logger.Infof("Starting to drain node %s...", node.Name)
+func DrainNode(ctx context.Context, clientset kubernetes.Interface, node *v1.Node) error {
+	log := logging.FromContext(ctx)
+	log.Infof("Starting to drain node %s...", node.Name)
 
 	drainer := &drain.Helper{
 		Client:              clientset,
@@ -20,7 +22,7 @@ func DrainNode(ctx context.Context, clientset *kubernetes.Clientset, node *v1.No
 		IgnoreAllDaemonSets: true,
 		DeleteEmptyDirData:  true,
 		GracePeriodSeconds:  -1,
-		Timeout:             time.Duration(config.CFG.DrainTimeoutMinutes) * time.Minute,
+		Timeout:             time.Duration(config.FromContext(ctx).DrainTimeoutMinutes) * time.Minute,
 		Out:                 os.Stdout,
 		ErrOut:              os.Stderr,
 		Ctx:                 ctx,
@@ -28,10 +30,10 @@ func DrainNode(ctx context.Context, clientset *kubernetes.Clientset, node *v1.No
 
 	err := drain.RunNodeDrain(drainer, node.Name)
 	if err != nil {
-		logger.Errorf("Failed to drain node %s: %v", node.Name, err)
+		log.Errorf("Failed to drain node %s: %v", node.Name, err)
 		return err
 	}
 
-	logger.Infof("Successfully drained node %s.", node.Name)
+	log.Infof("Successfully drained node %s.", node.Name)
 	return nil
 }
@@ -2,22 +2,73 @@ package k8sutils
 
 import (
 	"context"
+	"fmt"
 
+	"github.com/supporttools/k8s-node-killer/pkg/config"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 )
 
-// GetConfig retrieves the Kubernetes configuration from Rancher
+// GetConfig retrieves the Kubernetes configuration using the configured auth mode:
+// the in-cluster service account, a kubeconfig file, or a kubeconfig generated by Rancher.
 func GetConfig(ctx context.Context) (*rest.Config, error) {
+	cfg := config.FromContext(ctx)
+	var (
+		kubeConfig *rest.Config
+		err        error
+	)
+
+	switch cfg.AuthMode {
+	case "in-cluster":
+		logger.Info("Using in-cluster service account configuration...")
+		kubeConfig, err = rest.InClusterConfig()
+	case "kubeconfig":
+		kubeConfig, err = getKubeconfigFileConfig(ctx)
+	case "rancher":
+		kubeConfig, err = getRancherConfig(ctx)
+	default:
+		err = fmt.Errorf("unknown auth mode %q", cfg.AuthMode)
+	}
+	if err != nil {
+		logger.Errorf("Failed to create Kubernetes client config: %v", err)
+		return nil, err
+	}
+
+	logger.Infof("Successfully configured Kubernetes client for %s (auth mode %s).", kubeConfig.Host, cfg.AuthMode)
+	return kubeConfig, nil
+}
+
+// getKubeconfigFileConfig loads the configuration from KUBECONFIG (or the default loading
+// rules when unset), using KUBE_CONTEXT when set.
+func getKubeconfigFileConfig(ctx context.Context) (*rest.Config, error) {
+	cfg := config.FromContext(ctx)
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	if cfg.Kubeconfig != "" {
+		loadingRules.ExplicitPath = cfg.Kubeconfig
+	}
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: cfg.KubeContext}
+
+	logger.Infof("Loading kubeconfig %q (context %q)...", cfg.Kubeconfig, cfg.KubeContext)
+	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, overrides).ClientConfig()
+}
+
+// getRancherConfig generates a kubeconfig for the configured cluster through the Rancher API.
+func getRancherConfig(ctx context.Context) (*rest.Config, error) {
 	logger.Info("Retrieving cluster ID...")
-	clusterID, err := GetClusterID()
+	clusterID, err := GetClusterID(ctx)
 	if err != nil {
 		logger.Errorf("Failed to get cluster ID: %v", err)
 		return nil, err
 	}
 	logger.Infof("Cluster ID obtained: %s", clusterID)
 
-	logger.Info("Generating kubeconfig for the cluster...")
+	return GetConfigForCluster(ctx, clusterID, config.FromContext(ctx).RancherCluster)
+}
+
+// GetConfigForCluster generates a kubeconfig for a Rancher downstream cluster. Each call
+// returns an independent configuration with its own credential manager.
+func GetConfigForCluster(ctx context.Context, clusterID, clusterName string) (*rest.Config, error) {
+	logger.Infof("Generating kubeconfig for cluster %s (%s)...", clusterName, clusterID)
 	kubeconfigString, err := GenerateKubeconfig(ctx, clusterID)
 	if err != nil {
 		logger.Errorf("Failed to generate kubeconfig: %v", err)
@@ -25,12 +76,15 @@ func GetConfig(ctx context.Context) (*rest.Config, error) {
 	}
 
 	logger.Info("Creating Kubernetes client configuration from kubeconfig...")
-	config, err := clientcmd.RESTConfigFromKubeConfig([]byte(kubeconfigString))
+	kubeConfig, err := clientcmd.RESTConfigFromKubeConfig([]byte(kubeconfigString))
 	if err != nil {
 		logger.Errorf("Failed to create Kubernetes client config from kubeconfig string: %v", err)
 		return nil, err
 	}
 
-	logger.Infof("Successfully retrieved and configured Kubernetes client for cluster ID: %s", clusterID)
-	return config, nil
+	// Rancher tokens expire or get rotated; keep the token fresh under the running clients.
+	if kubeConfig.BearerToken != "" {
+		NewCredentialManager(clusterID, clusterName, kubeConfig.BearerToken, config.FromContext(ctx).KubeconfigTTL).Install(kubeConfig)
+	}
+	return kubeConfig, nil
 }
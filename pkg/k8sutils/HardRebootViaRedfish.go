@@ -0,0 +1,98 @@
+package k8sutils
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/supporttools/k8s-node-killer/pkg/config"
+	"github.com/supporttools/k8s-node-killer/pkg/logging"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Node annotations used to locate and authenticate against a node's BMC.
+const (
+	BMCEndpointAnnotation = "k8s-node-killer.support.tools/bmc-endpoint"
+	BMCSystemIDAnnotation = "k8s-node-killer.support.tools/bmc-system-id"
+	BMCSecretAnnotation   = "k8s-node-killer.support.tools/bmc-credentials-secret"
+)
+
+// HardRebootViaRedfish power cycles a bare-metal node through its BMC using the Redfish API.
+func HardRebootViaRedfish(ctx context.Context, clientset kubernetes.Interface, nodeName string) bool {
+	cfg := config.FromContext(ctx)
+	log := logging.FromContext(ctx)
+	node, err := clientset.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+	if err != nil {
+		log.Printf("Failed to retrieve node %s: %v", nodeName, err)
+		return false
+	}
+
+	endpoint := node.Annotations[BMCEndpointAnnotation]
+	if endpoint == "" {
+		log.Printf("Node %s has no %s annotation, cannot reboot via Redfish.", nodeName, BMCEndpointAnnotation)
+		return false
+	}
+
+	username, password, err := getBMCCredentials(ctx, clientset, node.Annotations[BMCSecretAnnotation])
+	if err != nil {
+		log.Printf("Failed to load BMC credentials for node %s: %v", nodeName, err)
+		return false
+	}
+
+	client := NewRedfishClient(endpoint, username, password, cfg.InsecureSkipVerify)
+	if err := client.Login(ctx); err != nil {
+		log.Printf("Failed to open Redfish session with BMC %s of node %s: %v", endpoint, nodeName, err)
+		return false
+	}
+	defer func() {
+		if err := client.Logout(context.WithoutCancel(ctx)); err != nil {
+			log.Printf("Failed to close Redfish session with BMC %s: %v", endpoint, err)
+		}
+	}()
+
+	systemPath, err := client.SystemPath(ctx, node.Annotations[BMCSystemIDAnnotation])
+	if err != nil {
+		log.Printf("Failed to locate Redfish system for node %s: %v", nodeName, err)
+		return false
+	}
+
+	log.Printf("Sending %s request for node %s to BMC %s%s...", cfg.RedfishResetType, nodeName, endpoint, systemPath)
+	if err := client.Reset(ctx, systemPath, cfg.RedfishResetType); err != nil {
+		log.Printf("Failed to reset node %s via Redfish: %v", nodeName, err)
+		return false
+	}
+	if err := client.WaitForPowerOn(ctx, systemPath, 5*time.Second); err != nil {
+		log.Printf("Node %s did not power back on after %s: %v", nodeName, cfg.RedfishResetType, err)
+		return false
+	}
+	log.Printf("BMC %s accepted %s for node %s, waiting for the node to rejoin confirms the reboot.", endpoint, cfg.RedfishResetType, nodeName)
+	return true
+}
+
+// getBMCCredentials returns the BMC username and password from the referenced Secret,
+// falling back to the globally configured credentials when no Secret is referenced.
+// The reference is either "namespace/name" or just "name" in the configured namespace.
+func getBMCCredentials(ctx context.Context, clientset kubernetes.Interface, secretRef string) (string, string, error) {
+	cfg := config.FromContext(ctx)
+	if secretRef == "" {
+		return cfg.RedfishUsername, config.RedfishPassword(), nil
+	}
+
+	namespace, name := cfg.RedfishSecretNamespace, secretRef
+	if parts := strings.SplitN(secretRef, "/", 2); len(parts) == 2 {
+		namespace, name = parts[0], parts[1]
+	}
+
+	secret, err := clientset.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return "", "", fmt.Errorf("get secret %s/%s: %w", namespace, name, err)
+	}
+
+	username, password := string(secret.Data["username"]), string(secret.Data["password"])
+	if username == "" || password == "" {
+		return "", "", fmt.Errorf("secret %s/%s must contain username and password keys", namespace, name)
+	}
+	return username, password, nil
+}
@@ -0,0 +1,29 @@
+package k8sutils
+
+import v1 "k8s.io/api/core/v1"
+
+// defaultKubeletPort is the port the kubelet serves its API on when the node does not
+// report one.
+const defaultKubeletPort = 10250
+
+// NodeAddress returns the internal IP of a node, falling back to the first address it
+// reports, or an empty string when it reports none.
+func NodeAddress(node *v1.Node) string {
+	for _, addr := range node.Status.Addresses {
+		if addr.Type == v1.NodeInternalIP {
+			return addr.Address
+		}
+	}
+	if len(node.Status.Addresses) > 0 {
+		return node.Status.Addresses[0].Address
+	}
+	return ""
+}
+
+// kubeletPort returns the port the kubelet of a node serves its API on.
+func kubeletPort(node *v1.Node) int {
+	if port := int(node.Status.DaemonEndpoints.KubeletEndpoint.Port); port != 0 {
+		return port
+	}
+	return defaultKubeletPort
+}
@@ -0,0 +1,87 @@
+package k8sutils
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+
+	"github.com/supporttools/k8s-node-killer/pkg/config"
+	"github.com/supporttools/k8s-node-killer/pkg/health"
+)
+
+// probeTransport is shared by all probes. Each probe contacts a node once, so connections
+// are not kept alive.
+var probeTransport = &http.Transport{
+	// The kubelet serves a self-signed certificate, only its answering matters here.
+	TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+	DisableKeepAlives: true,
+}
+
+// ProbeNode checks whether a node answers directly, without going through the API server:
+// a TCP connection to its SSH port, the kubelet healthz endpoint and, when configured, a
+// custom HTTP endpoint. The kubelet counts as up when it answers at all, since healthz
+// usually requires credentials on the kubelet's API port.
+func ProbeNode(ctx context.Context, node *v1.Node, probe config.ProbeConfig) health.ProbeResult {
+	result := health.ProbeResult{ProbedAt: time.Now(), Address: NodeAddress(node)}
+	if result.Address == "" {
+		result.Errors = append(result.Errors, fmt.Sprintf("node %s reports no address", node.Name))
+		return result
+	}
+	fail := func(check string, err error) {
+		result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", check, err))
+	}
+
+	dialer := net.Dialer{Timeout: probe.Timeout}
+	if conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(result.Address, strconv.Itoa(probe.SSHPort))); err != nil {
+		fail("ssh", err)
+	} else {
+		conn.Close()
+		result.SSH = true
+	}
+
+	client := &http.Client{Timeout: probe.Timeout, Transport: probeTransport}
+	port := probe.KubeletPort
+	if port == 0 {
+		port = kubeletPort(node)
+	}
+	if err := probeHTTP(ctx, client, fmt.Sprintf("https://%s/healthz", net.JoinHostPort(result.Address, strconv.Itoa(port))), false); err != nil {
+		fail("kubelet", err)
+	} else {
+		result.Kubelet = true
+	}
+
+	if probe.HTTPURL != "" {
+		ok := true
+		if err := probeHTTP(ctx, client, strings.ReplaceAll(probe.HTTPURL, "{address}", result.Address), true); err != nil {
+			fail("http", err)
+			ok = false
+		}
+		result.HTTP = &ok
+	}
+	return result
+}
+
+// probeHTTP sends a GET request to url. With requireOK, only a 2xx response counts as an
+// answer.
+func probeHTTP(ctx context.Context, client *http.Client, url string, requireOK bool) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if requireOK && (resp.StatusCode < 200 || resp.StatusCode > 299) {
+		return fmt.Errorf("%s answered %s", url, resp.Status)
+	}
+	return nil
+}
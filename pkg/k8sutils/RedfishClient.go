@@ -0,0 +1,236 @@
+package k8sutils
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/supporttools/k8s-node-killer/pkg/tracing"
+)
+
+// RedfishClient talks to a single BMC over the Redfish API. It authenticates with a Redfish
+// session when the BMC offers one, and with HTTP basic auth otherwise.
+type RedfishClient struct {
+	Endpoint   string
+	Username   string
+	Password   string
+	HTTPClient *http.Client
+
+	sessionToken    string // X-Auth-Token of the current session, empty when using basic auth
+	sessionLocation string // Session resource, deleted by Logout
+}
+
+// powerOnTimeout bounds how long WaitForPowerOn waits for the system to report power on.
+const powerOnTimeout = 2 * time.Minute
+
+// redfishSystem is the subset of a Redfish ComputerSystem resource we care about.
+type redfishSystem struct {
+	PowerState string `json:"PowerState"`
+	Actions    struct {
+		Reset struct {
+			Target          string   `json:"target"`
+			AllowableValues []string `json:"ResetType@Redfish.AllowableValues"`
+		} `json:"#ComputerSystem.Reset"`
+	} `json:"Actions"`
+}
+
+// NewRedfishClient creates a client for the BMC at the given endpoint, e.g. https://10.0.0.5.
+func NewRedfishClient(endpoint, username, password string, insecureSkipVerify bool) *RedfishClient {
+	return &RedfishClient{
+		Endpoint: strings.TrimSuffix(endpoint, "/"),
+		Username: username,
+		Password: password,
+		HTTPClient: &http.Client{
+			Transport: tracing.Transport(&http.Transport{
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: insecureSkipVerify},
+			}),
+			Timeout: 30 * time.Second,
+		},
+	}
+}
+
+// Login opens a Redfish session. BMCs without a session service are used with basic auth,
+// which every request falls back to until a session is open.
+func (c *RedfishClient) Login(ctx context.Context) error {
+	body, err := json.Marshal(map[string]string{"UserName": c.Username, "Password": c.Password})
+	if err != nil {
+		return fmt.Errorf("encode session request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", c.Endpoint+"/redfish/v1/SessionService/Sessions", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("create HTTP request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("send HTTP request: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusMethodNotAllowed:
+		return nil // No session service, stay on basic auth
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		return fmt.Errorf("create session, status code %d", resp.StatusCode)
+	}
+	token := resp.Header.Get("X-Auth-Token")
+	if token == "" {
+		return fmt.Errorf("create session: BMC returned no X-Auth-Token")
+	}
+	c.sessionToken, c.sessionLocation = token, resp.Header.Get("Location")
+	return nil
+}
+
+// Logout closes the session opened by Login, if any. BMCs allow few concurrent sessions, so
+// sessions must not be left to expire.
+func (c *RedfishClient) Logout(ctx context.Context) error {
+	if c.sessionToken == "" {
+		return nil
+	}
+	location := strings.TrimPrefix(c.sessionLocation, c.Endpoint)
+	err := error(nil)
+	if location != "" {
+		err = c.do(ctx, "DELETE", location, nil, nil)
+	}
+	c.sessionToken, c.sessionLocation = "", ""
+	return err
+}
+
+// SystemPath returns the path of the ComputerSystem to act on. If systemID is empty,
+// the first member of the Systems collection is used.
+func (c *RedfishClient) SystemPath(ctx context.Context, systemID string) (string, error) {
+	if systemID != "" {
+		return "/redfish/v1/Systems/" + systemID, nil
+	}
+
+	var collection struct {
+		Members []struct {
+			ODataID string `json:"@odata.id"`
+		} `json:"Members"`
+	}
+	if err := c.do(ctx, "GET", "/redfish/v1/Systems", nil, &collection); err != nil {
+		return "", fmt.Errorf("list systems: %w", err)
+	}
+	if len(collection.Members) == 0 {
+		return "", fmt.Errorf("no systems found on BMC %s", c.Endpoint)
+	}
+	return collection.Members[0].ODataID, nil
+}
+
+// PowerState returns the current power state (On, Off, ...) of the system.
+func (c *RedfishClient) PowerState(ctx context.Context, systemPath string) (string, error) {
+	var system redfishSystem
+	if err := c.do(ctx, "GET", systemPath, nil, &system); err != nil {
+		return "", fmt.Errorf("get system: %w", err)
+	}
+	return system.PowerState, nil
+}
+
+// WaitForPowerOn polls the power state of the system until it reports On, so a reset that
+// left the system off is noticed. Reporting On does not prove a reset happened: most BMCs
+// report On throughout a restart, so only the node rejoining the cluster confirms it.
+func (c *RedfishClient) WaitForPowerOn(ctx context.Context, systemPath string, interval time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, powerOnTimeout)
+	defer cancel()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	lastState := ""
+	for {
+		state, err := c.PowerState(ctx, systemPath)
+		if err == nil {
+			if state == "On" {
+				return nil
+			}
+			lastState = state
+		}
+		select {
+		case <-ctx.Done():
+			if lastState == "" && err != nil {
+				return fmt.Errorf("system did not report power on: %w", err)
+			}
+			return fmt.Errorf("system did not report power on, last state %q", lastState)
+		case <-ticker.C:
+		}
+	}
+}
+
+// Reset issues a ComputerSystem.Reset action with the given reset type (ForceRestart,
+// GracefulRestart or PowerCycle). It fails without resetting when the BMC does not allow
+// that type, rather than sending a harsher one than the operator chose.
+func (c *RedfishClient) Reset(ctx context.Context, systemPath, resetType string) error {
+	var system redfishSystem
+	if err := c.do(ctx, "GET", systemPath, nil, &system); err != nil {
+		return fmt.Errorf("get system: %w", err)
+	}
+	if allowed := system.Actions.Reset.AllowableValues; len(allowed) > 0 && !slices.Contains(allowed, resetType) {
+		return fmt.Errorf("reset type %s not supported by BMC, allowed values: %v", resetType, allowed)
+	}
+
+	target := system.Actions.Reset.Target
+	if target == "" {
+		target = systemPath + "/Actions/ComputerSystem.Reset"
+	}
+
+	body, err := json.Marshal(map[string]string{"ResetType": resetType})
+	if err != nil {
+		return fmt.Errorf("encode reset request: %w", err)
+	}
+	if err := c.do(ctx, "POST", target, body, nil); err != nil {
+		return fmt.Errorf("reset system: %w", err)
+	}
+	return nil
+}
+
+// do sends a request to the BMC and decodes the JSON response into out when out is non-nil.
+func (c *RedfishClient) do(ctx context.Context, method, path string, body []byte, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.Endpoint+path, reader)
+	if err != nil {
+		return fmt.Errorf("create HTTP request: %w", err)
+	}
+	if c.sessionToken != "" {
+		req.Header.Set("X-Auth-Token", c.sessionToken)
+	} else {
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("send HTTP request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("read response body: %w", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s %s, status code %d: %s", method, path, resp.StatusCode, string(respBody))
+	}
+
+	if out != nil && len(respBody) > 0 {
+		if err := json.Unmarshal(respBody, out); err != nil {
+			return fmt.Errorf("decode JSON response: %w", err)
+		}
+	}
+	return nil
+}
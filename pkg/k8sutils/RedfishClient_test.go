@@ -0,0 +1,269 @@
+package k8sutils
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// mockBMC is a minimal Redfish service with a single system.
+type mockBMC struct {
+	sessions     bool     // Whether the session service exists
+	allowed      []string // Reset types the system allows
+	resetStatus  int      // Status of reset requests; 204 when zero
+	powerStates  []string // Power states reported in order, the last one repeated
+	token        string
+	mu           sync.Mutex
+	resets       []string
+	basicAuth    int
+	tokenAuth    int
+	deleted      bool
+	unauthorized bool // Reject every credential
+}
+
+func (b *mockBMC) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if r.URL.Path == "/redfish/v1/SessionService/Sessions" && r.Method == "POST" {
+		if !b.sessions {
+			http.NotFound(w, r)
+			return
+		}
+		var creds map[string]string
+		json.NewDecoder(r.Body).Decode(&creds)
+		if b.unauthorized || creds["UserName"] != "admin" || creds["Password"] != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		b.token = "token-1"
+		w.Header().Set("X-Auth-Token", b.token)
+		w.Header().Set("Location", "/redfish/v1/SessionService/Sessions/1")
+		w.WriteHeader(http.StatusCreated)
+		return
+	}
+
+	switch user, pass, ok := r.BasicAuth(); {
+	case b.token != "" && r.Header.Get("X-Auth-Token") == b.token && !b.unauthorized:
+		b.tokenAuth++
+	case ok && user == "admin" && pass == "secret" && !b.unauthorized:
+		b.basicAuth++
+	default:
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	switch {
+	case r.URL.Path == "/redfish/v1/SessionService/Sessions/1" && r.Method == "DELETE":
+		b.deleted = true
+		b.token = ""
+		w.WriteHeader(http.StatusNoContent)
+	case r.URL.Path == "/redfish/v1/Systems" && r.Method == "GET":
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"Members": []map[string]string{{"@odata.id": "/redfish/v1/Systems/1"}},
+		})
+	case r.URL.Path == "/redfish/v1/Systems/1" && r.Method == "GET":
+		state := "On"
+		if len(b.powerStates) > 0 {
+			state = b.powerStates[0]
+			if len(b.powerStates) > 1 {
+				b.powerStates = b.powerStates[1:]
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"PowerState": state,
+			"Actions": map[string]interface{}{
+				"#ComputerSystem.Reset": map[string]interface{}{
+					"target":                            "/redfish/v1/Systems/1/Actions/ComputerSystem.Reset",
+					"ResetType@Redfish.AllowableValues": b.allowed,
+				},
+			},
+		})
+	case r.URL.Path == "/redfish/v1/Systems/1/Actions/ComputerSystem.Reset" && r.Method == "POST":
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		b.resets = append(b.resets, body["ResetType"])
+		if b.resetStatus != 0 {
+			w.WriteHeader(b.resetStatus)
+			w.Write([]byte(`{"error":{"message":"reset failed"}}`))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func newTestRedfishClient(server *httptest.Server, password string) *RedfishClient {
+	return &RedfishClient{
+		Endpoint:   server.URL,
+		Username:   "admin",
+		Password:   password,
+		HTTPClient: server.Client(),
+	}
+}
+
+func TestRedfishSessionAuth(t *testing.T) {
+	bmc := &mockBMC{sessions: true, allowed: []string{"ForceRestart"}}
+	server := httptest.NewTLSServer(bmc)
+	defer server.Close()
+	client := newTestRedfishClient(server, "secret")
+	ctx := context.Background()
+
+	if err := client.Login(ctx); err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	systemPath, err := client.SystemPath(ctx, "")
+	if err != nil {
+		t.Fatalf("SystemPath: %v", err)
+	}
+	if err := client.Reset(ctx, systemPath, "ForceRestart"); err != nil {
+		t.Fatalf("Reset: %v", err)
+	}
+	if err := client.Logout(ctx); err != nil {
+		t.Fatalf("Logout: %v", err)
+	}
+
+	if bmc.basicAuth != 0 {
+		t.Errorf("%d requests used basic auth despite an open session", bmc.basicAuth)
+	}
+	if bmc.tokenAuth == 0 {
+		t.Errorf("no request used the session token")
+	}
+	if !bmc.deleted {
+		t.Errorf("session was not deleted on logout")
+	}
+}
+
+func TestRedfishBasicAuthFallback(t *testing.T) {
+	bmc := &mockBMC{allowed: []string{"ForceRestart"}}
+	server := httptest.NewTLSServer(bmc)
+	defer server.Close()
+	client := newTestRedfishClient(server, "secret")
+	ctx := context.Background()
+
+	if err := client.Login(ctx); err != nil {
+		t.Fatalf("Login without session service: %v", err)
+	}
+	if err := client.Reset(ctx, "/redfish/v1/Systems/1", "ForceRestart"); err != nil {
+		t.Fatalf("Reset: %v", err)
+	}
+	if err := client.Logout(ctx); err != nil {
+		t.Fatalf("Logout: %v", err)
+	}
+	if bmc.basicAuth == 0 || bmc.tokenAuth != 0 {
+		t.Errorf("basic auth requests = %d, token requests = %d; want basic auth only", bmc.basicAuth, bmc.tokenAuth)
+	}
+}
+
+func TestRedfishResetType(t *testing.T) {
+	tests := []struct {
+		name      string
+		allowed   []string
+		requested string
+		wantErr   bool
+	}{
+		{name: "requested type allowed", allowed: []string{"ForceRestart", "PowerCycle"}, requested: "PowerCycle"},
+		{name: "no allowable values advertised", requested: "PowerCycle"},
+		{name: "graceful restart not allowed", allowed: []string{"On", "ForceOff", "ForceRestart"}, requested: "GracefulRestart", wantErr: true},
+		{name: "no reboot type allowed", allowed: []string{"On", "ForceOff"}, requested: "ForceRestart", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bmc := &mockBMC{allowed: tt.allowed}
+			server := httptest.NewTLSServer(bmc)
+			defer server.Close()
+			client := newTestRedfishClient(server, "secret")
+
+			err := client.Reset(context.Background(), "/redfish/v1/Systems/1", tt.requested)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("Reset succeeded, want an error")
+				}
+				if len(bmc.resets) != 0 {
+					t.Errorf("reset requests sent despite the error: %v", bmc.resets)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Reset: %v", err)
+			}
+			if len(bmc.resets) != 1 || bmc.resets[0] != tt.requested {
+				t.Errorf("Reset sent %v, want %s", bmc.resets, tt.requested)
+			}
+		})
+	}
+}
+
+func TestRedfishErrors(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("session rejected", func(t *testing.T) {
+		server := httptest.NewTLSServer(&mockBMC{sessions: true})
+		defer server.Close()
+		if err := newTestRedfishClient(server, "wrong").Login(ctx); err == nil || !strings.Contains(err.Error(), "401") {
+			t.Errorf("Login error = %v, want a 401 error", err)
+		}
+	})
+
+	t.Run("basic auth rejected", func(t *testing.T) {
+		server := httptest.NewTLSServer(&mockBMC{})
+		defer server.Close()
+		client := newTestRedfishClient(server, "wrong")
+		if _, err := client.SystemPath(ctx, ""); err == nil || !strings.Contains(err.Error(), "401") {
+			t.Errorf("SystemPath error = %v, want a 401 error", err)
+		}
+	})
+
+	t.Run("reset fails", func(t *testing.T) {
+		server := httptest.NewTLSServer(&mockBMC{allowed: []string{"ForceRestart"}, resetStatus: http.StatusInternalServerError})
+		defer server.Close()
+		err := newTestRedfishClient(server, "secret").Reset(ctx, "/redfish/v1/Systems/1", "ForceRestart")
+		if err == nil || !strings.Contains(err.Error(), "reset failed") {
+			t.Errorf("Reset error = %v, want the BMC's error message", err)
+		}
+	})
+
+	t.Run("unknown system", func(t *testing.T) {
+		server := httptest.NewTLSServer(&mockBMC{})
+		defer server.Close()
+		if _, err := newTestRedfishClient(server, "secret").PowerState(ctx, "/redfish/v1/Systems/2"); err == nil {
+			t.Errorf("PowerState of an unknown system succeeded")
+		}
+	})
+
+	t.Run("BMC unreachable", func(t *testing.T) {
+		server := httptest.NewTLSServer(&mockBMC{})
+		client := newTestRedfishClient(server, "secret")
+		server.Close()
+		if err := client.Login(ctx); err == nil {
+			t.Errorf("Login to a closed server succeeded")
+		}
+	})
+}
+
+func TestRedfishWaitForPowerOn(t *testing.T) {
+	bmc := &mockBMC{powerStates: []string{"Off", "PoweringOn", "On"}}
+	server := httptest.NewTLSServer(bmc)
+	defer server.Close()
+	client := newTestRedfishClient(server, "secret")
+
+	if err := client.WaitForPowerOn(context.Background(), "/redfish/v1/Systems/1", time.Millisecond); err != nil {
+		t.Fatalf("WaitForPowerOn: %v", err)
+	}
+	if len(bmc.powerStates) != 1 {
+		t.Errorf("power state polled until %v, want it polled until On", bmc.powerStates)
+	}
+
+	bmc.powerStates = []string{"Off"}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := client.WaitForPowerOn(ctx, "/redfish/v1/Systems/1", time.Millisecond); err == nil || !strings.Contains(err.Error(), `"Off"`) {
+		t.Errorf("WaitForPowerOn error = %v, want the last power state", err)
+	}
+}
@@ -0,0 +1,219 @@
+package k8sutils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/supporttools/k8s-node-killer/pkg/config"
+	"github.com/supporttools/k8s-node-killer/pkg/health"
+	"github.com/supporttools/k8s-node-killer/pkg/logging"
+	"github.com/supporttools/k8s-node-killer/pkg/metrics"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// Cluster API annotations and labels used to resolve and remediate machines.
+const (
+	MachineAnnotation          = "cluster.x-k8s.io/machine"
+	RemediateMachineAnnotation = "cluster.x-k8s.io/remediate-machine"
+)
+
+var machineGVR = schema.GroupVersionResource{Group: "cluster.x-k8s.io", Version: "v1beta1", Resource: "machines"}
+
+// machinePollInterval is how often the Machines are listed while waiting for a replacement.
+var machinePollInterval = 10 * time.Second
+
+// machineRemediation is a Machine remediated by RemediateMachineViaClusterAPI, whose
+// replacement WaitForMachineReplacement waits for.
+type machineRemediation struct {
+	machine *unstructured.Unstructured
+	owner   *metav1.OwnerReference
+	started time.Time
+}
+
+// remediatedMachines holds the machineRemediation of each node, keyed by cluster/node.
+var remediatedMachines sync.Map
+
+// RemediateMachineViaClusterAPI remediates the Cluster API Machine backing a node, either by
+// deleting it or by annotating it for MachineHealthCheck remediation. The step is verified by
+// WaitForMachineReplacement.
+func RemediateMachineViaClusterAPI(ctx context.Context, clientset kubernetes.Interface, nodeName string) bool {
+	log := logging.FromContext(ctx)
+	node, err := clientset.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+	if err != nil {
+		log.Printf("Failed to retrieve node %s: %v", nodeName, err)
+		return false
+	}
+
+	client, err := clusterAPIClient(ctx)
+	if err != nil {
+		log.Errorf("Failed to create Cluster API client: %v", err)
+		return false
+	}
+	remediation, err := remediateMachine(ctx, client.Resource(machineGVR).Namespace(config.FromContext(ctx).CAPINamespace), node)
+	if err != nil {
+		log.Errorf("Failed to remediate the machine of node %s: %v", nodeName, err)
+		return false
+	}
+	remediatedMachines.Store(health.ClusterFromContext(ctx)+"/"+nodeName, remediation)
+	return true
+}
+
+// WaitForMachineReplacement waits for the owner of the Machine remediated for a node to
+// create a replacement that reaches the Running phase with a node reference. It returns
+// false when this does not happen within the replacement timeout.
+func WaitForMachineReplacement(ctx context.Context, clientset kubernetes.Interface, node *v1.Node) bool {
+	log := logging.FromContext(ctx)
+	value, ok := remediatedMachines.LoadAndDelete(health.ClusterFromContext(ctx) + "/" + node.Name)
+	if !ok {
+		log.Errorf("No machine of node %s was remediated, nothing to wait for.", node.Name)
+		return false
+	}
+	client, err := clusterAPIClient(ctx)
+	if err != nil {
+		log.Errorf("Failed to create Cluster API client: %v", err)
+		return false
+	}
+	return waitForReplacementMachine(ctx, client.Resource(machineGVR).Namespace(config.FromContext(ctx).CAPINamespace), value.(*machineRemediation))
+}
+
+// remediateMachine deletes or annotates the Machine of a node, depending on the configured
+// remediation mode. Machines without an owner are left alone, as nothing would replace them.
+func remediateMachine(ctx context.Context, machines dynamic.ResourceInterface, node *v1.Node) (*machineRemediation, error) {
+	cfg := config.FromContext(ctx)
+	log := logging.FromContext(ctx)
+	machine, err := findMachineForNode(ctx, machines, node)
+	if err != nil {
+		return nil, fmt.Errorf("resolve machine: %w", err)
+	}
+	owner := metav1.GetControllerOf(machine)
+	if owner == nil {
+		return nil, fmt.Errorf("machine %s has no owner to replace it", machine.GetName())
+	}
+	log.Infof("Resolved node %s to machine %s/%s (owned by %s %s).", node.Name, cfg.CAPINamespace, machine.GetName(), owner.Kind, owner.Name)
+
+	remediation := &machineRemediation{machine: machine, owner: owner, started: time.Now()}
+	switch cfg.CAPIRemediationMode {
+	case "annotate":
+		patch, _ := json.Marshal(map[string]interface{}{
+			"metadata": map[string]interface{}{
+				"annotations": map[string]string{RemediateMachineAnnotation: ""},
+			},
+		})
+		if _, err := machines.Patch(ctx, machine.GetName(), types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+			return nil, fmt.Errorf("annotate machine %s: %w", machine.GetName(), err)
+		}
+		log.Infof("Annotated machine %s for MachineHealthCheck remediation.", machine.GetName())
+	default:
+		if err := machines.Delete(ctx, machine.GetName(), metav1.DeleteOptions{}); err != nil {
+			return nil, fmt.Errorf("delete machine %s: %w", machine.GetName(), err)
+		}
+		log.Infof("Deleted machine %s.", machine.GetName())
+	}
+	return remediation, nil
+}
+
+// waitForReplacementMachine waits for a Machine created by the owner of a remediated one
+// after the remediation started to reach the Running phase with a node reference.
+func waitForReplacementMachine(ctx context.Context, machines dynamic.ResourceInterface, remediation *machineRemediation) bool {
+	cfg := config.FromContext(ctx)
+	log := logging.FromContext(ctx)
+	old, owner := remediation.machine, remediation.owner
+	log.Infof("Waiting up to %s for %s %s to replace machine %s...", cfg.ReplacementTimeout, owner.Kind, owner.Name, old.GetName())
+
+	ctx, cancel := context.WithTimeout(ctx, cfg.ReplacementTimeout)
+	defer cancel()
+	ticker := time.NewTicker(machinePollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				log.Printf("Stopped waiting for the replacement of machine %s: %v", old.GetName(), ctx.Err())
+				return false
+			}
+			metrics.ReplacementTimeouts.WithLabelValues(health.ClusterFromContext(ctx), owner.Name).Inc()
+			log.Errorf("%s %s did not replace machine %s within %s.", owner.Kind, owner.Name, old.GetName(), cfg.ReplacementTimeout)
+			return false
+		case <-ticker.C:
+			list, err := machines.List(ctx, metav1.ListOptions{})
+			if err != nil {
+				log.Warnf("Failed to list machines while waiting for the replacement of %s: %v", old.GetName(), err)
+				continue
+			}
+			for i := range list.Items {
+				machine := &list.Items[i]
+				ref := metav1.GetControllerOf(machine)
+				if machine.GetUID() == old.GetUID() || ref == nil || ref.UID != owner.UID ||
+					machine.GetCreationTimestamp().Time.Before(remediation.started.Add(-time.Second)) {
+					continue
+				}
+				phase, _, _ := unstructured.NestedString(machine.Object, "status", "phase")
+				nodeRef, _, _ := unstructured.NestedString(machine.Object, "status", "nodeRef", "name")
+				if phase != "Running" || nodeRef == "" {
+					log.Infof("Replacement machine %s is %q, waiting for it to run a node.", machine.GetName(), phase)
+					continue
+				}
+				elapsed := time.Since(remediation.started)
+				metrics.ReplacementTime.WithLabelValues(health.ClusterFromContext(ctx), owner.Name).Observe(elapsed.Seconds())
+				log.Infof("Machine %s replaced machine %s after %s and runs node %s.", machine.GetName(), old.GetName(), elapsed.Round(time.Second), nodeRef)
+				return true
+			}
+		}
+	}
+}
+
+// clusterAPIClient returns a dynamic client for the management cluster holding the Cluster
+// API objects, configured by CAPI_KUBECONFIG. The workload cluster is never used: it does not
+// hold the Machines of its own nodes.
+func clusterAPIClient(ctx context.Context) (dynamic.Interface, error) {
+	cfg := config.FromContext(ctx)
+	if cfg.CAPIKubeconfig == "" {
+		return nil, fmt.Errorf("capiKubeconfig is not set")
+	}
+	capiConfig, err := clientcmd.BuildConfigFromFlags("", cfg.CAPIKubeconfig)
+	if err != nil {
+		return nil, fmt.Errorf("load kubeconfig %s: %w", cfg.CAPIKubeconfig, err)
+	}
+	return dynamic.NewForConfig(capiConfig)
+}
+
+// findMachineForNode resolves the Machine for a node through the cluster.x-k8s.io/machine
+// annotation, falling back to matching spec.providerID.
+func findMachineForNode(ctx context.Context, machines dynamic.ResourceInterface, node *v1.Node) (*unstructured.Unstructured, error) {
+	log := logging.FromContext(ctx)
+	if name := node.Annotations[MachineAnnotation]; name != "" {
+		machine, err := machines.Get(ctx, name, metav1.GetOptions{})
+		if err == nil {
+			return machine, nil
+		}
+		log.Warnf("Failed to get machine %s from node annotation: %v", name, err)
+	}
+
+	if node.Spec.ProviderID == "" {
+		return nil, fmt.Errorf("node has no %s annotation and no providerID", MachineAnnotation)
+	}
+
+	list, err := machines.List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("list machines: %w", err)
+	}
+	for i := range list.Items {
+		providerID, _, _ := unstructured.NestedString(list.Items[i].Object, "spec", "providerID")
+		if providerID == node.Spec.ProviderID {
+			return &list.Items[i], nil
+		}
+	}
+	return nil, fmt.Errorf("no machine found with providerID %s", node.Spec.ProviderID)
+}
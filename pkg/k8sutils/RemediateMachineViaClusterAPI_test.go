@@ -0,0 +1,141 @@
+package k8sutils
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	"github.com/supporttools/k8s-node-killer/pkg/config"
+)
+
+const testCAPINamespace = "capi"
+
+// testMachine returns a Machine controlled by the given MachineSet.
+func testMachine(name, uid, machineSet, phase, nodeRef string, created time.Time) *unstructured.Unstructured {
+	machine := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "cluster.x-k8s.io/v1beta1",
+		"kind":       "Machine",
+		"spec":       map[string]interface{}{"providerID": "test://" + name},
+		"status":     map[string]interface{}{"phase": phase},
+	}}
+	machine.SetName(name)
+	machine.SetNamespace(testCAPINamespace)
+	machine.SetUID(types.UID(uid))
+	machine.SetCreationTimestamp(metav1.NewTime(created))
+	controller := true
+	machine.SetOwnerReferences([]metav1.OwnerReference{{
+		APIVersion: "cluster.x-k8s.io/v1beta1", Kind: "MachineSet", Name: machineSet, UID: types.UID("uid-" + machineSet), Controller: &controller,
+	}})
+	if nodeRef != "" {
+		unstructured.SetNestedField(machine.Object, nodeRef, "status", "nodeRef", "name")
+	}
+	return machine
+}
+
+func TestRemediateMachineWaitsForReplacement(t *testing.T) {
+	previous := machinePollInterval
+	machinePollInterval = time.Millisecond
+	t.Cleanup(func() { machinePollInterval = previous })
+
+	tests := []struct {
+		mode         string
+		replacedBy   string // MachineSet creating a machine on remediation
+		wantReplaced bool
+	}{
+		{mode: "delete", replacedBy: "workers", wantReplaced: true},
+		{mode: "annotate", replacedBy: "workers", wantReplaced: true},
+		{mode: "delete", replacedBy: "other"},
+		{mode: "annotate", replacedBy: "other"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode+" replaced by "+tt.replacedBy, func(t *testing.T) {
+			cfg, err := config.Load([]byte("authMode: kubeconfig\nharvesterKey: key\nrancherToken: token\ncapiNamespace: " + testCAPINamespace + "\ncapiRemediationMode: " + tt.mode + "\nreplacementTimeout: 200ms\n"))
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			ctx := config.WithSnapshot(context.Background(), &cfg)
+
+			old := testMachine("worker-a", "uid-a", "workers", "Running", "node-1", time.Now().Add(-24*time.Hour))
+			client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+				map[schema.GroupVersionResource]string{machineGVR: "MachineList"}, old)
+			machines := client.Resource(machineGVR).Namespace(testCAPINamespace)
+
+			// The owner creates the replacement when the old machine is remediated; it only
+			// runs a node after a few polls.
+			created := false
+			replace := func(k8stesting.Action) (bool, runtime.Object, error) {
+				if !created {
+					created = true
+					replacement := testMachine("worker-b", "uid-b", tt.replacedBy, "Provisioning", "", time.Now())
+					if err := client.Tracker().Create(machineGVR, replacement, testCAPINamespace); err != nil {
+						t.Errorf("create replacement: %v", err)
+					}
+				}
+				return false, nil, nil
+			}
+			client.PrependReactor("delete", "machines", replace)
+			client.PrependReactor("patch", "machines", replace)
+			lists := 0
+			client.PrependReactor("list", "machines", func(k8stesting.Action) (bool, runtime.Object, error) {
+				if lists++; lists == 3 && created {
+					running := testMachine("worker-b", "uid-b", tt.replacedBy, "Running", "node-2", time.Now())
+					if err := client.Tracker().Update(machineGVR, running, testCAPINamespace); err != nil {
+						t.Errorf("update replacement: %v", err)
+					}
+				}
+				return false, nil, nil
+			})
+
+			node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1", Annotations: map[string]string{MachineAnnotation: "worker-a"}}}
+			remediation, err := remediateMachine(ctx, machines, node)
+			if err != nil {
+				t.Fatalf("remediateMachine: %v", err)
+			}
+			if got := waitForReplacementMachine(ctx, machines, remediation); got != tt.wantReplaced {
+				t.Errorf("replaced = %t, want %t", got, tt.wantReplaced)
+			}
+
+			remaining, err := machines.Get(ctx, "worker-a", metav1.GetOptions{})
+			switch {
+			case tt.mode == "delete" && err == nil:
+				t.Error("old machine not deleted")
+			case tt.mode == "annotate" && err != nil:
+				t.Errorf("old machine gone in annotate mode: %v", err)
+			case tt.mode == "annotate":
+				if _, ok := remaining.GetAnnotations()[RemediateMachineAnnotation]; !ok {
+					t.Errorf("old machine not annotated, annotations %v", remaining.GetAnnotations())
+				}
+			}
+		})
+	}
+}
+
+func TestRemediateMachineWithoutOwner(t *testing.T) {
+	cfg, err := config.Load([]byte("authMode: kubeconfig\nharvesterKey: key\nrancherToken: token\ncapiNamespace: " + testCAPINamespace + "\n"))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	ctx := config.WithSnapshot(context.Background(), &cfg)
+	old := testMachine("worker-a", "uid-a", "workers", "Running", "node-1", time.Now())
+	old.SetOwnerReferences(nil)
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{machineGVR: "MachineList"}, old)
+	machines := client.Resource(machineGVR).Namespace(testCAPINamespace)
+
+	node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1"}, Spec: v1.NodeSpec{ProviderID: "test://worker-a"}}
+	if _, err := remediateMachine(ctx, machines, node); err == nil {
+		t.Fatal("remediated a machine nothing replaces")
+	}
+	if _, err := machines.Get(ctx, "worker-a", metav1.GetOptions{}); err != nil {
+		t.Errorf("machine without owner deleted: %v", err)
+	}
+}
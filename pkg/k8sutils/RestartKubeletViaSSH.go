@@ -0,0 +1,44 @@
+package k8sutils
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/supporttools/k8s-node-killer/pkg/config"
+	"github.com/supporttools/k8s-node-killer/pkg/logging"
+)
+
+// RestartKubeletViaSSH restarts the kubelet of a node by SSHing into it and running the
+// configured restart command, for nodes whose host is up but whose kubelet is not.
+func RestartKubeletViaSSH(ctx context.Context, clientset kubernetes.Interface, nodeName string) bool {
+	log := logging.FromContext(ctx)
+	node, err := clientset.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+	if err != nil {
+		log.Printf("Failed to retrieve node %s: %v", nodeName, err)
+		return false
+	}
+
+	nodeIP := NodeAddress(node)
+	if nodeIP == "" {
+		log.Printf("No IP address found for node %s, cannot proceed with SSH.", nodeName)
+		return false
+	}
+	cmd := exec.CommandContext(ctx, "ssh", "-o", "StrictHostKeyChecking=no", "-o", "UserKnownHostsFile=/dev/null", "root@"+nodeIP, config.FromContext(ctx).KubeletRestartCommand)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	log.Printf("Attempting to restart the kubelet of node %s via SSH at IP %s...", nodeName, nodeIP)
+	if err := cmd.Run(); err != nil {
+		log.Printf("Failed to restart the kubelet of node %s: %v", nodeName, err)
+		log.Printf("SSH command error output: %s", stderr.String())
+		return false
+	}
+	log.Printf("Kubelet of node %s restarted. SSH output: %s", nodeName, stdout.String())
+	return true
+}
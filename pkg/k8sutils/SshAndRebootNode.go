@@ -7,18 +7,21 @@ import (
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
+
+	"github.com/supporttools/k8s-node-killer/pkg/logging"
 )
 
 // SshAndRebootNode reboots a node by SSHing into it and running the reboot command.
-func SshAndRebootNode(ctx context.Context, clientset *kubernetes.Clientset, nodeName string) bool {
+func SshAndRebootNode(ctx context.Context, clientset kubernetes.Interface, nodeName string) bool {
+	log := logging.FromContext(ctx)
 	node, err := clientset.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
 	if err != nil {
-		logger.Printf("Failed to retrieve node %s: %v", nodeName, err)
+		log.Printf("Failed to retrieve node %s: %v", nodeName, err)
 		return false
 	}
 
 	if len(node.Status.Addresses) < 1 {
-		logger.Printf("No IP address found for node %s, cannot proceed with SSH.", nodeName)
+		log.Printf("No IP address found for node %s, cannot proceed with SSH.", nodeName)
 		return false
 	}
 	nodeIP := node.Status.Addresses[0].Address // Assuming the first address is always the correct one.
@@ -28,12 +31,12 @@ func SshAndRebootNode(ctx context.Context, clientset *kubernetes.Clientset, node
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
 
-	logger.Printf("Attempting to reboot node %s via SSH at IP %s...", nodeName, nodeIP)
+	log.Printf("Attempting to reboot node %s via SSH at IP %s...", nodeName, nodeIP)
 	if err := cmd.Run(); err != nil {
-		logger.Printf("Failed to SSH and reboot node %s: %v", nodeName, err)
-		logger.Printf("SSH command output: %s", stdout.String())
-		logger.Printf("SSH command error output: %s", stderr.String())
+		log.Printf("Failed to SSH and reboot node %s: %v", nodeName, err)
+		log.Printf("SSH command output: %s", stdout.String())
+		log.Printf("SSH command error output: %s", stderr.String())
 	}
-	logger.Printf("Node %s rebooted successfully. SSH output: %s", nodeName, stdout.String())
+	log.Printf("Node %s rebooted successfully. SSH output: %s", nodeName, stdout.String())
 	return true
 }
@@ -7,11 +7,14 @@ import (
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/kubectl/pkg/drain"
+
+	"github.com/supporttools/k8s-node-killer/pkg/logging"
 )
 
 // uncordonNode uncordons the given node.
-func UncordonNode(ctx context.Context, clientset *kubernetes.Clientset, node *v1.Node) error {
-	logger.Printf("Starting to uncordon node %s.", node.Name)
+func UncordonNode(ctx context.Context, clientset kubernetes.Interface, node *v1.Node) error {
+	log := logging.FromContext(ctx)
+	log.Printf("Starting to uncordon node %s.", node.Name)
 
 	// Create a drain helper with standard output and error output configurations
 	drainer := &drain.Helper{
@@ -22,13 +25,13 @@ func UncordonNode(ctx context.Context, clientset *kubernetes.Clientset, node *v1
 	}
 
 	// Attempt to uncordon the node
-	logger.Printf("Attempting to uncordon node %s...", node.Name)
+	log.Printf("Attempting to uncordon node %s...", node.Name)
 	if err := drain.RunCordonOrUncordon(drainer, node, false); err != nil {
-		logger.Printf("Failed to uncordon node %s: %v", node.Name, err)
+		log.Printf("Failed to uncordon node %s: %v", node.Name, err)
 		return err
 	}
 
 	// Confirm successful uncordon operation
-	logger.Printf("Node %s has been successfully uncordoned.", node.Name)
+	log.Printf("Node %s has been successfully uncordoned.", node.Name)
 	return nil
 }
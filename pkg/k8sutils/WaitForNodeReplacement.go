@@ -0,0 +1,151 @@
+package k8sutils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/supporttools/k8s-node-killer/pkg/config"
+	"github.com/supporttools/k8s-node-killer/pkg/health"
+	"github.com/supporttools/k8s-node-killer/pkg/logging"
+	"github.com/supporttools/k8s-node-killer/pkg/metrics"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// MachinePoolAnnotation is set by Cluster API on every node and names the MachineSet that owns it.
+const MachinePoolAnnotation = "cluster.x-k8s.io/owner-name"
+
+// replacementPollInterval is how often the nodes are listed while waiting for a replacement.
+var replacementPollInterval = 10 * time.Second
+
+// WaitForNodeReplacement waits for a deleted node to be replaced: the old Node object must be
+// removed and a new Node in the same machine pool must become Ready, bringing the pool back to
+// its size. It returns false when this does not happen within the replacement timeout.
+func WaitForNodeReplacement(ctx context.Context, clientset kubernetes.Interface, node *v1.Node) bool {
+	return waitForNodeReplacement(ctx, clientset, node)
+}
+
+func waitForNodeReplacement(ctx context.Context, clientset kubernetes.Interface, node *v1.Node) bool {
+	cfg := config.FromContext(ctx)
+	log := logging.FromContext(ctx)
+	pool := NodePool(ctx, node)
+	if pool == "" {
+		log.Printf("Node %s has no machine pool, cannot track its replacement.", node.Name)
+		return false
+	}
+
+	// Nodes created since shortly before the deletion are replacements, the others make up
+	// the size the pool must get back to.
+	startTime := time.Now()
+	replacedAfter := startTime.Add(-time.Minute)
+	poolSize, err := countPoolNodes(ctx, clientset, pool, node.Name, replacedAfter)
+	if err != nil {
+		log.Warnf("Failed to count the nodes of pool %s, counting again while waiting: %v", pool, err)
+	} else {
+		log.Printf("Waiting up to %s for node %s to be replaced in pool %s (expected size %d).", cfg.ReplacementTimeout, node.Name, pool, poolSize)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, cfg.ReplacementTimeout)
+	defer cancel()
+
+	ticker := time.NewTicker(replacementPollInterval)
+	defer ticker.Stop()
+
+	oldNodeRemoved := false
+	for {
+		select {
+		case <-ctx.Done():
+			if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				log.Printf("Stopped waiting for the replacement of node %s: %v", node.Name, ctx.Err())
+				return false
+			}
+			metrics.ReplacementTimeouts.WithLabelValues(health.ClusterFromContext(ctx), pool).Inc()
+			if poolSize == 0 {
+				log.Errorf("Could not count the nodes of pool %s within %s after deleting node %s.", pool, cfg.ReplacementTimeout, node.Name)
+				return false
+			}
+			log.Errorf("Pool %s did not get back to size %d within %s after deleting node %s (old node removed: %t).", pool, poolSize, cfg.ReplacementTimeout, node.Name, oldNodeRemoved)
+			return false
+		case <-ticker.C:
+			nodes, err := clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+			if err != nil {
+				log.Printf("Error listing nodes while waiting for replacement of %s: %v", node.Name, err)
+				continue
+			}
+			if poolSize == 0 {
+				poolSize = poolNodes(ctx, nodes.Items, pool, node.Name, replacedAfter) + 1
+				log.Printf("Waiting for node %s to be replaced in pool %s (expected size %d).", node.Name, pool, poolSize)
+			}
+
+			oldNodeRemoved = true
+			readyReplacements, currentPoolSize := 0, 0
+			for i := range nodes.Items {
+				candidate := &nodes.Items[i]
+				if NodePool(ctx, candidate) != pool {
+					continue
+				}
+				if candidate.Name == node.Name {
+					oldNodeRemoved = false
+					continue
+				}
+				currentPoolSize++
+				if isConditionReady(candidate) && candidate.CreationTimestamp.Time.After(replacedAfter) {
+					readyReplacements++
+				}
+			}
+
+			if oldNodeRemoved && readyReplacements > 0 && currentPoolSize >= poolSize {
+				elapsed := time.Since(startTime)
+				metrics.ReplacementTime.WithLabelValues(health.ClusterFromContext(ctx), pool).Observe(elapsed.Seconds())
+				log.Printf("Node %s was replaced in pool %s after %s.", node.Name, pool, elapsed.Round(time.Second))
+				return true
+			}
+			log.Printf("Waiting for replacement of node %s in pool %s: old node removed: %t, ready replacements: %d, pool size: %d/%d.", node.Name, pool, oldNodeRemoved, readyReplacements, currentPoolSize, poolSize)
+		}
+	}
+}
+
+// NodePool returns the machine pool a node belongs to, using the label configured in the
+// snapshot of ctx or the Cluster API owner annotation.
+func NodePool(ctx context.Context, node *v1.Node) string {
+	cfg := config.FromContext(ctx)
+	if cfg.MachinePoolLabel != "" {
+		return node.Labels[cfg.MachinePoolLabel]
+	}
+	return node.Annotations[MachinePoolAnnotation]
+}
+
+// countPoolNodes returns the size the given pool must get back to after the excluded node
+// was deleted: the excluded node and the nodes in the pool created before the given time.
+func countPoolNodes(ctx context.Context, clientset kubernetes.Interface, pool, exclude string, before time.Time) (int, error) {
+	nodes, err := clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return 0, fmt.Errorf("list nodes: %w", err)
+	}
+	return poolNodes(ctx, nodes.Items, pool, exclude, before) + 1, nil
+}
+
+// poolNodes returns the number of nodes in the given pool created before the given time, not
+// counting the excluded node.
+func poolNodes(ctx context.Context, nodes []v1.Node, pool, exclude string, before time.Time) int {
+	count := 0
+	for i := range nodes {
+		if nodes[i].Name != exclude && NodePool(ctx, &nodes[i]) == pool && !nodes[i].CreationTimestamp.Time.After(before) {
+			count++
+		}
+	}
+	return count
+}
+
+// isConditionReady reports whether the node's Ready condition is True.
+func isConditionReady(node *v1.Node) bool {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == v1.NodeReady {
+			return condition.Status == v1.ConditionTrue
+		}
+	}
+	return false
+}
@@ -0,0 +1,81 @@
+package k8sutils
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	"github.com/supporttools/k8s-node-killer/pkg/config"
+)
+
+// poolNode returns a node of pool "workers" created at the given time.
+func poolNode(name string, ready bool, created time.Time) *v1.Node {
+	status := v1.ConditionFalse
+	if ready {
+		status = v1.ConditionTrue
+	}
+	return &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              name,
+			Annotations:       map[string]string{MachinePoolAnnotation: "workers"},
+			CreationTimestamp: metav1.NewTime(created),
+		},
+		Status: v1.NodeStatus{Conditions: []v1.NodeCondition{{Type: v1.NodeReady, Status: status}}},
+	}
+}
+
+func TestWaitForNodeReplacementWhenFirstListFails(t *testing.T) {
+	previous := replacementPollInterval
+	replacementPollInterval = time.Millisecond
+	t.Cleanup(func() { replacementPollInterval = previous })
+
+	tests := []struct {
+		name         string
+		loseAnother  bool // Another node of the pool goes away along with the deleted one
+		wantReplaced bool
+	}{
+		{name: "pool back to size", wantReplaced: true},
+		{name: "pool still short", loseAnother: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := config.Load([]byte("authMode: kubeconfig\nharvesterKey: key\nrancherToken: token\nreplacementTimeout: 200ms\n"))
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			ctx := config.WithSnapshot(context.Background(), &cfg)
+			dayAgo := time.Now().Add(-24 * time.Hour)
+			old := poolNode("worker-1", false, dayAgo)
+			clientset := fake.NewSimpleClientset(old, poolNode("worker-2", true, dayAgo), poolNode("worker-3", true, dayAgo))
+
+			// The first list fails, the second still sees the whole pool, and by the third the
+			// deleted node was replaced.
+			lists := 0
+			clientset.PrependReactor("list", "nodes", func(k8stesting.Action) (bool, runtime.Object, error) {
+				switch lists++; lists {
+				case 1:
+					return true, nil, fmt.Errorf("apiserver unavailable")
+				case 3:
+					nodes := clientset.Tracker()
+					nodes.Delete(v1.SchemeGroupVersion.WithResource("nodes"), "", "worker-1")
+					if tt.loseAnother {
+						nodes.Delete(v1.SchemeGroupVersion.WithResource("nodes"), "", "worker-3")
+					}
+					nodes.Add(poolNode("worker-4", true, time.Now()))
+				}
+				return false, nil, nil
+			})
+
+			if got := waitForNodeReplacement(ctx, clientset, old); got != tt.wantReplaced {
+				t.Errorf("replaced = %t, want %t", got, tt.wantReplaced)
+			}
+		})
+	}
+}
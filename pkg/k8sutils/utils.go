@@ -1,24 +1,41 @@
 package k8sutils
 
 import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/supporttools/k8s-node-killer/pkg/config"
 	"github.com/supporttools/k8s-node-killer/pkg/logging"
+	"github.com/supporttools/k8s-node-killer/pkg/rancher"
 )
 
 var logger = logging.SetupLogging()
 
-// MachineList represents the list of machines fetched from the Rancher API
-type MachineList struct {
-	Data []Machine `json:"data"`
-}
+var (
+	rancherClientMu        sync.Mutex
+	sharedRancher          *rancher.Client
+	sharedRancherClientKey string
+)
+
+// RancherClient returns the Rancher API client shared by all Rancher calls, configured by the
+// configuration snapshot of ctx. The client is rebuilt when the Rancher credentials have been rotated or a reload changed the endpoint or
+// its TLS settings.
+func RancherClient(ctx context.Context) (*rancher.Client, error) {
+	rancherClientMu.Lock()
+	defer rancherClientMu.Unlock()
+
+	cfg := config.FromContext(ctx)
+	clientKey := strings.Join([]string{config.RancherToken(), config.RancherKey(), cfg.RancherAPI, cfg.RancherCAFile, strconv.FormatBool(cfg.InsecureSkipVerify)}, "\x00")
+	if sharedRancher != nil && clientKey == sharedRancherClientKey {
+		return sharedRancher, nil
+	}
 
-// Machine represents a single machine in the Rancher API response
-type Machine struct {
-	Metadata struct {
-		Name string `json:"name"`
-	} `json:"metadata"`
-	Spec struct {
-		InfrastructureRef struct {
-			Name string `json:"name"`
-		} `json:"infrastructureRef"`
-	} `json:"spec"`
+	client, err := rancher.NewClientFromConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	sharedRancher, sharedRancherClientKey = client, clientKey
+	return client, nil
 }
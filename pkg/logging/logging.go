@@ -1,52 +1,106 @@
 package logging
 
 import (
+	"context"
+	"fmt"
 	"os"
 	"path/filepath"
 	"runtime"
 	"strconv"
 
 	"github.com/sirupsen/logrus"
-	"github.com/supporttools/k8s-node-killer/pkg/config"
 )
 
-var logger *logrus.Logger
+// Context fields carried on every log line of a recovery.
+const (
+	FieldCluster = "cluster"
+	FieldNode    = "node"
+	FieldAttempt = "attempt"
+	FieldStep    = "step"
+)
+
+// logger is shared by every package, so Configure applies everywhere.
+var logger = newLogger()
 
-// SetupLogging initializes the logger with specific formatting and level.
+func newLogger() *logrus.Logger {
+	l := logrus.New()
+	l.SetReportCaller(true)
+	l.SetOutput(os.Stderr)
+	l.SetLevel(logrus.InfoLevel)
+	l.SetFormatter(newFormatter("text"))
+	return l
+}
+
+// SetupLogging returns the shared logger.
 func SetupLogging() *logrus.Logger {
-	logger = logrus.New()
-	logger.SetReportCaller(true)
+	return logger
+}
 
-	customFormatter := new(logrus.TextFormatter)
-	customFormatter.TimestampFormat = "2006-01-02 15:04:05"
-	customFormatter.FullTimestamp = true
-	customFormatter.CallerPrettyfier = func(f *runtime.Frame) (string, string) {
-		filename := getRelativePath(f.File)
-		return "", filename + ":" + strconv.Itoa(f.Line)
+// Configure sets the level ("trace", "debug", "info", "warn" or "error") and the format
+// ("text" or "json") of the shared logger.
+func Configure(level, format string) error {
+	parsed, err := logrus.ParseLevel(level)
+	if err != nil {
+		return fmt.Errorf("invalid log level: %w", err)
+	}
+	if format != "text" && format != "json" {
+		return fmt.Errorf("invalid log format %q, must be text or json", format)
 	}
-	logger.SetFormatter(customFormatter)
+	logger.SetLevel(parsed)
+	logger.SetFormatter(newFormatter(format))
+	return nil
+}
 
-	logger.SetOutput(os.Stderr)
+func newFormatter(format string) logrus.Formatter {
+	callerPrettyfier := func(f *runtime.Frame) (string, string) {
+		return "", getRelativePath(f.File) + ":" + strconv.Itoa(f.Line)
+	}
+	if format == "json" {
+		return &logrus.JSONFormatter{CallerPrettyfier: callerPrettyfier}
+	}
+	return &logrus.TextFormatter{
+		TimestampFormat:  "2006-01-02 15:04:05",
+		FullTimestamp:    true,
+		CallerPrettyfier: callerPrettyfier,
+	}
+}
 
-	if config.CFG.Debug {
-		logger.SetLevel(logrus.DebugLevel)
-	} else {
-		logger.SetLevel(logrus.InfoLevel)
+type fieldsKey struct{}
+
+// WithFields returns a context carrying additional log fields, on top of those already
+// carried by ctx.
+func WithFields(ctx context.Context, fields logrus.Fields) context.Context {
+	merged := logrus.Fields{}
+	if existing, ok := ctx.Value(fieldsKey{}).(logrus.Fields); ok {
+		for key, value := range existing {
+			merged[key] = value
+		}
+	}
+	for key, value := range fields {
+		merged[key] = value
 	}
+	return context.WithValue(ctx, fieldsKey{}, merged)
+}
 
-	return logger
+// WithField returns a context carrying an additional log field.
+func WithField(ctx context.Context, key string, value interface{}) context.Context {
+	return WithFields(ctx, logrus.Fields{key: value})
+}
+
+// FromContext returns a log entry of the shared logger with the fields carried by ctx.
+func FromContext(ctx context.Context) *logrus.Entry {
+	fields, _ := ctx.Value(fieldsKey{}).(logrus.Fields)
+	return logger.WithFields(fields)
 }
 
 // GetRelativePath returns the file path relative to the project's root directory.
 func getRelativePath(filePath string) string {
 	wd, err := os.Getwd()
 	if err != nil {
-		logger.Errorf("Unable to get current working directory: %v", err)
 		return filePath
 	}
 	relPath, err := filepath.Rel(wd, filePath)
 	if err != nil {
-		logger.Errorf("Unable to get relative path for %s: %v", filePath, err)
 		return filePath
 	}
 	return relPath
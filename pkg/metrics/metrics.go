@@ -1,8 +1,12 @@
 package metrics
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
@@ -10,69 +14,223 @@ import (
 	"github.com/supporttools/k8s-node-killer/pkg/config"
 	"github.com/supporttools/k8s-node-killer/pkg/health"
 	"github.com/supporttools/k8s-node-killer/pkg/logging"
+	"github.com/supporttools/k8s-node-killer/pkg/policy"
 )
 
 var logger = logging.SetupLogging()
 
+// registerer records the name of every metric registered with the default registry, so
+// the generated alerts and dashboards can only reference metrics that exist.
+var registerer = &namingRegisterer{Registerer: prometheus.DefaultRegisterer}
+
+var factory = promauto.With(registerer)
+
+// Label names shared by the per-node metrics. The node label is left empty when
+// metricsNodeLabel is "pool", which bounds cardinality on autoscaled pools.
+var (
+	targetLabels = []string{"cluster", "pool", "node"}
+	stepLabels   = []string{"cluster", "pool", "node", "step"}
+)
+
+// durationBuckets cover recovery durations from a few seconds up to a few hours, as steps
+// wait for minutes for a node to come back.
+var durationBuckets = prometheus.ExponentialBuckets(5, 2, 12) // 5s up to about 2.8 hours
+
 var (
-	RecoveryAttempts = promauto.NewCounterVec(prometheus.CounterOpts{
+	RecoveryAttempts = factory.NewCounterVec(prometheus.CounterOpts{
 		Name: "k8s_node_killer_recovery_attempts_total",
-		Help: "Total number of recovery attempts by node and step.",
-	}, []string{"node", "step"})
+		Help: "Total number of recovery attempts by cluster, pool, node and step.",
+	}, stepLabels)
 
-	RecoverySuccesses = promauto.NewCounterVec(prometheus.CounterOpts{
+	RecoverySuccesses = factory.NewCounterVec(prometheus.CounterOpts{
 		Name: "k8s_node_killer_recovery_successes_total",
-		Help: "Total number of successful recoveries by node and step.",
-	}, []string{"node", "step"})
+		Help: "Total number of successful recoveries by cluster, pool, node and step.",
+	}, stepLabels)
 
-	RecoveryFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+	RecoveryFailures = factory.NewCounterVec(prometheus.CounterOpts{
 		Name: "k8s_node_killer_recovery_failures_total",
-		Help: "Total number of failed recoveries by node and step.",
-	}, []string{"node", "step"})
+		Help: "Total number of failed recoveries by cluster, pool, node and step.",
+	}, stepLabels)
 
-	RecoveryLatencies = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	RecoveryLatencies = factory.NewHistogramVec(prometheus.HistogramOpts{
 		Name:    "k8s_node_killer_recovery_latency_seconds",
-		Help:    "Histogram of latencies for recovery actions by node and step.",
-		Buckets: prometheus.LinearBuckets(1, 5, 5), // Starting at 1 second, 5 buckets, increment by 5 seconds
-	}, []string{"node", "step"})
+		Help:    "Duration of recovery steps, including the wait for the node to recover, by cluster, pool, node and step.",
+		Buckets: durationBuckets,
+	}, stepLabels)
 
-	RecoveryTime = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	RecoveryTime = factory.NewHistogramVec(prometheus.HistogramOpts{
 		Name:    "k8s_node_killer_recovery_time_seconds",
 		Help:    "Time taken for the node recovery process, from start to finish.",
-		Buckets: prometheus.LinearBuckets(10, 10, 5), // Buckets starting at 10 seconds, incrementing by 10 seconds, with 5 buckets
-	}, []string{"node"})
+		Buckets: durationBuckets,
+	}, targetLabels)
 
-	NodeDowntime = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	NodeDowntime = factory.NewHistogramVec(prometheus.HistogramOpts{
 		Name:    "k8s_node_killer_node_downtime_seconds",
-		Help:    "Total downtime for the node during the recovery process.",
-		Buckets: prometheus.LinearBuckets(10, 10, 5), // Similar bucket strategy as Recovery Time
-	}, []string{"node"})
+		Help:    "Time from a node becoming NotReady until it was recovered.",
+		Buckets: durationBuckets,
+	}, targetLabels)
 
-	InterventionRate = promauto.NewCounterVec(prometheus.CounterOpts{
+	ManualInterventions = factory.NewCounterVec(prometheus.CounterOpts{
 		Name: "k8s_node_killer_manual_interventions_total",
-		Help: "Total number of times manual intervention was required during recovery.",
-	}, []string{"node"})
-
-	RecoveryFailureRate = promauto.NewCounterVec(prometheus.CounterOpts{
-		Name: "k8s_node_killer_recovery_failures_rate",
-		Help: "Rate of recovery failures compared to total recovery attempts.",
-	}, []string{"node"})
-
-	IncidentFrequency = promauto.NewCounterVec(prometheus.CounterOpts{
-		Name: "k8s_node_killer_incident_frequency_total",
-		Help: "Total number of incidents requiring node recovery.",
-	}, []string{"node"})
-
-	ChangeFailureRate = promauto.NewCounterVec(prometheus.CounterOpts{
-		Name: "k8s_node_killer_change_failure_rate",
-		Help: "Rate of failures due to changes or updates that required node recovery.",
-	}, []string{"node"})
+		Help: "Total number of times every recovery step failed and manual intervention was required.",
+	}, targetLabels)
+
+	Incidents = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "k8s_node_killer_incidents_total",
+		Help: "Total number of incidents, i.e. remediations started for a NotReady node.",
+	}, targetLabels)
+
+	RemediationsInFlight = factory.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "k8s_node_killer_remediations_in_flight",
+		Help: "Number of remediations currently running by cluster.",
+	}, []string{"cluster"})
+
+	RuleEvaluations = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "k8s_node_killer_rule_evaluations_total",
+		Help: "Total number of policy rule evaluations by cluster, rule and result (match, no_match or error).",
+	}, []string{"cluster", "rule", "result"})
+
+	ScanDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "k8s_node_killer_scan_duration_seconds",
+		Help:    "Duration of the periodic rescans of a cluster, from queueing every node until the workers evaluated all of them.",
+		Buckets: prometheus.ExponentialBuckets(0.01, 4, 10), // 10ms up to about 45 minutes
+	}, []string{"cluster"})
+
+	NodesEvaluated = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "k8s_node_killer_nodes_evaluated_total",
+		Help: "Total number of node evaluations by cluster, from node events and rescans.",
+	}, []string{"cluster"})
+
+	ReplacementTime = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "k8s_node_killer_replacement_time_seconds",
+		Help:    "Time from the remediation of a machine until its replacement in the same pool, or of the same owner, ran a Ready node.",
+		Buckets: prometheus.ExponentialBuckets(60, 2, 7), // 1 minute up to roughly 1 hour
+	}, []string{"cluster", "pool"})
+
+	ReplacementTimeouts = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "k8s_node_killer_replacement_timeouts_total",
+		Help: "Total number of times a machine pool, or the owner of a remediated machine, did not replace it in time.",
+	}, []string{"cluster", "pool"})
+
+	KubeconfigRefreshes = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "k8s_node_killer_kubeconfig_refreshes_total",
+		Help: "Total number of Rancher-generated kubeconfig credential refreshes by cluster, reason and result.",
+	}, []string{"cluster", "reason", "result"})
+
+	ManagedClusters = factory.NewGauge(prometheus.GaugeOpts{
+		Name: "k8s_node_killer_managed_clusters",
+		Help: "Number of downstream clusters currently watched in multi-cluster mode.",
+	})
+
+	ConfigReloads = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "k8s_node_killer_config_reloads_total",
+		Help: "Total number of configuration reloads from the watched ConfigMap by result (applied or rejected).",
+	}, []string{"result"})
+
+	RemediationsSuppressed = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "k8s_node_killer_remediations_suppressed_total",
+		Help: "Total number of remediations skipped by policy, operators or the kill switch, by cluster and reason.",
+	}, []string{"cluster", "reason"})
+
+	RemediationPaused = factory.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "k8s_node_killer_remediation_paused",
+		Help: "Whether all remediation is halted (1) or not (0), by source (kill_switch or admin).",
+	}, []string{"source"})
+
+	Leader = factory.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "k8s_node_killer_leader",
+		Help: "Whether this instance is the one remediating nodes (1) or standing by (0).",
+	}, func() float64 {
+		if health.Leader() {
+			return 1
+		}
+		return 0
+	})
+)
+
+// Target identifies the node a per-node metric is about.
+type Target struct {
+	Cluster string
+	Pool    string
+	Node    string
+}
+
+// NewTarget returns the target of a node, leaving the node empty when the configuration
+// snapshot of ctx labels metrics by pool.
+func NewTarget(ctx context.Context, cluster, pool, node string) Target {
+	if config.FromContext(ctx).MetricsNodeLabel == "pool" {
+		node = ""
+	}
+	return Target{Cluster: cluster, Pool: pool, Node: node}
+}
+
+// Labels returns the label values of the target followed by extra.
+func (t Target) Labels(extra ...string) []string {
+	return append([]string{t.Cluster, t.Pool, t.Node}, extra...)
+}
+
+// nodesDesc describes the number of tracked nodes by cluster and current status.
+var nodesDesc = prometheus.NewDesc(
+	"k8s_node_killer_nodes",
+	"Number of tracked nodes by cluster and current remediation status.",
+	[]string{"cluster", "status"}, nil,
 )
 
-func StartMetricsServer() {
-	if config.CFG.MetricsPort == 0 {
+// partitionSuppressionDesc describes how long remediation has been held back by a suspected
+// partition, by cluster.
+var partitionSuppressionDesc = prometheus.NewDesc(
+	"k8s_node_killer_partition_suppression_seconds",
+	"Longest time a node of the cluster has been left alone as partitioned, 0 when none is.",
+	[]string{"cluster"}, nil,
+)
+
+// nodeStatesCollector computes the nodes and partition suppression gauges from the node
+// states at scrape time, so they never drift from what the API reports.
+type nodeStatesCollector struct{}
+
+func (nodeStatesCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- nodesDesc
+	ch <- partitionSuppressionDesc
+}
+
+func (nodeStatesCollector) Collect(ch chan<- prometheus.Metric) {
+	type key struct{ cluster, status string }
+	counts := make(map[key]int)
+	partitioned := make(map[string]time.Duration)
+	now := time.Now()
+	for _, state := range health.ListNodeStates() {
+		counts[key{state.Cluster, string(state.Status)}]++
+		suppressed := time.Duration(0)
+		if state.Status == health.StatusSuppressed && state.Reason == policy.ReasonPartition {
+			suppressed = now.Sub(state.LastTransition)
+		}
+		partitioned[state.Cluster] = max(partitioned[state.Cluster], suppressed)
+	}
+	for k, count := range counts {
+		ch <- prometheus.MustNewConstMetric(nodesDesc, prometheus.GaugeValue, float64(count), k.cluster, k.status)
+	}
+	for cluster, suppressed := range partitioned {
+		ch <- prometheus.MustNewConstMetric(partitionSuppressionDesc, prometheus.GaugeValue, suppressed.Seconds(), cluster)
+	}
+}
+
+func init() {
+	registerer.MustRegister(nodeStatesCollector{})
+}
+
+// configHandler serves the active configuration with all credentials redacted.
+func configHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(config.Get())
+}
+
+// StartMetricsServer serves the metrics, health and state endpoints in the background until
+// the returned server is shut down. routes may register additional endpoints on the same
+// server.
+func StartMetricsServer(routes ...func(*http.ServeMux)) *http.Server {
+	cfg := config.Get()
+	if cfg.MetricsPort == 0 {
 		logger.Fatalf("Metrics server port not configured")
-		return
 	}
 	mux := http.NewServeMux()
 	mux.Handle("/metrics", promhttp.Handler())
@@ -80,11 +238,20 @@ func StartMetricsServer() {
 	mux.Handle("/readyz", health.ReadyzHandler())
 	mux.Handle("/version", health.VersionHandler())
 	mux.HandleFunc("/node-states", health.NodeStatesHandler)
+	mux.HandleFunc("/config", configHandler)
+	health.RegisterAPI(mux)
+	for _, register := range routes {
+		register(mux)
+	}
 
-	serverPortStr := strconv.Itoa(config.CFG.MetricsPort)
+	serverPortStr := strconv.Itoa(cfg.MetricsPort)
 	logger.Infof("Metrics server starting on port %s", serverPortStr)
 
-	if err := http.ListenAndServe(":"+serverPortStr, mux); err != nil {
-		logger.Fatalf("Metrics server failed to start: %v", err)
-	}
+	server := &http.Server{Addr: ":" + serverPortStr, Handler: mux}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Fatalf("Metrics server failed to start: %v", err)
+		}
+	}()
+	return server
 }
@@ -0,0 +1,48 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/supporttools/k8s-node-killer/pkg/health"
+	"github.com/supporttools/k8s-node-killer/pkg/policy"
+)
+
+func TestPartitionSuppressionGauge(t *testing.T) {
+	t.Cleanup(func() {
+		health.ForgetCluster("partitioned")
+		health.ForgetCluster("healthy")
+	})
+	health.Transition("partitioned", "node-1", health.StatusSuppressed, policy.ReasonPartition)
+	health.Transition("partitioned", "node-2", health.StatusSuppressed, policy.ReasonMaxConcurrent)
+	health.Transition("healthy", "node-1", health.StatusHealthy, "")
+	time.Sleep(10 * time.Millisecond)
+
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(nodeStatesCollector{})
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]float64)
+	for _, family := range families {
+		if family.GetName() != "k8s_node_killer_partition_suppression_seconds" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			got[metric.GetLabel()[0].GetValue()] = metric.GetGauge().GetValue()
+		}
+	}
+	if got["partitioned"] <= 0 {
+		t.Errorf("partition suppression of the partitioned cluster = %v, want positive", got["partitioned"])
+	}
+	if value, ok := got["healthy"]; !ok || value != 0 {
+		t.Errorf("partition suppression of the healthy cluster = %v (reported %t), want 0", value, ok)
+	}
+	if n := testutil.CollectAndCount(nodeStatesCollector{}, "k8s_node_killer_partition_suppression_seconds"); n != 2 {
+		t.Errorf("partition suppression reported for %d clusters, want 2", n)
+	}
+}
@@ -0,0 +1,410 @@
+package metrics
+
+//go:generate go run ../../cmd/gen-monitoring -out ../../deploy/monitoring
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/supporttools/k8s-node-killer/pkg/config"
+	"github.com/supporttools/k8s-node-killer/pkg/health"
+)
+
+// namingRegisterer is a prometheus.Registerer recording the descriptor of every metric it
+// registers. The names are extracted lazily, as metrics are registered during package
+// initialization.
+type namingRegisterer struct {
+	prometheus.Registerer
+	mu    sync.Mutex
+	descs []string
+}
+
+// descNamePattern extracts the metric name from a prometheus.Desc, which does not expose it.
+var descNamePattern = regexp.MustCompile(`fqName: "([^"]+)"`)
+
+func (r *namingRegisterer) Register(c prometheus.Collector) error {
+	if err := r.Registerer.Register(c); err != nil {
+		return err
+	}
+	descs := make(chan *prometheus.Desc)
+	go func() {
+		c.Describe(descs)
+		close(descs)
+	}()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for desc := range descs {
+		r.descs = append(r.descs, desc.String())
+	}
+	return nil
+}
+
+// names returns the names of the registered metrics.
+func (r *namingRegisterer) names() map[string]bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	names := make(map[string]bool, len(r.descs))
+	for _, desc := range r.descs {
+		if match := descNamePattern.FindStringSubmatch(desc); match != nil {
+			names[match[1]] = true
+		}
+	}
+	return names
+}
+
+func (r *namingRegisterer) MustRegister(cs ...prometheus.Collector) {
+	for _, c := range cs {
+		if err := r.Register(c); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// metricNamePattern matches the names of this project's metrics within a PromQL expression.
+var metricNamePattern = regexp.MustCompile(`\bk8s_node_killer_[a-z0-9_]+`)
+
+// checkReferences returns an error naming every metric referenced by the expressions that
+// is not registered by this package. Histogram series suffixes are accepted.
+func checkReferences(exprs ...string) error {
+	registered := registerer.names()
+	unknown := make(map[string]bool)
+	for _, expr := range exprs {
+		for _, name := range metricNamePattern.FindAllString(expr, -1) {
+			base := name
+			for _, suffix := range []string{"_bucket", "_sum", "_count"} {
+				if trimmed := strings.TrimSuffix(name, suffix); registered[trimmed] {
+					base = trimmed
+				}
+			}
+			if !registered[base] {
+				unknown[name] = true
+			}
+		}
+	}
+	if len(unknown) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(unknown))
+	for name := range unknown {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return fmt.Errorf("unknown metrics referenced: %s", strings.Join(names, ", "))
+}
+
+// PrometheusRule is a monitoring.coreos.com/v1 PrometheusRule, as consumed by the
+// Prometheus Operator.
+type PrometheusRule struct {
+	APIVersion string             `json:"apiVersion"`
+	Kind       string             `json:"kind"`
+	Metadata   PrometheusRuleMeta `json:"metadata"`
+	Spec       PrometheusRuleSpec `json:"spec"`
+}
+
+type PrometheusRuleMeta struct {
+	Name   string            `json:"name"`
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+type PrometheusRuleSpec struct {
+	Groups []RuleGroup `json:"groups"`
+}
+
+type RuleGroup struct {
+	Name  string `json:"name"`
+	Rules []Rule `json:"rules"`
+}
+
+type Rule struct {
+	Alert       string            `json:"alert"`
+	Expr        string            `json:"expr"`
+	For         string            `json:"for,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// rebootSteps are the ladder steps that reboot a node in place, as opposed to replacing it.
+var rebootSteps = config.StepSSHAndReboot + "|" + config.StepHardReboot
+
+// Alerts returns the PrometheusRule shipped with the project. It fails when a rule
+// references a metric this package does not register.
+func Alerts() (PrometheusRule, error) {
+	rules := []Rule{
+		{
+			Alert:  "K8sNodeKillerManualInterventionRequired",
+			Expr:   fmt.Sprintf(`sum by (cluster) (k8s_node_killer_nodes{status=%q}) > 0`, health.StatusManualIntervention),
+			For:    "5m",
+			Labels: map[string]string{"severity": "critical"},
+			Annotations: map[string]string{
+				"summary":     "Nodes need manual intervention in cluster {{ $labels.cluster }}.",
+				"description": "{{ $value }} nodes in cluster {{ $labels.cluster }} are NotReady and every recovery step failed.",
+			},
+		},
+		{
+			Alert:  "K8sNodeKillerRemediationBudgetExhausted",
+			Expr:   `sum by (cluster) (increase(k8s_node_killer_remediations_suppressed_total{reason=~"max_concurrent|max_per_hour"}[15m])) > 0`,
+			For:    "15m",
+			Labels: map[string]string{"severity": "warning"},
+			Annotations: map[string]string{
+				"summary":     "Remediation budget exhausted in cluster {{ $labels.cluster }}.",
+				"description": "NotReady nodes in cluster {{ $labels.cluster }} are left alone because the concurrency or hourly remediation budget is used up.",
+			},
+		},
+		{
+			Alert:  "K8sNodeKillerPartitionSuspected",
+			Expr:   `sum by (cluster) (increase(k8s_node_killer_remediations_suppressed_total{reason="partition"}[15m])) > 0`,
+			For:    "10m",
+			Labels: map[string]string{"severity": "warning"},
+			Annotations: map[string]string{
+				"summary":     "k8s-node-killer suspects a network partition in cluster {{ $labels.cluster }}.",
+				"description": "NotReady nodes in cluster {{ $labels.cluster }} are left alone because the API server does not answer, too many nodes went NotReady at once or their kubelets still answer.",
+			},
+		},
+		{
+			Alert:  "K8sNodeKillerPartitionSuppressionLong",
+			Expr:   `max by (cluster) (k8s_node_killer_partition_suppression_seconds) > 3600`,
+			Labels: map[string]string{"severity": "critical"},
+			Annotations: map[string]string{
+				"summary":     "Remediation in cluster {{ $labels.cluster }} has been held back by a suspected partition for over an hour.",
+				"description": "A NotReady node in cluster {{ $labels.cluster }} has been left alone as partitioned for {{ $value | humanizeDuration }}. Check the connectivity between k8s-node-killer and the cluster, or bound the suppression with policy.partition.maxSuppression.",
+			},
+		},
+		{
+			Alert:  "K8sNodeKillerRebootLoop",
+			Expr:   fmt.Sprintf(`sum by (cluster, pool, node) (increase(k8s_node_killer_recovery_attempts_total{step=~%q}[6h])) >= 3`, rebootSteps),
+			Labels: map[string]string{"severity": "warning"},
+			Annotations: map[string]string{
+				"summary":     "Node {{ $labels.node }} in cluster {{ $labels.cluster }} keeps being rebooted.",
+				"description": "{{ $value }} reboots in the last 6 hours for node {{ $labels.node }} of pool {{ $labels.pool }}. The node label is empty when metrics are labelled by pool.",
+			},
+		},
+		{
+			Alert:  "K8sNodeKillerNotLeading",
+			Expr:   `max(k8s_node_killer_leader) < 1 or absent(k8s_node_killer_leader)`,
+			For:    "10m",
+			Labels: map[string]string{"severity": "critical"},
+			Annotations: map[string]string{
+				"summary":     "No k8s-node-killer instance is remediating nodes.",
+				"description": "No instance of k8s-node-killer has been leading for 10 minutes, NotReady nodes are not remediated.",
+			},
+		},
+	}
+
+	exprs := make([]string, 0, len(rules))
+	for _, rule := range rules {
+		exprs = append(exprs, rule.Expr)
+	}
+	if err := checkReferences(exprs...); err != nil {
+		return PrometheusRule{}, fmt.Errorf("alerting rules: %w", err)
+	}
+
+	return PrometheusRule{
+		APIVersion: "monitoring.coreos.com/v1",
+		Kind:       "PrometheusRule",
+		Metadata: PrometheusRuleMeta{
+			Name:   "k8s-node-killer",
+			Labels: map[string]string{"app.kubernetes.io/name": "k8s-node-killer"},
+		},
+		Spec: PrometheusRuleSpec{Groups: []RuleGroup{{Name: "k8s-node-killer", Rules: rules}}},
+	}, nil
+}
+
+// Dashboard is the subset of the Grafana dashboard JSON model the project uses.
+type Dashboard struct {
+	Title         string         `json:"title"`
+	UID           string         `json:"uid"`
+	Tags          []string       `json:"tags"`
+	Timezone      string         `json:"timezone"`
+	SchemaVersion int            `json:"schemaVersion"`
+	Refresh       string         `json:"refresh"`
+	Time          DashboardRange `json:"time"`
+	Templating    Templating     `json:"templating"`
+	Panels        []Panel        `json:"panels"`
+}
+
+type DashboardRange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+type Templating struct {
+	List []Variable `json:"list"`
+}
+
+type Variable struct {
+	Name       string      `json:"name"`
+	Label      string      `json:"label"`
+	Type       string      `json:"type"`
+	Query      string      `json:"query"`
+	Datasource *Datasource `json:"datasource,omitempty"`
+	IncludeAll bool        `json:"includeAll,omitempty"`
+	Multi      bool        `json:"multi,omitempty"`
+	Refresh    int         `json:"refresh,omitempty"`
+}
+
+type Datasource struct {
+	Type string `json:"type"`
+	UID  string `json:"uid"`
+}
+
+type Panel struct {
+	ID          int         `json:"id"`
+	Type        string      `json:"type"`
+	Title       string      `json:"title"`
+	GridPos     GridPos     `json:"gridPos"`
+	Datasource  *Datasource `json:"datasource"`
+	Targets     []Query     `json:"targets"`
+	FieldConfig FieldConfig `json:"fieldConfig"`
+}
+
+type GridPos struct {
+	H int `json:"h"`
+	W int `json:"w"`
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+type Query struct {
+	RefID        string `json:"refId"`
+	Expr         string `json:"expr"`
+	LegendFormat string `json:"legendFormat,omitempty"`
+}
+
+type FieldConfig struct {
+	Defaults FieldDefaults `json:"defaults"`
+}
+
+type FieldDefaults struct {
+	Unit string `json:"unit,omitempty"`
+}
+
+// GrafanaDashboard returns the Grafana dashboard shipped with the project. It fails when a panel
+// references a metric this package does not register.
+func GrafanaDashboard() (Dashboard, error) {
+	datasource := &Datasource{Type: "prometheus", UID: "${datasource}"}
+	type panel struct {
+		kind, title, unit string
+		queries           []Query
+	}
+	q := func(expr, legend string) Query { return Query{Expr: expr, LegendFormat: legend} }
+	const sel = `cluster=~"$cluster"`
+
+	rows := [][]panel{
+		{
+			{"stat", "Nodes needing manual intervention", "", []Query{q(fmt.Sprintf(`sum(k8s_node_killer_nodes{%s,status=%q})`, sel, health.StatusManualIntervention), "")}},
+			{"stat", "Remediations in flight", "", []Query{q(`sum(k8s_node_killer_remediations_in_flight{`+sel+`})`, "")}},
+			{"stat", "Remediation halted", "", []Query{q(`max by (source) (k8s_node_killer_remediation_paused)`, "{{source}}")}},
+			{"stat", "Leading instances", "", []Query{q(`sum(k8s_node_killer_leader)`, "")}},
+		},
+		{
+			{"timeseries", "Nodes by status", "", []Query{q(`sum by (status) (k8s_node_killer_nodes{`+sel+`})`, "{{status}}")}},
+			{"timeseries", "Incidents and manual interventions", "", []Query{
+				q(`sum by (cluster) (increase(k8s_node_killer_incidents_total{`+sel+`}[1h]))`, "incidents {{cluster}}"),
+				q(`sum by (cluster) (increase(k8s_node_killer_manual_interventions_total{`+sel+`}[1h]))`, "manual interventions {{cluster}}"),
+			}},
+		},
+		{
+			{"timeseries", "Recovery steps by result", "", []Query{
+				q(`sum by (step) (increase(k8s_node_killer_recovery_successes_total{`+sel+`}[1h]))`, "{{step}} succeeded"),
+				q(`sum by (step) (increase(k8s_node_killer_recovery_failures_total{`+sel+`}[1h]))`, "{{step}} failed"),
+			}},
+			{"timeseries", "Recovery step duration (p50, p95)", "s", []Query{
+				q(`histogram_quantile(0.5, sum by (step, le) (rate(k8s_node_killer_recovery_latency_seconds_bucket{`+sel+`}[$__rate_interval])))`, "p50 {{step}}"),
+				q(`histogram_quantile(0.95, sum by (step, le) (rate(k8s_node_killer_recovery_latency_seconds_bucket{`+sel+`}[$__rate_interval])))`, "p95 {{step}}"),
+			}},
+		},
+		{
+			{"timeseries", "Recovery time and node downtime (p95)", "s", []Query{
+				q(`histogram_quantile(0.95, sum by (le) (rate(k8s_node_killer_recovery_time_seconds_bucket{`+sel+`}[$__rate_interval])))`, "recovery time"),
+				q(`histogram_quantile(0.95, sum by (le) (rate(k8s_node_killer_node_downtime_seconds_bucket{`+sel+`}[$__rate_interval])))`, "node downtime"),
+			}},
+			{"timeseries", "Suppressed remediations by reason", "", []Query{
+				q(`sum by (reason) (increase(k8s_node_killer_remediations_suppressed_total{`+sel+`}[1h]))`, "{{reason}}"),
+				q(`max by (cluster) (k8s_node_killer_partition_suppression_seconds{`+sel+`}) / 60`, "minutes held back as partitioned {{cluster}}"),
+			}},
+		},
+		{
+			{"timeseries", "Machine replacement time (p95)", "s", []Query{
+				q(`histogram_quantile(0.95, sum by (pool, le) (rate(k8s_node_killer_replacement_time_seconds_bucket{`+sel+`}[$__rate_interval])))`, "{{pool}}"),
+				q(`sum by (pool) (increase(k8s_node_killer_replacement_timeouts_total{`+sel+`}[1h]))`, "timeouts {{pool}}"),
+			}},
+			{"timeseries", "Controller", "", []Query{
+				q(`k8s_node_killer_managed_clusters`, "managed clusters"),
+				q(`sum by (result) (increase(k8s_node_killer_config_reloads_total[1h]))`, "config reloads {{result}}"),
+				q(`sum by (cluster, result) (increase(k8s_node_killer_kubeconfig_refreshes_total{`+sel+`}[1h]))`, "kubeconfig refreshes {{cluster}} {{result}}"),
+			}},
+		},
+		{
+			{"timeseries", "Node evaluations", "ops", []Query{
+				q(`sum by (cluster) (rate(k8s_node_killer_nodes_evaluated_total{`+sel+`}[$__rate_interval]))`, "{{cluster}}"),
+			}},
+			{"timeseries", "Rescan duration (p95)", "s", []Query{
+				q(`histogram_quantile(0.95, sum by (cluster, le) (rate(k8s_node_killer_scan_duration_seconds_bucket{`+sel+`}[$__rate_interval])))`, "{{cluster}}"),
+			}},
+			{"timeseries", "Rule evaluations by result", "", []Query{
+				q(`sum by (rule, result) (increase(k8s_node_killer_rule_evaluations_total{`+sel+`}[1h]))`, "{{rule}} {{result}}"),
+			}},
+		},
+	}
+
+	const clusterQuery = "label_values(k8s_node_killer_nodes, cluster)"
+	var panels []Panel
+	exprs := []string{clusterQuery}
+	y := 0
+	for _, row := range rows {
+		width, height := 24/len(row), 8
+		if row[0].kind == "stat" {
+			height = 4
+		}
+		for i, p := range row {
+			queries := make([]Query, len(p.queries))
+			for j, query := range p.queries {
+				query.RefID = string(rune('A' + j))
+				queries[j] = query
+				exprs = append(exprs, query.Expr)
+			}
+			panels = append(panels, Panel{
+				ID:          len(panels) + 1,
+				Type:        p.kind,
+				Title:       p.title,
+				GridPos:     GridPos{H: height, W: width, X: i * width, Y: y},
+				Datasource:  datasource,
+				Targets:     queries,
+				FieldConfig: FieldConfig{Defaults: FieldDefaults{Unit: p.unit}},
+			})
+		}
+		y += height
+	}
+	if err := checkReferences(exprs...); err != nil {
+		return Dashboard{}, fmt.Errorf("dashboard: %w", err)
+	}
+
+	return Dashboard{
+		Title:         "k8s-node-killer",
+		UID:           "k8s-node-killer",
+		Tags:          []string{"k8s-node-killer"},
+		Timezone:      "browser",
+		SchemaVersion: 39,
+		Refresh:       "1m",
+		Time:          DashboardRange{From: "now-24h", To: "now"},
+		Templating: Templating{List: []Variable{
+			{Name: "datasource", Label: "Data source", Type: "datasource", Query: "prometheus"},
+			{
+				Name:       "cluster",
+				Label:      "Cluster",
+				Type:       "query",
+				Query:      clusterQuery,
+				Datasource: datasource,
+				IncludeAll: true,
+				Multi:      true,
+				Refresh:    2,
+			},
+		}},
+		Panels: panels,
+	}, nil
+}
@@ -0,0 +1,106 @@
+package metrics
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"reflect"
+	"testing"
+
+	"sigs.k8s.io/yaml"
+)
+
+// The files shipped in deploy/monitoring, relative to this package.
+const (
+	prometheusRuleFile = "../../deploy/monitoring/prometheusrule.yaml"
+	dashboardFile      = "../../deploy/monitoring/grafana-dashboard.json"
+)
+
+func TestShippedPrometheusRule(t *testing.T) {
+	data, err := os.ReadFile(prometheusRuleFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var shipped PrometheusRule
+	if err := yaml.UnmarshalStrict(data, &shipped); err != nil {
+		t.Fatalf("parse %s: %v", prometheusRuleFile, err)
+	}
+
+	var exprs []string
+	for _, group := range shipped.Spec.Groups {
+		for _, rule := range group.Rules {
+			exprs = append(exprs, rule.Expr)
+		}
+	}
+	if len(exprs) == 0 {
+		t.Fatalf("%s has no rules", prometheusRuleFile)
+	}
+	if err := checkReferences(exprs...); err != nil {
+		t.Errorf("%s: %v", prometheusRuleFile, err)
+	}
+
+	generated, err := Alerts()
+	if err != nil {
+		t.Fatalf("Alerts: %v", err)
+	}
+	if !reflect.DeepEqual(shipped, generated) {
+		t.Errorf("%s is out of date, run go generate ./pkg/metrics", prometheusRuleFile)
+	}
+}
+
+func TestShippedGrafanaDashboard(t *testing.T) {
+	data, err := os.ReadFile(dashboardFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var shipped Dashboard
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&shipped); err != nil {
+		t.Fatalf("parse %s: %v", dashboardFile, err)
+	}
+
+	var exprs []string
+	for _, variable := range shipped.Templating.List {
+		exprs = append(exprs, variable.Query)
+	}
+	for _, panel := range shipped.Panels {
+		for _, target := range panel.Targets {
+			exprs = append(exprs, target.Expr)
+		}
+	}
+	if len(shipped.Panels) == 0 {
+		t.Fatalf("%s has no panels", dashboardFile)
+	}
+	if err := checkReferences(exprs...); err != nil {
+		t.Errorf("%s: %v", dashboardFile, err)
+	}
+
+	generated, err := GrafanaDashboard()
+	if err != nil {
+		t.Fatalf("GrafanaDashboard: %v", err)
+	}
+	if !reflect.DeepEqual(shipped, generated) {
+		t.Errorf("%s is out of date, run go generate ./pkg/metrics", dashboardFile)
+	}
+}
+
+func TestCheckReferences(t *testing.T) {
+	tests := []struct {
+		name    string
+		expr    string
+		wantErr bool
+	}{
+		{name: "counter", expr: `sum(increase(k8s_node_killer_incidents_total[1h]))`},
+		{name: "histogram series", expr: `histogram_quantile(0.9, sum by (le) (rate(k8s_node_killer_recovery_time_seconds_bucket[5m])))`},
+		{name: "collector", expr: `k8s_node_killer_nodes{status="ManualIntervention"}`},
+		{name: "typo", expr: `sum(k8s_node_killer_incident_total)`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkReferences(tt.expr); (err != nil) != tt.wantErr {
+				t.Errorf("checkReferences(%q) = %v, want error %t", tt.expr, err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package policy
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/supporttools/k8s-node-killer/pkg/health"
+)
+
+var (
+	decisionsMu sync.RWMutex
+	decisions   = make(map[string]Decision) // Latest decision per node, keyed by cluster/node
+)
+
+// DecisionList is the response of GET /api/v1/decisions.
+type DecisionList struct {
+	APIVersion string     `json:"apiVersion"`
+	Kind       string     `json:"kind"`
+	Items      []Decision `json:"items"`
+}
+
+// NodeDecision is the response of GET /api/v1/nodes/{name}/decision.
+type NodeDecision struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Decision
+}
+
+// Record keeps a decision as the latest one for its node.
+func Record(d Decision) {
+	decisionsMu.Lock()
+	defer decisionsMu.Unlock()
+	decisions[d.Cluster+"/"+d.NodeName] = d
+}
+
+// ForgetCluster drops the decisions of every node of a cluster.
+func ForgetCluster(cluster string) {
+	decisionsMu.Lock()
+	defer decisionsMu.Unlock()
+	for key, d := range decisions {
+		if d.Cluster == cluster {
+			delete(decisions, key)
+		}
+	}
+}
+
+// ForgetNode drops the decision of a deleted node.
+func ForgetNode(cluster, nodeName string) {
+	decisionsMu.Lock()
+	defer decisionsMu.Unlock()
+	delete(decisions, cluster+"/"+nodeName)
+}
+
+// GetDecision returns the latest decision of a node.
+func GetDecision(cluster, nodeName string) (Decision, bool) {
+	decisionsMu.RLock()
+	defer decisionsMu.RUnlock()
+	d, ok := decisions[cluster+"/"+nodeName]
+	return d, ok
+}
+
+// ListDecisions returns the latest decision of every node, sorted by cluster and node name.
+func ListDecisions() []Decision {
+	decisionsMu.RLock()
+	list := make([]Decision, 0, len(decisions))
+	for _, d := range decisions {
+		list = append(list, d)
+	}
+	decisionsMu.RUnlock()
+
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Cluster != list[j].Cluster {
+			return list[i].Cluster < list[j].Cluster
+		}
+		return list[i].NodeName < list[j].NodeName
+	})
+	return list
+}
+
+// RegisterAPI registers the decision endpoints on the given mux.
+func RegisterAPI(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/v1/decisions", listDecisionsHandler)
+	mux.HandleFunc("GET /api/v1/nodes/{name}/decision", getDecisionHandler)
+}
+
+// listDecisionsHandler serves the latest decision of every node. Supported query parameters
+// are cluster and action (comma separated).
+func listDecisionsHandler(w http.ResponseWriter, r *http.Request) {
+	cluster := r.URL.Query().Get("cluster")
+	actions := make(map[Action]bool)
+	for _, action := range strings.Split(r.URL.Query().Get("action"), ",") {
+		if action = strings.TrimSpace(action); action != "" {
+			actions[Action(action)] = true
+		}
+	}
+
+	list := DecisionList{APIVersion: health.APIVersion, Kind: "DecisionList", Items: []Decision{}}
+	for _, d := range ListDecisions() {
+		if (cluster == "" || d.Cluster == cluster) && (len(actions) == 0 || actions[d.Action]) {
+			list.Items = append(list.Items, d)
+		}
+	}
+	health.WriteJSON(w, http.StatusOK, list)
+}
+
+// getDecisionHandler serves the latest decision of a single node. The cluster query
+// parameter is only required when nodes of several clusters share the name.
+func getDecisionHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	query := r.URL.Query()
+
+	var found []Decision
+	for _, d := range ListDecisions() {
+		if d.NodeName == name && (!query.Has("cluster") || d.Cluster == query.Get("cluster")) {
+			found = append(found, d)
+		}
+	}
+	switch {
+	case len(found) == 0:
+		health.WriteAPIError(w, http.StatusNotFound, fmt.Sprintf("no decision recorded for node %s", name))
+	case len(found) > 1:
+		clusters := make([]string, 0, len(found))
+		for _, d := range found {
+			clusters = append(clusters, d.Cluster)
+		}
+		health.WriteAPIError(w, http.StatusConflict, fmt.Sprintf("node %s exists in clusters %s, set the cluster query parameter", name, strings.Join(clusters, ", ")))
+	default:
+		health.WriteJSON(w, http.StatusOK, NodeDecision{APIVersion: health.APIVersion, Kind: "NodeDecision", Decision: found[0]})
+	}
+}
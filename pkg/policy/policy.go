@@ -0,0 +1,339 @@
+// Package policy decides whether and how a node should be remediated. Decide is a pure
+// function of its Input, so every decision can be explained and reproduced.
+package policy
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+
+	"github.com/supporttools/k8s-node-killer/pkg/config"
+	"github.com/supporttools/k8s-node-killer/pkg/health"
+)
+
+// Node annotations read by the engine.
+const (
+	// ExcludeAnnotation opts a node out of remediation when set to "true".
+	ExcludeAnnotation = "k8s-node-killer.support.tools/exclude"
+	// StartStepAnnotation names the ladder step remediation of the node starts at.
+	StartStepAnnotation = "k8s-node-killer.support.tools/start-step"
+)
+
+// Reboot loop detection: a node that a reboot brought back this many times within the
+// window starts its next remediation past the reboot steps.
+const (
+	rebootLoopThreshold = 2
+	rebootLoopWindow    = time.Hour
+)
+
+// Action is what the engine decided to do with a node.
+type Action string
+
+const (
+	ActionNone      Action = "none"      // Nothing to do: the node is ready or not ours to remediate
+	ActionSuppress  Action = "suppress"  // The node is not ready, but remediation is not allowed now
+	ActionRemediate Action = "remediate" // Run the ladder from StartStep
+)
+
+// Machine-readable decision reasons. The suppression reasons are also the reason label of
+// the remediations suppressed metric.
+const (
+	ReasonExcluded           = "excluded"
+	ReasonNotSelected        = "not_selected"
+	ReasonReady              = "ready"
+	ReasonManualIntervention = "manual_intervention"
+	ReasonKillSwitch         = "kill_switch"
+	ReasonShutdown           = "shutdown"
+	ReasonControllerPaused   = "controller_paused"
+	ReasonNodePaused         = "node_paused"
+	ReasonPartition          = "partition"
+	ReasonNewNode            = "new_node"
+	ReasonOutsideWindow      = "outside_window"
+	ReasonMaxConcurrent      = "max_concurrent"
+	ReasonMaxPerHour         = "max_per_hour"
+	ReasonNotReady           = "not_ready"
+	ReasonRulePrefix         = "rule:" // Followed by the name of the rule that decided
+)
+
+// Results of a rule evaluation.
+const (
+	RuleMatch   = "match"
+	RuleNoMatch = "no_match"
+	RuleError   = "error"
+)
+
+// BudgetUsage is the remediation activity of a cluster, checked against the budgets.
+type BudgetUsage struct {
+	InFlight        int // Remediations running
+	StartedLastHour int // Remediations started within the last hour
+}
+
+// Input is everything a decision depends on.
+type Input struct {
+	Cluster          string
+	Node             *v1.Node
+	Pods             []v1.Pod // Pods on the node; only needed when a rule uses them
+	Now              time.Time
+	Policy           config.PolicyConfig
+	NewNodeThreshold time.Duration
+	State            health.NodeState // Current status and attempt history of the node
+	KillSwitch       string           // Object that engaged the kill switch, empty when released
+	ControllerPaused bool
+	ShuttingDown     bool
+	Partition        string              // Why the controller suspects it lost contact with the node, empty otherwise
+	Probe            *health.ProbeResult // Direct probe of the node, nil when not probed
+	Budget           BudgetUsage
+}
+
+// Decision is the outcome of Decide.
+type Decision struct {
+	Cluster   string       `json:"cluster"`
+	NodeName  string       `json:"nodeName"`
+	Action    Action       `json:"action"`
+	Reason    string       `json:"reason"`              // Machine-readable reason of the action
+	StartStep string       `json:"startStep,omitempty"` // First ladder step to run when remediating
+	Ladder    []string     `json:"ladder,omitempty"`    // Steps to run when remediating, from StartStep on
+	Rule      string       `json:"rule,omitempty"`      // Rule that matched the node, if any
+	Reasons   []string     `json:"reasons"`             // Human-readable explanation, in evaluation order
+	Rules     []RuleResult `json:"rules,omitempty"`     // Rules evaluated, in order
+	DecidedAt time.Time    `json:"decidedAt"`
+}
+
+// RuleResult is the outcome of evaluating a rule against a node.
+type RuleResult struct {
+	Rule   string `json:"rule"`
+	Result string `json:"result"` // match, no_match or error
+	Error  string `json:"error,omitempty"`
+}
+
+// Decide returns what to do with a node.
+func Decide(in Input) Decision {
+	d := Decision{Cluster: in.Cluster, NodeName: in.Node.Name, DecidedAt: in.Now, Reasons: []string{}}
+	explain := func(format string, args ...interface{}) {
+		d.Reasons = append(d.Reasons, fmt.Sprintf(format, args...))
+	}
+	decide := func(action Action, reason string) Decision {
+		d.Action, d.Reason = action, reason
+		return d
+	}
+
+	if strings.EqualFold(in.Node.Annotations[ExcludeAnnotation], "true") {
+		explain("Node is excluded by the %s annotation.", ExcludeAnnotation)
+		return decide(ActionNone, ReasonExcluded)
+	}
+	if !in.Policy.SelectsNode(in.Node.Labels) {
+		explain("Node labels do not match the policy selectors (include %q, exclude %q).", in.Policy.Selectors.Include, in.Policy.Selectors.Exclude)
+		return decide(ActionNone, ReasonNotSelected)
+	}
+
+	// Rules may remediate a Ready node, suppress remediation or leave the node alone.
+	ready := readyCondition(in.Node)
+	isReady := ready != nil && ready.Status == v1.ConditionTrue
+	if !isReady {
+		explainNotReady(in, ready, explain)
+	}
+	rule := matchRule(in, &d, explain)
+	switch {
+	case rule != nil && rule.Action == config.RuleActionIgnore:
+		return decide(ActionNone, ReasonRulePrefix+rule.Name)
+	case isReady && (rule == nil || rule.Action != config.RuleActionRemediate):
+		explain("Node is Ready.")
+		return decide(ActionNone, ReasonReady)
+	case rule != nil && rule.Action == config.RuleActionSuppress:
+		return decide(ActionSuppress, ReasonRulePrefix+rule.Name)
+	}
+
+	if in.State.Status == health.StatusManualIntervention {
+		explain("Every recovery step failed earlier, the node awaits manual intervention.")
+		return decide(ActionNone, ReasonManualIntervention)
+	}
+	if in.KillSwitch != "" {
+		explain("The kill switch is engaged by %s.", in.KillSwitch)
+		return decide(ActionSuppress, ReasonKillSwitch)
+	}
+	if in.ShuttingDown {
+		explain("The controller is shutting down.")
+		return decide(ActionSuppress, ReasonShutdown)
+	}
+	if in.ControllerPaused {
+		explain("Remediation is paused for every node by an operator.")
+		return decide(ActionSuppress, ReasonControllerPaused)
+	}
+	if in.State.Paused {
+		explain("Remediation of the node is paused by an operator.")
+		return decide(ActionSuppress, ReasonNodePaused)
+	}
+	if partition := partitionReason(in, ready); partition != "" {
+		limit := in.Policy.Partition.MaxSuppression
+		if limit <= 0 || ready == nil || in.Now.Sub(ready.LastTransitionTime.Time) < limit {
+			explain("%s.", partition)
+			return decide(ActionSuppress, ReasonPartition)
+		}
+		explain("%s, but the node has been NotReady for longer than the partition suppression limit of %s.", partition, limit)
+	}
+	if age := in.Now.Sub(in.Node.CreationTimestamp.Time); age < in.NewNodeThreshold {
+		explain("Node is %s old, younger than the new node threshold of %s.", age.Round(time.Second), in.NewNodeThreshold)
+		return decide(ActionSuppress, ReasonNewNode)
+	}
+	if !in.Policy.InWindow(in.Now) {
+		explain("Remediation is only allowed within the maintenance windows.")
+		return decide(ActionSuppress, ReasonOutsideWindow)
+	}
+	budgets := in.Policy.Budgets
+	if budgets.MaxConcurrent > 0 && in.Budget.InFlight >= budgets.MaxConcurrent {
+		explain("%d remediations are running, the cluster allows %d at a time.", in.Budget.InFlight, budgets.MaxConcurrent)
+		return decide(ActionSuppress, ReasonMaxConcurrent)
+	}
+	if budgets.MaxPerHour > 0 && in.Budget.StartedLastHour >= budgets.MaxPerHour {
+		explain("%d remediations started within the last hour, the cluster allows %d per hour.", in.Budget.StartedLastHour, budgets.MaxPerHour)
+		return decide(ActionSuppress, ReasonMaxPerHour)
+	}
+
+	ladder := in.Policy.Ladder
+	if rule != nil && len(rule.Ladder) > 0 {
+		ladder = rule.Ladder
+		explain("Rule %s sets the ladder to %s.", rule.Name, strings.Join(ladder, ", "))
+	}
+	d.StartStep = startStep(in, ladder, explain)
+	if d.StartStep == "" {
+		explain("The ladder has no step left to run.")
+		return decide(ActionNone, ReasonManualIntervention)
+	}
+	for i, step := range ladder {
+		if step == d.StartStep {
+			d.Ladder = append([]string(nil), ladder[i:]...)
+		}
+	}
+	explain("Remediation starts at step %s.", d.StartStep)
+	if rule != nil {
+		return decide(ActionRemediate, ReasonRulePrefix+rule.Name)
+	}
+	return decide(ActionRemediate, ReasonNotReady)
+}
+
+// matchRule evaluates the policy rules in order and returns the first one matching the
+// node, recording every evaluation in the decision. A rule failing to evaluate does not match.
+func matchRule(in Input, d *Decision, explain func(string, ...interface{})) *config.Rule {
+	for _, rule := range in.Policy.CompiledRules() {
+		matched, err := rule.Matches(in.Node, in.Pods)
+		switch {
+		case err != nil:
+			d.Rules = append(d.Rules, RuleResult{Rule: rule.Name, Result: RuleError, Error: err.Error()})
+			explain("Rule %s failed to evaluate: %v", rule.Name, err)
+		case matched:
+			d.Rules = append(d.Rules, RuleResult{Rule: rule.Name, Result: RuleMatch})
+			d.Rule = rule.Name
+			explain("Rule %s matches the node, its action is %s.", rule.Name, rule.Action)
+			return rule
+		default:
+			d.Rules = append(d.Rules, RuleResult{Rule: rule.Name, Result: RuleNoMatch})
+		}
+	}
+	return nil
+}
+
+// partitionReason returns why the fault looks to be on the controller's side rather than
+// the node's, or an empty string.
+func partitionReason(in Input, ready *v1.NodeCondition) string {
+	if in.Partition != "" {
+		return "The fault looks to be on the controller's side: " + in.Partition
+	}
+	if in.Probe != nil && in.Probe.Kubelet && ready != nil && ready.Status == v1.ConditionUnknown {
+		return fmt.Sprintf("The kubelet of the node answers at %s although it stopped reporting to the API server", in.Probe.Address)
+	}
+	return ""
+}
+
+// readyCondition returns the Ready condition of a node, or nil if it reports none.
+func readyCondition(node *v1.Node) *v1.NodeCondition {
+	for i := range node.Status.Conditions {
+		if node.Status.Conditions[i].Type == v1.NodeReady {
+			return &node.Status.Conditions[i]
+		}
+	}
+	return nil
+}
+
+// explainNotReady explains why the node is not ready, including pressure conditions.
+func explainNotReady(in Input, ready *v1.NodeCondition, explain func(string, ...interface{})) {
+	if ready == nil {
+		explain("Node reports no Ready condition.")
+	} else {
+		since := in.Now.Sub(ready.LastTransitionTime.Time).Round(time.Second)
+		detail := strings.TrimSuffix(strings.Trim(ready.Reason+": "+ready.Message, ": "), ".")
+		explain("Node Ready condition has been %s for %s (%s).", ready.Status, since, detail)
+	}
+	for _, condition := range in.Node.Status.Conditions {
+		if condition.Type != v1.NodeReady && condition.Status == v1.ConditionTrue {
+			explain("Node reports %s: %s", condition.Type, condition.Message)
+		}
+	}
+}
+
+// startStep returns the ladder step remediation starts at: the one requested by the node
+// annotation, past the steps needing SSH when the host does not answer the probes, past
+// the reboot steps when reboots keep bringing the node back only for it to fail again, at
+// the kubelet restart when the host answers but its kubelet does not, and the first step
+// otherwise.
+func startStep(in Input, ladder []string, explain func(string, ...interface{})) string {
+	if len(ladder) == 0 {
+		return ""
+	}
+
+	if requested := in.Node.Annotations[StartStepAnnotation]; requested != "" {
+		for _, step := range ladder {
+			if step == requested {
+				explain("The %s annotation requests starting at step %s.", StartStepAnnotation, requested)
+				return requested
+			}
+		}
+		explain("Ignoring the %s annotation: step %s is not in the ladder.", StartStepAnnotation, requested)
+	}
+
+	unreachable := in.Probe != nil && !in.Probe.HostReachable()
+	if unreachable {
+		explain("Node address %s answers no probe (%s), skipping the steps that need SSH.", in.Probe.Address, strings.Join(in.Probe.Errors, "; "))
+	}
+
+	rebooted := 0
+	for _, attempt := range in.State.Attempts {
+		if isReboot(attempt.Step) && attempt.Result == health.ResultSuccess &&
+			attempt.FinishedAt != nil && in.Now.Sub(*attempt.FinishedAt) < rebootLoopWindow {
+			rebooted++
+		}
+	}
+	rebootLoop := rebooted >= rebootLoopThreshold
+	if rebootLoop {
+		explain("A reboot brought the node back %d times within %s, skipping the reboot steps.", rebooted, rebootLoopWindow)
+	}
+
+	if in.Probe != nil && in.Probe.SSH && !in.Probe.Kubelet && !rebootLoop {
+		for _, step := range ladder {
+			if step == config.StepRestartKubelet {
+				explain("Node address %s answers SSH but its kubelet does not.", in.Probe.Address)
+				return step
+			}
+		}
+	}
+
+	for _, step := range ladder {
+		if (unreachable && needsSSH(step)) || (rebootLoop && isReboot(step)) {
+			continue
+		}
+		return step
+	}
+	explain("No step of the ladder is left after skipping, starting at the first one.")
+	return ladder[0]
+}
+
+// isReboot reports whether a step reboots the node in place rather than replacing it.
+func isReboot(step string) bool {
+	return step == config.StepSSHAndReboot || step == config.StepHardReboot
+}
+
+// needsSSH reports whether a step runs over SSH, and so needs the host to answer.
+func needsSSH(step string) bool {
+	return step == config.StepSSHAndReboot || step == config.StepRestartKubelet
+}
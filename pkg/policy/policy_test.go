@@ -0,0 +1,445 @@
+package policy
+
+import (
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/supporttools/k8s-node-killer/pkg/config"
+	"github.com/supporttools/k8s-node-killer/pkg/health"
+)
+
+// testNow is a Wednesday noon, in UTC.
+var testNow = time.Date(2026, time.October, 14, 12, 0, 0, 0, time.UTC)
+
+// testPolicy returns the validated policy of a config file with the given policy section.
+func testPolicy(t *testing.T, policy string) config.PolicyConfig {
+	t.Helper()
+	cfg, err := config.Load([]byte("authMode: kubeconfig\nharvesterKey: key\nrancherToken: token\npolicy:\n  ladder: [restart_kubelet, ssh_and_reboot]\n" + policy))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if err := config.ValidateConfiguration(&cfg); err != nil {
+		t.Fatalf("invalid test policy: %v", err)
+	}
+	return cfg.Policy
+}
+
+// testNode returns a node created a day before testNow, with the given Ready status.
+func testNode(ready v1.ConditionStatus) *v1.Node {
+	return &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "node-1",
+			Labels:            map[string]string{"role": "worker"},
+			CreationTimestamp: metav1.NewTime(testNow.Add(-24 * time.Hour)),
+		},
+		Status: v1.NodeStatus{Conditions: []v1.NodeCondition{{
+			Type:               v1.NodeReady,
+			Status:             ready,
+			LastTransitionTime: metav1.NewTime(testNow.Add(-10 * time.Minute)),
+		}}},
+	}
+}
+
+// reboots returns the attempts of reboots that brought the node back, finished the given
+// durations before testNow.
+func reboots(ago ...time.Duration) []health.Attempt {
+	var attempts []health.Attempt
+	for _, d := range ago {
+		finished := testNow.Add(-d)
+		attempts = append(attempts, health.Attempt{Step: config.StepSSHAndReboot, StartedAt: finished.Add(-5 * time.Minute), FinishedAt: &finished, Result: health.ResultSuccess})
+	}
+	return attempts
+}
+
+// unreachable is a probe of a node answering nothing.
+var unreachable = &health.ProbeResult{Address: "10.0.0.1", Errors: []string{"ssh: connection refused", "kubelet: connection refused"}}
+
+func TestDecide(t *testing.T) {
+	tests := []struct {
+		name       string
+		policy     string // Appended to the policy section
+		ready      v1.ConditionStatus
+		modify     func(*Input)
+		wantAction Action
+		wantReason string
+		wantStart  string
+	}{
+		{name: "ready", ready: v1.ConditionTrue, wantAction: ActionNone, wantReason: ReasonReady},
+		{name: "not ready", ready: v1.ConditionFalse, wantAction: ActionRemediate, wantReason: ReasonNotReady, wantStart: "restart_kubelet"},
+		{name: "unknown", ready: v1.ConditionUnknown, wantAction: ActionRemediate, wantReason: ReasonNotReady, wantStart: "restart_kubelet"},
+		{
+			name: "new node", ready: v1.ConditionFalse,
+			modify: func(in *Input) {
+				in.NewNodeThreshold = time.Hour
+				in.Node.CreationTimestamp = metav1.NewTime(testNow.Add(-5 * time.Minute))
+			},
+			wantAction: ActionSuppress, wantReason: ReasonNewNode,
+		},
+		{
+			name: "kill switch", ready: v1.ConditionFalse,
+			modify:     func(in *Input) { in.KillSwitch = "ConfigMap kube-system/kill-switch" },
+			wantAction: ActionSuppress, wantReason: ReasonKillSwitch,
+		},
+		{
+			name: "outside maintenance window", ready: v1.ConditionFalse,
+			policy:     "  windows:\n  - start: \"01:00\"\n    end: \"03:00\"\n",
+			wantAction: ActionSuppress, wantReason: ReasonOutsideWindow,
+		},
+		{
+			name: "within maintenance window", ready: v1.ConditionFalse,
+			policy:     "  windows:\n  - days: [Wed]\n    start: \"11:00\"\n    end: \"13:00\"\n",
+			wantAction: ActionRemediate, wantReason: ReasonNotReady, wantStart: "restart_kubelet",
+		},
+		{
+			name: "max concurrent", ready: v1.ConditionFalse,
+			policy:     "  budgets:\n    maxConcurrent: 2\n",
+			modify:     func(in *Input) { in.Budget.InFlight = 2 },
+			wantAction: ActionSuppress, wantReason: ReasonMaxConcurrent,
+		},
+		{
+			name: "below max concurrent", ready: v1.ConditionFalse,
+			policy:     "  budgets:\n    maxConcurrent: 2\n",
+			modify:     func(in *Input) { in.Budget.InFlight = 1 },
+			wantAction: ActionRemediate, wantReason: ReasonNotReady, wantStart: "restart_kubelet",
+		},
+		{
+			name: "max per hour", ready: v1.ConditionFalse,
+			policy:     "  budgets:\n    maxPerHour: 3\n",
+			modify:     func(in *Input) { in.Budget.StartedLastHour = 3 },
+			wantAction: ActionSuppress, wantReason: ReasonMaxPerHour,
+		},
+		{
+			name: "partition", ready: v1.ConditionFalse,
+			modify:     func(in *Input) { in.Partition = "4 of 5 nodes went NotReady within 2m0s" },
+			wantAction: ActionSuppress, wantReason: ReasonPartition,
+		},
+		{
+			name: "partition within max suppression", ready: v1.ConditionFalse,
+			policy:     "  partition:\n    maxSuppression: 3600000000000\n",
+			modify:     func(in *Input) { in.Partition = "API server unreachable" },
+			wantAction: ActionSuppress, wantReason: ReasonPartition,
+		},
+		{
+			name: "partition beyond max suppression", ready: v1.ConditionFalse,
+			policy:     "  partition:\n    maxSuppression: 300000000000\n",
+			modify:     func(in *Input) { in.Partition = "API server unreachable" },
+			wantAction: ActionRemediate, wantReason: ReasonNotReady, wantStart: "restart_kubelet",
+		},
+		{
+			name: "kubelet answers a node that stopped reporting beyond max suppression", ready: v1.ConditionUnknown,
+			policy:     "  partition:\n    maxSuppression: 300000000000\n",
+			modify:     func(in *Input) { in.Probe = &health.ProbeResult{SSH: true, Kubelet: true} },
+			wantAction: ActionRemediate, wantReason: ReasonNotReady, wantStart: "restart_kubelet",
+		},
+		{
+			name: "partition beyond max suppression outside maintenance window", ready: v1.ConditionFalse,
+			policy:     "  windows:\n  - start: \"01:00\"\n    end: \"03:00\"\n  partition:\n    maxSuppression: 300000000000\n",
+			modify:     func(in *Input) { in.Partition = "API server unreachable" },
+			wantAction: ActionSuppress, wantReason: ReasonOutsideWindow,
+		},
+		{
+			name: "kubelet answers a node that stopped reporting", ready: v1.ConditionUnknown,
+			modify:     func(in *Input) { in.Probe = &health.ProbeResult{SSH: true, Kubelet: true} },
+			wantAction: ActionSuppress, wantReason: ReasonPartition,
+		},
+		{
+			name: "kubelet answers a node it reports NotReady", ready: v1.ConditionFalse,
+			modify:     func(in *Input) { in.Probe = &health.ProbeResult{SSH: true, Kubelet: true} },
+			wantAction: ActionRemediate, wantReason: ReasonNotReady, wantStart: "restart_kubelet",
+		},
+		{
+			name: "rule remediates a ready node", ready: v1.ConditionTrue,
+			policy:     "  rules:\n  - name: drain-workers\n    expression: node.metadata.labels.role == 'worker'\n    ladder: [ssh_and_reboot]\n",
+			wantAction: ActionRemediate, wantReason: ReasonRulePrefix + "drain-workers", wantStart: "ssh_and_reboot",
+		},
+		{
+			name: "rule suppresses", ready: v1.ConditionFalse,
+			policy:     "  rules:\n  - name: keep-workers\n    expression: node.metadata.labels.role == 'worker'\n    action: suppress\n",
+			wantAction: ActionSuppress, wantReason: ReasonRulePrefix + "keep-workers",
+		},
+		{
+			name: "rule ignores", ready: v1.ConditionFalse,
+			policy:     "  rules:\n  - name: skip-workers\n    expression: node.metadata.labels.role == 'worker'\n    action: ignore\n",
+			wantAction: ActionNone, wantReason: ReasonRulePrefix + "skip-workers",
+		},
+		{
+			name: "rule not matching", ready: v1.ConditionFalse,
+			policy:     "  rules:\n  - name: skip-gpus\n    expression: node.metadata.labels.role == 'gpu'\n    action: ignore\n",
+			wantAction: ActionRemediate, wantReason: ReasonNotReady, wantStart: "restart_kubelet",
+		},
+
+		// Nodes out of scope.
+		{
+			name: "excluded by annotation", ready: v1.ConditionFalse,
+			modify:     func(in *Input) { in.Node.Annotations = map[string]string{ExcludeAnnotation: "true"} },
+			wantAction: ActionNone, wantReason: ReasonExcluded,
+		},
+		{
+			name: "include selector not matching", ready: v1.ConditionFalse,
+			policy:     "  selectors:\n    include: role=gpu\n",
+			wantAction: ActionNone, wantReason: ReasonNotSelected,
+		},
+		{
+			name: "include selector matching", ready: v1.ConditionFalse,
+			policy:     "  selectors:\n    include: role=worker\n",
+			wantAction: ActionRemediate, wantReason: ReasonNotReady, wantStart: "restart_kubelet",
+		},
+		{
+			name: "exclude selector matching", ready: v1.ConditionFalse,
+			policy:     "  selectors:\n    exclude: role=worker\n",
+			wantAction: ActionNone, wantReason: ReasonNotSelected,
+		},
+		{
+			name: "exclude selector wins over include selector", ready: v1.ConditionFalse,
+			policy:     "  selectors:\n    include: role=worker\n    exclude: role in (worker, gpu)\n",
+			wantAction: ActionNone, wantReason: ReasonNotSelected,
+		},
+		{
+			name: "exclude selector wins over a remediating rule", ready: v1.ConditionTrue,
+			policy:     "  selectors:\n    exclude: role=worker\n  rules:\n  - name: drain-workers\n    expression: node.metadata.labels.role == 'worker'\n",
+			wantAction: ActionNone, wantReason: ReasonNotSelected,
+		},
+		{
+			name: "manual intervention", ready: v1.ConditionFalse,
+			modify:     func(in *Input) { in.State.Status = health.StatusManualIntervention },
+			wantAction: ActionNone, wantReason: ReasonManualIntervention,
+		},
+
+		// Operators and the controller holding remediation back.
+		{
+			name: "controller paused", ready: v1.ConditionFalse,
+			modify:     func(in *Input) { in.ControllerPaused = true },
+			wantAction: ActionSuppress, wantReason: ReasonControllerPaused,
+		},
+		{
+			name: "node paused", ready: v1.ConditionFalse,
+			modify:     func(in *Input) { in.State.Paused = true },
+			wantAction: ActionSuppress, wantReason: ReasonNodePaused,
+		},
+		{
+			name: "shutdown", ready: v1.ConditionFalse,
+			modify:     func(in *Input) { in.ShuttingDown = true },
+			wantAction: ActionSuppress, wantReason: ReasonShutdown,
+		},
+		{
+			name: "paused node of a ready rule match", ready: v1.ConditionTrue,
+			policy:     "  rules:\n  - name: drain-workers\n    expression: node.metadata.labels.role == 'worker'\n",
+			modify:     func(in *Input) { in.State.Paused = true },
+			wantAction: ActionSuppress, wantReason: ReasonNodePaused,
+		},
+
+		// Order of the checks: the first one applying decides.
+		{
+			name: "manual intervention before kill switch", ready: v1.ConditionFalse,
+			modify: func(in *Input) {
+				in.State.Status = health.StatusManualIntervention
+				in.KillSwitch = "ConfigMap kube-system/kill-switch"
+			},
+			wantAction: ActionNone, wantReason: ReasonManualIntervention,
+		},
+		{
+			name: "kill switch before shutdown", ready: v1.ConditionFalse,
+			modify: func(in *Input) {
+				in.KillSwitch = "ConfigMap kube-system/kill-switch"
+				in.ShuttingDown = true
+			},
+			wantAction: ActionSuppress, wantReason: ReasonKillSwitch,
+		},
+		{
+			name: "shutdown before pauses", ready: v1.ConditionFalse,
+			modify: func(in *Input) {
+				in.ShuttingDown = true
+				in.ControllerPaused = true
+				in.State.Paused = true
+			},
+			wantAction: ActionSuppress, wantReason: ReasonShutdown,
+		},
+		{
+			name: "controller pause before node pause", ready: v1.ConditionFalse,
+			modify: func(in *Input) {
+				in.ControllerPaused = true
+				in.State.Paused = true
+			},
+			wantAction: ActionSuppress, wantReason: ReasonControllerPaused,
+		},
+		{
+			name: "node pause before partition", ready: v1.ConditionFalse,
+			modify: func(in *Input) {
+				in.State.Paused = true
+				in.Partition = "API server unreachable"
+			},
+			wantAction: ActionSuppress, wantReason: ReasonNodePaused,
+		},
+		{
+			name: "paused node outside maintenance window", ready: v1.ConditionFalse,
+			policy:     "  windows:\n  - start: \"01:00\"\n    end: \"03:00\"\n",
+			modify:     func(in *Input) { in.State.Paused = true },
+			wantAction: ActionSuppress, wantReason: ReasonNodePaused,
+		},
+		{
+			name: "partition outside maintenance window", ready: v1.ConditionFalse,
+			policy:     "  windows:\n  - start: \"01:00\"\n    end: \"03:00\"\n",
+			modify:     func(in *Input) { in.Partition = "API server unreachable" },
+			wantAction: ActionSuppress, wantReason: ReasonPartition,
+		},
+		{
+			name: "new node outside maintenance window", ready: v1.ConditionFalse,
+			policy: "  windows:\n  - start: \"01:00\"\n    end: \"03:00\"\n",
+			modify: func(in *Input) {
+				in.NewNodeThreshold = time.Hour
+				in.Node.CreationTimestamp = metav1.NewTime(testNow.Add(-5 * time.Minute))
+			},
+			wantAction: ActionSuppress, wantReason: ReasonNewNode,
+		},
+		{
+			name: "outside maintenance window with the budget used up", ready: v1.ConditionFalse,
+			policy:     "  windows:\n  - start: \"01:00\"\n    end: \"03:00\"\n  budgets:\n    maxConcurrent: 1\n",
+			modify:     func(in *Input) { in.Budget.InFlight = 1 },
+			wantAction: ActionSuppress, wantReason: ReasonOutsideWindow,
+		},
+		{
+			name: "max concurrent before max per hour", ready: v1.ConditionFalse,
+			policy: "  budgets:\n    maxConcurrent: 1\n    maxPerHour: 1\n",
+			modify: func(in *Input) {
+				in.Budget.InFlight = 1
+				in.Budget.StartedLastHour = 1
+			},
+			wantAction: ActionSuppress, wantReason: ReasonMaxConcurrent,
+		},
+		{
+			name: "rule remediating a ready node outside maintenance window", ready: v1.ConditionTrue,
+			policy:     "  windows:\n  - start: \"01:00\"\n    end: \"03:00\"\n  rules:\n  - name: drain-workers\n    expression: node.metadata.labels.role == 'worker'\n",
+			wantAction: ActionSuppress, wantReason: ReasonOutsideWindow,
+		},
+		{
+			name: "rule remediating a ready node over budget", ready: v1.ConditionTrue,
+			policy:     "  budgets:\n    maxPerHour: 3\n  rules:\n  - name: drain-workers\n    expression: node.metadata.labels.role == 'worker'\n",
+			modify:     func(in *Input) { in.Budget.StartedLastHour = 3 },
+			wantAction: ActionSuppress, wantReason: ReasonMaxPerHour,
+		},
+
+		// Where the ladder starts.
+		{
+			name: "start-step annotation", ready: v1.ConditionFalse,
+			modify:     func(in *Input) { in.Node.Annotations = map[string]string{StartStepAnnotation: "ssh_and_reboot"} },
+			wantAction: ActionRemediate, wantReason: ReasonNotReady, wantStart: "ssh_and_reboot",
+		},
+		{
+			name: "start-step annotation naming a step outside the ladder", ready: v1.ConditionFalse,
+			modify:     func(in *Input) { in.Node.Annotations = map[string]string{StartStepAnnotation: "hard_reboot"} },
+			wantAction: ActionRemediate, wantReason: ReasonNotReady, wantStart: "restart_kubelet",
+		},
+		{
+			name: "start-step annotation over the unreachable-probe skip", ready: v1.ConditionUnknown,
+			modify: func(in *Input) {
+				in.Policy.Ladder = []string{config.StepRestartKubelet, config.StepSSHAndReboot, config.StepHardReboot}
+				in.Node.Annotations = map[string]string{StartStepAnnotation: "ssh_and_reboot"}
+				in.Probe = unreachable
+			},
+			wantAction: ActionRemediate, wantReason: ReasonNotReady, wantStart: "ssh_and_reboot",
+		},
+		{
+			name: "start-step annotation over the budget", ready: v1.ConditionFalse,
+			policy: "  budgets:\n    maxConcurrent: 1\n",
+			modify: func(in *Input) {
+				in.Node.Annotations = map[string]string{StartStepAnnotation: "ssh_and_reboot"}
+				in.Budget.InFlight = 1
+			},
+			wantAction: ActionSuppress, wantReason: ReasonMaxConcurrent,
+		},
+		{
+			name: "unreachable node skips the steps needing SSH", ready: v1.ConditionUnknown,
+			modify: func(in *Input) {
+				in.Policy.Ladder = []string{config.StepRestartKubelet, config.StepSSHAndReboot, config.StepHardReboot}
+				in.Probe = unreachable
+			},
+			wantAction: ActionRemediate, wantReason: ReasonNotReady, wantStart: "hard_reboot",
+		},
+		{
+			name: "unreachable node with only steps needing SSH", ready: v1.ConditionUnknown,
+			modify:     func(in *Input) { in.Probe = unreachable },
+			wantAction: ActionRemediate, wantReason: ReasonNotReady, wantStart: "restart_kubelet",
+		},
+		{
+			name: "reachable node over SSH with its kubelet down", ready: v1.ConditionUnknown,
+			modify: func(in *Input) {
+				in.Policy.Ladder = []string{config.StepSSHAndReboot, config.StepRestartKubelet}
+				in.Probe = &health.ProbeResult{Address: "10.0.0.1", SSH: true}
+			},
+			wantAction: ActionRemediate, wantReason: ReasonNotReady, wantStart: "restart_kubelet",
+		},
+		{
+			name: "reboot loop skips the reboot steps", ready: v1.ConditionFalse,
+			modify: func(in *Input) {
+				in.Policy.Ladder = []string{config.StepSSHAndReboot, config.StepHardReboot, config.StepDeleteViaRancher}
+				in.State.Attempts = reboots(10*time.Minute, 40*time.Minute)
+			},
+			wantAction: ActionRemediate, wantReason: ReasonNotReady, wantStart: "delete_via_rancher",
+		},
+		{
+			name: "single reboot is no loop", ready: v1.ConditionFalse,
+			modify: func(in *Input) {
+				in.Policy.Ladder = []string{config.StepSSHAndReboot, config.StepHardReboot, config.StepDeleteViaRancher}
+				in.State.Attempts = reboots(10 * time.Minute)
+			},
+			wantAction: ActionRemediate, wantReason: ReasonNotReady, wantStart: "ssh_and_reboot",
+		},
+		{
+			name: "reboots older than the loop window are no loop", ready: v1.ConditionFalse,
+			modify: func(in *Input) {
+				in.Policy.Ladder = []string{config.StepSSHAndReboot, config.StepHardReboot, config.StepDeleteViaRancher}
+				in.State.Attempts = reboots(10*time.Minute, 2*time.Hour)
+			},
+			wantAction: ActionRemediate, wantReason: ReasonNotReady, wantStart: "ssh_and_reboot",
+		},
+		{
+			name: "reboot loop overrides the kubelet restart of a reachable node", ready: v1.ConditionUnknown,
+			modify: func(in *Input) {
+				in.Policy.Ladder = []string{config.StepSSHAndReboot, config.StepDeleteViaRancher, config.StepRestartKubelet}
+				in.Probe = &health.ProbeResult{Address: "10.0.0.1", SSH: true}
+				in.State.Attempts = reboots(10*time.Minute, 40*time.Minute)
+			},
+			wantAction: ActionRemediate, wantReason: ReasonNotReady, wantStart: "delete_via_rancher",
+		},
+		{
+			name: "reboot loop with only reboot steps", ready: v1.ConditionFalse,
+			modify: func(in *Input) {
+				in.Policy.Ladder = []string{config.StepSSHAndReboot, config.StepHardReboot}
+				in.State.Attempts = reboots(10*time.Minute, 40*time.Minute)
+			},
+			wantAction: ActionRemediate, wantReason: ReasonNotReady, wantStart: "ssh_and_reboot",
+		},
+		{
+			name: "reboot loop of a node paused by an operator", ready: v1.ConditionFalse,
+			modify: func(in *Input) {
+				in.State.Attempts = reboots(10*time.Minute, 40*time.Minute)
+				in.State.Paused = true
+			},
+			wantAction: ActionSuppress, wantReason: ReasonNodePaused,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := Input{
+				Cluster: "test",
+				Node:    testNode(tt.ready),
+				Now:     testNow,
+				Policy:  testPolicy(t, tt.policy),
+			}
+			if tt.modify != nil {
+				tt.modify(&in)
+			}
+
+			d := Decide(in)
+			if d.Action != tt.wantAction || d.Reason != tt.wantReason || d.StartStep != tt.wantStart {
+				t.Errorf("Decide = %s (%s) starting at %q, want %s (%s) starting at %q; reasons: %q", d.Action, d.Reason, d.StartStep, tt.wantAction, tt.wantReason, tt.wantStart, d.Reasons)
+			}
+			if len(d.Reasons) == 0 {
+				t.Error("decision not explained")
+			}
+		})
+	}
+}
@@ -0,0 +1,264 @@
+package rancher
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/supporttools/k8s-node-killer/pkg/config"
+	"github.com/supporttools/k8s-node-killer/pkg/logging"
+	"github.com/supporttools/k8s-node-killer/pkg/tracing"
+)
+
+var logger = logging.SetupLogging()
+
+// Options configures a Rancher API client. Either Token or AccessKey/SecretKey must be set.
+type Options struct {
+	URL                string
+	Token              string // Bearer token
+	AccessKey          string // Basic auth key pair
+	SecretKey          string
+	CAFile             string // PEM bundle used in addition to the system roots
+	InsecureSkipVerify bool
+	Timeout            time.Duration
+	MaxRetries         int
+	RetryBackoff       time.Duration
+}
+
+// Client is a Rancher API client sharing a single HTTP transport between all calls.
+type Client struct {
+	baseURL      string
+	httpClient   *http.Client
+	authHeader   string
+	maxRetries   int
+	retryBackoff time.Duration
+}
+
+// NewClient creates a Rancher API client from the given options.
+func NewClient(opts Options) (*Client, error) {
+	if opts.URL == "" {
+		return nil, fmt.Errorf("rancher URL cannot be empty")
+	}
+
+	var authHeader string
+	switch {
+	case opts.Token != "":
+		authHeader = "Bearer " + opts.Token
+	case opts.AccessKey != "" && opts.SecretKey != "":
+		req := &http.Request{Header: http.Header{}}
+		req.SetBasicAuth(opts.AccessKey, opts.SecretKey)
+		authHeader = req.Header.Get("Authorization")
+	default:
+		return nil, fmt.Errorf("either a bearer token or an access/secret key pair is required")
+	}
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: opts.InsecureSkipVerify}
+	if opts.CAFile != "" {
+		pem, err := os.ReadFile(opts.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read CA bundle %s: %w", opts.CAFile, err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA bundle %s", opts.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if opts.Timeout == 0 {
+		opts.Timeout = 30 * time.Second
+	}
+	if opts.RetryBackoff == 0 {
+		opts.RetryBackoff = 500 * time.Millisecond
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+
+	return &Client{
+		baseURL:      strings.TrimSuffix(opts.URL, "/"),
+		httpClient:   &http.Client{Transport: tracing.Transport(transport), Timeout: opts.Timeout},
+		authHeader:   authHeader,
+		maxRetries:   opts.MaxRetries,
+		retryBackoff: opts.RetryBackoff,
+	}, nil
+}
+
+// NewClientFromConfig creates a Rancher API client from the application configuration.
+// RANCHER_TOKEN takes precedence over the RANCHER_KEY access/secret key pair.
+func NewClientFromConfig(cfg *config.AppConfig) (*Client, error) {
+	opts := Options{
+		URL:                cfg.RancherAPI,
+		Token:              config.RancherToken(),
+		CAFile:             cfg.RancherCAFile,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+		MaxRetries:         3,
+	}
+	if opts.Token == "" {
+		opts.AccessKey, opts.SecretKey, _ = strings.Cut(config.RancherKey(), ":")
+	}
+	return NewClient(opts)
+}
+
+// idempotentMethods may be retried: repeating them has the same effect as sending them once.
+// Other methods, like the POST of the generateKubeconfig action which creates a token on
+// every call, are sent once.
+var idempotentMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodOptions: true,
+	http.MethodPut:     true,
+	http.MethodDelete:  true,
+}
+
+// Do sends a request to the Rancher API and decodes the JSON response into out when out is
+// non-nil. path may be relative to the API URL or an absolute URL returned by the API itself.
+// Network errors, 429 and 5xx responses of idempotent methods are retried with exponential
+// backoff.
+func (c *Client) Do(ctx context.Context, method, path string, body interface{}, out interface{}) error {
+	target := path
+	if !strings.HasPrefix(path, "http://") && !strings.HasPrefix(path, "https://") {
+		target = c.baseURL + path
+	}
+
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return fmt.Errorf("encode request body: %w", err)
+		}
+	}
+
+	maxRetries := c.maxRetries
+	if !idempotentMethods[method] {
+		maxRetries = 0
+	}
+
+	var lastErr error
+	for attempt := 0; attempt <= maxRetries; attempt++ {
+		if attempt > 0 {
+			backoff := c.retryBackoff << (attempt - 1)
+			logger.Debugf("Retrying %s %s in %s (attempt %d/%d): %v", method, target, backoff, attempt, maxRetries, lastErr)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(backoff):
+			}
+		}
+
+		respBody, err := c.send(ctx, method, target, payload)
+		if err == nil {
+			if out != nil && len(respBody) > 0 {
+				if err := json.Unmarshal(respBody, out); err != nil {
+					return fmt.Errorf("decode JSON response: %w", err)
+				}
+			}
+			return nil
+		}
+
+		lastErr = err
+		if !IsRetryable(err) {
+			return err
+		}
+	}
+	return lastErr
+}
+
+// send performs a single HTTP round trip and returns the response body for 2xx responses.
+func (c *Client) send(ctx context.Context, method, target string, payload []byte) ([]byte, error) {
+	var reqBody io.Reader
+	if payload != nil {
+		reqBody = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("create HTTP request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Authorization", c.authHeader)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, &NetworkError{Method: method, URL: target, Err: err}
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, &NetworkError{Method: method, URL: target, Err: err}
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, &APIError{Method: method, URL: target, StatusCode: resp.StatusCode, Body: string(respBody)}
+	}
+	return respBody, nil
+}
+
+// collection is the envelope shared by Rancher's /v3 (norman) and /v1 (steve) list responses.
+type collection struct {
+	Data       []json.RawMessage `json:"data"`
+	Continue   string            `json:"continue"`
+	Pagination struct {
+		Next string `json:"next"`
+	} `json:"pagination"`
+}
+
+// maxListPages bounds the pages List follows, so a server handing out pages endlessly fails
+// the call instead of growing the result without limit.
+const maxListPages = 1000
+
+// List fetches every item of a collection, following /v3 pagination.next links and
+// /v1 continue tokens until the last page. A server returning a page it returned before,
+// or more than maxListPages pages, fails the call.
+func (c *Client) List(ctx context.Context, path string) ([]json.RawMessage, error) {
+	var items []json.RawMessage
+	seen := map[string]bool{path: true}
+	next := path
+	for pages := 1; next != ""; pages++ {
+		if pages > maxListPages {
+			return nil, fmt.Errorf("list %s: more than %d pages", path, maxListPages)
+		}
+		var page collection
+		if err := c.Do(ctx, "GET", next, nil, &page); err != nil {
+			return nil, err
+		}
+		items = append(items, page.Data...)
+
+		switch {
+		case page.Pagination.Next != "":
+			next = page.Pagination.Next
+		case page.Continue != "":
+			next = withQuery(path, "continue", page.Continue)
+		default:
+			next = ""
+		}
+		if seen[next] {
+			return nil, fmt.Errorf("list %s: page %s returned again", path, next)
+		}
+		seen[next] = true
+	}
+	return items, nil
+}
+
+// withQuery appends a query parameter to a path that may already have a query string.
+func withQuery(path, key, value string) string {
+	separator := "?"
+	if strings.Contains(path, "?") {
+		separator = "&"
+	}
+	return path + separator + key + "=" + url.QueryEscape(value)
+}
@@ -0,0 +1,283 @@
+package rancher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestClient(t *testing.T, handler http.Handler) (*Client, *httptest.Server) {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	client, err := NewClient(Options{URL: server.URL, Token: "token-abc", MaxRetries: 3, RetryBackoff: time.Millisecond})
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	return client, server
+}
+
+func TestNewClient(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    Options
+		wantErr bool
+	}{
+		{name: "bearer token", opts: Options{URL: "https://rancher.example.com", Token: "token"}},
+		{name: "key pair", opts: Options{URL: "https://rancher.example.com", AccessKey: "key", SecretKey: "secret"}},
+		{name: "no URL", opts: Options{Token: "token"}, wantErr: true},
+		{name: "no credentials", opts: Options{URL: "https://rancher.example.com"}, wantErr: true},
+		{name: "half a key pair", opts: Options{URL: "https://rancher.example.com", AccessKey: "key"}, wantErr: true},
+		{name: "missing CA file", opts: Options{URL: "https://rancher.example.com", Token: "token", CAFile: "/nonexistent/ca.pem"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewClient(tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewClient error = %v, want error %t", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDoRetries(t *testing.T) {
+	tests := []struct {
+		name      string
+		method    string
+		statuses  []int // Responses in order, the last one repeated
+		wantCalls int32
+		wantErr   func(error) bool
+	}{
+		{name: "GET retried until success", method: "GET", statuses: []int{503, 502, 200}, wantCalls: 3},
+		{name: "GET retried on 429", method: "GET", statuses: []int{429, 200}, wantCalls: 2},
+		{name: "GET gives up after max retries", method: "GET", statuses: []int{500}, wantCalls: 4, wantErr: IsRetryable},
+		{name: "DELETE retried", method: "DELETE", statuses: []int{503, 204}, wantCalls: 2},
+		{name: "POST not retried", method: "POST", statuses: []int{503, 200}, wantCalls: 1, wantErr: IsRetryable},
+		{name: "404 not retried", method: "GET", statuses: []int{404}, wantCalls: 1, wantErr: IsNotFound},
+		{name: "401 not retried", method: "GET", statuses: []int{401}, wantCalls: 1, wantErr: IsUnauthorized},
+		{name: "403 is unauthorized", method: "GET", statuses: []int{403}, wantCalls: 1, wantErr: IsUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			client, _ := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := int(calls.Add(1)) - 1
+				if n >= len(tt.statuses) {
+					n = len(tt.statuses) - 1
+				}
+				if r.Method != tt.method {
+					t.Errorf("method = %s, want %s", r.Method, tt.method)
+				}
+				if got := r.Header.Get("Authorization"); got != "Bearer token-abc" {
+					t.Errorf("Authorization = %q", got)
+				}
+				w.WriteHeader(tt.statuses[n])
+				if tt.statuses[n] == 200 {
+					fmt.Fprint(w, `{"id":"c-1"}`)
+				}
+			}))
+
+			var out struct {
+				ID string `json:"id"`
+			}
+			err := client.Do(context.Background(), tt.method, "/v3/clusters/c-1", nil, &out)
+			if tt.wantErr == nil && err != nil {
+				t.Fatalf("Do: %v", err)
+			}
+			if tt.wantErr != nil && (err == nil || !tt.wantErr(err)) {
+				t.Fatalf("Do error = %v, not of the expected kind", err)
+			}
+			if got := calls.Load(); got != tt.wantCalls {
+				t.Errorf("server called %d times, want %d", got, tt.wantCalls)
+			}
+			if err == nil && tt.method == "GET" && out.ID != "c-1" {
+				t.Errorf("decoded id = %q, want c-1", out.ID)
+			}
+		})
+	}
+}
+
+func TestDoNetworkError(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	client, err := NewClient(Options{URL: server.URL, Token: "token", MaxRetries: 2, RetryBackoff: time.Millisecond})
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	server.Close()
+
+	err = client.Do(context.Background(), "GET", "/v3/clusters", nil, nil)
+	var netErr *NetworkError
+	if !errors.As(err, &netErr) {
+		t.Fatalf("Do error = %v, want a NetworkError", err)
+	}
+	if !IsRetryable(err) || IsNotFound(err) || IsUnauthorized(err) {
+		t.Errorf("network error classified wrongly: retryable %t, not found %t, unauthorized %t", IsRetryable(err), IsNotFound(err), IsUnauthorized(err))
+	}
+}
+
+func TestDoStopsRetryingOnCancel(t *testing.T) {
+	var calls atomic.Int32
+	client, _ := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	client.retryBackoff = time.Hour
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := client.Do(ctx, "GET", "/v3/clusters", nil, nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Do error = %v, want the context error", err)
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("server called %d times, want 1", got)
+	}
+}
+
+func TestAPIError(t *testing.T) {
+	client, server := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"message":"cluster not found"}`)
+	}))
+
+	err := client.Do(context.Background(), "GET", "/v3/clusters/c-missing", nil, nil)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("Do error = %v, want an APIError", err)
+	}
+	if apiErr.StatusCode != http.StatusNotFound || apiErr.Method != "GET" || apiErr.URL != server.URL+"/v3/clusters/c-missing" || apiErr.Body != `{"message":"cluster not found"}` {
+		t.Errorf("APIError = %+v", apiErr)
+	}
+
+	// Wrapped errors keep their kind.
+	if _, err := client.ListClusters(context.Background(), "missing"); !IsNotFound(err) {
+		t.Errorf("ListClusters error = %v, want a wrapped 404", err)
+	}
+}
+
+func TestListPagination(t *testing.T) {
+	t.Run("v3 pagination links", func(t *testing.T) {
+		var serverURL string
+		client, server := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Query().Get("marker") {
+			case "":
+				fmt.Fprintf(w, `{"data":[{"id":"c-1","name":"one"}],"pagination":{"next":"%s/v3/clusters?marker=2"}}`, serverURL)
+			case "2":
+				fmt.Fprintf(w, `{"data":[{"id":"c-2","name":"two"}],"pagination":{"next":"%s/v3/clusters?marker=3"}}`, serverURL)
+			default:
+				fmt.Fprint(w, `{"data":[{"id":"c-3","name":"three"}],"pagination":{}}`)
+			}
+		}))
+		serverURL = server.URL
+
+		clusters, err := client.ListClusters(context.Background(), "")
+		if err != nil {
+			t.Fatalf("ListClusters: %v", err)
+		}
+		if len(clusters) != 3 || clusters[0].ID != "c-1" || clusters[2].Name != "three" {
+			t.Errorf("clusters = %+v, want the three pages in order", clusters)
+		}
+	})
+
+	t.Run("v1 continue tokens", func(t *testing.T) {
+		var paths []string
+		client, _ := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			paths = append(paths, r.URL.RequestURI())
+			switch r.URL.Query().Get("continue") {
+			case "":
+				fmt.Fprint(w, `{"data":[{"metadata":{"name":"m-1"}}],"continue":"token/1"}`)
+			default:
+				fmt.Fprint(w, `{"data":[{"metadata":{"name":"m-2"}}]}`)
+			}
+		}))
+
+		machines, err := client.ListMachines(context.Background(), "fleet-default")
+		if err != nil {
+			t.Fatalf("ListMachines: %v", err)
+		}
+		if len(machines) != 2 || machines[1].Metadata.Name != "m-2" {
+			t.Errorf("machines = %+v, want both pages", machines)
+		}
+		if len(paths) != 2 || paths[1] != "/v1/cluster.x-k8s.io.machines/fleet-default?continue=token%2F1" {
+			t.Errorf("requested %v, want the continue token escaped on the second page", paths)
+		}
+	})
+
+	t.Run("error on a later page", func(t *testing.T) {
+		client, _ := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("continue") != "" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			fmt.Fprint(w, `{"data":[{}],"continue":"next"}`)
+		}))
+		if _, err := client.List(context.Background(), "/v1/nodes"); !IsUnauthorized(err) {
+			t.Errorf("List error = %v, want the 403 of the second page", err)
+		}
+	})
+
+	t.Run("repeated continue token", func(t *testing.T) {
+		var requests atomic.Int32
+		client, _ := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests.Add(1)
+			fmt.Fprint(w, `{"data":[{}],"continue":"same"}`)
+		}))
+		if _, err := client.List(context.Background(), "/v1/nodes"); err == nil {
+			t.Error("List of endlessly repeated pages succeeded")
+		}
+		if requests.Load() != 2 {
+			t.Errorf("sent %d requests, want to stop once the token repeats", requests.Load())
+		}
+	})
+
+	t.Run("repeated next link", func(t *testing.T) {
+		var serverURL string
+		var requests atomic.Int32
+		client, server := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests.Add(1)
+			fmt.Fprintf(w, `{"data":[{}],"pagination":{"next":"%s/v3/clusters?marker=2"}}`, serverURL)
+		}))
+		serverURL = server.URL
+		if _, err := client.List(context.Background(), "/v3/clusters"); err == nil {
+			t.Error("List of endlessly repeated pages succeeded")
+		}
+		if requests.Load() != 2 {
+			t.Errorf("sent %d requests, want to stop once the link repeats", requests.Load())
+		}
+	})
+
+	t.Run("too many pages", func(t *testing.T) {
+		var requests atomic.Int32
+		client, _ := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, `{"data":[{}],"continue":"%d"}`, requests.Add(1))
+		}))
+		if _, err := client.List(context.Background(), "/v1/nodes"); err == nil {
+			t.Error("List of endless pages succeeded")
+		}
+		if requests.Load() != maxListPages {
+			t.Errorf("sent %d requests, want %d", requests.Load(), maxListPages)
+		}
+	})
+}
+
+func TestGenerateKubeconfigNotRetried(t *testing.T) {
+	var calls atomic.Int32
+	client, _ := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if r.Method != "POST" || r.URL.Query().Get("action") != "generateKubeconfig" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+		}
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+
+	if _, err := client.GenerateKubeconfig(context.Background(), "c-1"); err == nil {
+		t.Fatal("GenerateKubeconfig succeeded on a 502")
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("generateKubeconfig sent %d times, want 1: every call creates a token", got)
+	}
+}
@@ -0,0 +1,63 @@
+package rancher
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+)
+
+// Cluster is a downstream cluster as returned by the /v3/clusters API.
+type Cluster struct {
+	ID     string            `json:"id"`
+	Name   string            `json:"name"`
+	State  string            `json:"state"`
+	Labels map[string]string `json:"labels"`
+}
+
+// ListClusters returns every cluster known to Rancher, optionally filtered by name.
+func (c *Client) ListClusters(ctx context.Context, name string) ([]Cluster, error) {
+	path := "/v3/clusters"
+	if name != "" {
+		path += "?name=" + url.QueryEscape(name)
+	}
+
+	items, err := c.List(ctx, path)
+	if err != nil {
+		return nil, fmt.Errorf("list clusters: %w", err)
+	}
+
+	clusters := make([]Cluster, 0, len(items))
+	for _, item := range items {
+		var cluster Cluster
+		if err := json.Unmarshal(item, &cluster); err != nil {
+			return nil, fmt.Errorf("decode cluster: %w", err)
+		}
+		clusters = append(clusters, cluster)
+	}
+	return clusters, nil
+}
+
+// GetClusterID returns the ID of the cluster with the given name.
+func (c *Client) GetClusterID(ctx context.Context, name string) (string, error) {
+	clusters, err := c.ListClusters(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	if len(clusters) == 0 {
+		return "", fmt.Errorf("no cluster ID found for cluster name: %s", name)
+	}
+	return clusters[0].ID, nil
+}
+
+// GenerateKubeconfig generates a kubeconfig for the given cluster ID.
+func (c *Client) GenerateKubeconfig(ctx context.Context, clusterID string) (string, error) {
+	var response struct {
+		Config string `json:"config"`
+	}
+	path := fmt.Sprintf("/v3/clusters/%s?action=generateKubeconfig", url.PathEscape(clusterID))
+	if err := c.Do(ctx, "POST", path, nil, &response); err != nil {
+		return "", fmt.Errorf("generate kubeconfig: %w", err)
+	}
+	return response.Config, nil
+}
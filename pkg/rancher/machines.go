@@ -0,0 +1,47 @@
+package rancher
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+)
+
+// Machine represents a Cluster API machine as returned by Rancher's /v1 API.
+type Machine struct {
+	Metadata struct {
+		Name string `json:"name"`
+	} `json:"metadata"`
+	Spec struct {
+		InfrastructureRef struct {
+			Name string `json:"name"`
+		} `json:"infrastructureRef"`
+	} `json:"spec"`
+}
+
+// ListMachines returns every Cluster API machine in the given namespace.
+func (c *Client) ListMachines(ctx context.Context, namespace string) ([]Machine, error) {
+	items, err := c.List(ctx, "/v1/cluster.x-k8s.io.machines/"+url.PathEscape(namespace))
+	if err != nil {
+		return nil, fmt.Errorf("list machines: %w", err)
+	}
+
+	machines := make([]Machine, 0, len(items))
+	for _, item := range items {
+		var machine Machine
+		if err := json.Unmarshal(item, &machine); err != nil {
+			return nil, fmt.Errorf("decode machine: %w", err)
+		}
+		machines = append(machines, machine)
+	}
+	return machines, nil
+}
+
+// DeleteMachine deletes the Cluster API machine with the given name.
+func (c *Client) DeleteMachine(ctx context.Context, namespace, name string) error {
+	path := fmt.Sprintf("/v1/cluster.x-k8s.io.machines/%s/%s", url.PathEscape(namespace), url.PathEscape(name))
+	if err := c.Do(ctx, "DELETE", path, nil, nil); err != nil {
+		return fmt.Errorf("delete machine %s/%s: %w", namespace, name, err)
+	}
+	return nil
+}
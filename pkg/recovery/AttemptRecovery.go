@@ -2,79 +2,380 @@ package recovery
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"strings"
 	"time"
 
+	"github.com/sirupsen/logrus"
+	"github.com/supporttools/k8s-node-killer/pkg/config"
 	"github.com/supporttools/k8s-node-killer/pkg/health"
 	"github.com/supporttools/k8s-node-killer/pkg/k8sutils"
 	"github.com/supporttools/k8s-node-killer/pkg/logging"
 	"github.com/supporttools/k8s-node-killer/pkg/metrics"
+	"github.com/supporttools/k8s-node-killer/pkg/policy"
+	"github.com/supporttools/k8s-node-killer/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 )
 
 var logger = logging.SetupLogging()
 
-// AttemptRecovery checks node readiness and performs recovery if necessary.
-func AttemptRecovery(ctx context.Context, clientset *kubernetes.Clientset, node *v1.Node) {
-	overallStartTime := time.Now() // Start timing for overall recovery process
+// recoveryStep is a single rung of the recovery ladder. verify decides whether the
+// step brought the node back.
+type recoveryStep struct {
+	name     string
+	run      func(context.Context, kubernetes.Interface, string) bool
+	verify   func(context.Context, kubernetes.Interface, *v1.Node) bool
+	wait     string // Name of the verify span
+	replaces bool   // Verified only when run succeeded: nothing replaces a node that was not deleted
+}
+
+// recoverySteps returns every recovery step this build supports, in the order of the
+// default ladder, acting through the providers of ctx when it carries any.
+func recoverySteps(ctx context.Context) []recoveryStep {
+	cfg := config.FromContext(ctx)
+	hardReboot := k8sutils.HardRebootViaHarvester
+	if cfg.HardRebootProvider == "redfish" {
+		hardReboot = k8sutils.HardRebootViaRedfish
+	}
+
+	// Once the machine is gone the old node never comes back, so the machine
+	// replacement steps wait for a replacement instead: a node in the same pool, or a
+	// running Machine of the same owner.
+	steps := []recoveryStep{
+		{name: config.StepRestartKubelet, run: k8sutils.RestartKubeletViaSSH, verify: k8sutils.WaitForNodeRecovery, wait: "wait_for_recovery"},
+		{name: config.StepSSHAndReboot, run: k8sutils.SshAndRebootNode, verify: k8sutils.WaitForNodeRecovery, wait: "wait_for_recovery"},
+		{name: config.StepHardReboot, run: hardReboot, verify: k8sutils.WaitForNodeRecovery, wait: "wait_for_recovery"},
+		{name: config.StepDeleteViaRancher, run: k8sutils.DeleteNodeViaRancher, verify: k8sutils.WaitForNodeReplacement, wait: "wait_for_replacement", replaces: true},
+		{name: config.StepRemediateViaCAPI, run: k8sutils.RemediateMachineViaClusterAPI, verify: k8sutils.WaitForMachineReplacement, wait: "wait_for_replacement", replaces: true},
+	}
+
+	providers := providersFromContext(ctx)
+	if providers == nil {
+		return steps
+	}
+	var provided []recoveryStep
+	for _, step := range steps {
+		if p, ok := providers.Steps[step.name]; ok {
+			step.run, step.verify = p.Run, p.Verify
+			provided = append(provided, step)
+		}
+	}
+	return provided
+}
 
-	health.RegisterNodeState(node.Name, "initial_check", "started", "")
-	ready, err := k8sutils.IsNodeReady(ctx, clientset, node.Name)
+// recoveryLadder returns the named recovery steps in the order they should be attempted,
+// from least to most disruptive.
+func recoveryLadder(ctx context.Context, names []string) []recoveryStep {
+	available := make(map[string]recoveryStep)
+	for _, step := range recoverySteps(ctx) {
+		available[step.name] = step
+	}
+
+	var ladder []recoveryStep
+	for _, name := range names {
+		if step, ok := available[name]; ok {
+			ladder = append(ladder, step)
+		}
+	}
+	return ladder
+}
+
+// suppress records that remediation of a not-ready node was skipped by policy or by an operator.
+func suppress(ctx context.Context, cluster, nodeName, reason string) {
+	logging.FromContext(ctx).Printf("Remediation of node %s in cluster %s suppressed: %s.", nodeName, cluster, reason)
+	metrics.RemediationsSuppressed.WithLabelValues(cluster, reason).Inc()
+	transition(ctx, cluster, nodeName, health.StatusSuppressed, reason)
+}
+
+// transition records a node status change, logging transitions the state machine rejects.
+func transition(ctx context.Context, cluster, nodeName string, to health.Status, reason string) {
+	trace.SpanFromContext(ctx).AddEvent("transition", trace.WithAttributes(
+		attribute.String("recovery.status", string(to)),
+		attribute.String("recovery.reason", reason),
+	))
+	if err := health.Transition(cluster, nodeName, to, reason); err != nil {
+		logging.FromContext(ctx).Warnf("Failed to record state of node %s in cluster %s: %v", nodeName, cluster, err)
+	}
+}
+
+// decide runs the policy engine on a node and records the decision. The pods of the node
+// are only listed when a rule refers to them. Checking for a network partition and probing
+// the node directly take network round trips, so they only run when the engine would
+// otherwise remediate the node, which is then decided again with their results.
+func decide(ctx context.Context, clientset kubernetes.Interface, cluster string, node *v1.Node) policy.Decision {
+	cfg := config.FromContext(ctx)
+	var pods []v1.Pod
+	if rulesUsePods(cfg) {
+		var err error
+		if pods, err = nodePods(ctx, clientset, node.Name); err != nil {
+			logging.FromContext(ctx).Warnf("Failed to list pods of node %s: %v", node.Name, err)
+		}
+	}
+	state, _ := health.GetNodeState(cluster, node.Name)
+	_, killSwitch := health.KillSwitch()
+	in := policy.Input{
+		Cluster:          cluster,
+		Node:             node,
+		Pods:             pods,
+		Now:              health.Now(),
+		Policy:           cfg.Policy,
+		NewNodeThreshold: cfg.NewNodeThreshold,
+		State:            state,
+		KillSwitch:       killSwitch,
+		ControllerPaused: health.ControllerPaused(),
+		ShuttingDown:     Draining(),
+		Budget:           budgetUsage(cluster),
+	}
+	decision := policy.Decide(in)
+
+	if decision.Action == policy.ActionRemediate && !nodeReady(node) {
+		in.Partition = detectPartition(ctx, clientset, node)
+		if in.Partition == "" && in.Policy.Probe.Enabled {
+			probeNode := k8sutils.ProbeNode
+			if providers := providersFromContext(ctx); providers != nil && providers.Probe != nil {
+				probeNode = providers.Probe
+			}
+			probe := probeNode(ctx, node, in.Policy.Probe)
+			health.RecordProbe(cluster, node.Name, probe)
+			trace.SpanFromContext(ctx).SetAttributes(
+				attribute.Bool("recovery.probe.ssh", probe.SSH),
+				attribute.Bool("recovery.probe.kubelet", probe.Kubelet),
+			)
+			in.Probe = &probe
+		}
+		if in.Partition != "" || in.Probe != nil {
+			decision = policy.Decide(in)
+		}
+	}
+	policy.Record(decision)
+	recordRuleEvaluations(decision)
+	return decision
+}
+
+// metricsTarget returns the metric labels identifying a node.
+func metricsTarget(ctx context.Context, cluster string, node *v1.Node) metrics.Target {
+	return metrics.NewTarget(ctx, cluster, k8sutils.NodePool(ctx, node), node.Name)
+}
+
+// notReadySince returns when the node's Ready condition last changed, or the zero time when
+// the node reports no Ready condition.
+func notReadySince(node *v1.Node) time.Time {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == v1.NodeReady {
+			return condition.LastTransitionTime.Time
+		}
+	}
+	return time.Time{}
+}
+
+// runStep runs a single recovery step against a node, recording it as an attempt in the
+// node state. It returns whether the node recovered.
+func runStep(ctx context.Context, clientset kubernetes.Interface, cluster string, node *v1.Node, step recoveryStep) bool {
+	attemptID, err := health.StartAttempt(cluster, node.Name, step.name)
+	ctx = logging.WithFields(ctx, logrus.Fields{logging.FieldStep: step.name, logging.FieldAttempt: attemptID})
+	log := logging.FromContext(ctx)
+	log.Printf("Starting recovery step '%s' for node %s...", step.name, node.Name)
 	if err != nil {
-		logger.Printf("Error checking node readiness: %v", err)
-		return
-	}
-	if ready {
-		health.RegisterNodeState(node.Name, "initial_check", "node_ready", "")
-		logger.Printf("Node %s is ready, skipping recovery process.", node.Name)
-		return
-	}
-
-	health.RegisterNodeState(node.Name, "initial_check", "node_not_ready", "")
-	if k8sutils.IsNewNode(node) {
-		health.RegisterNodeState(node.Name, "check_new_node", "ignored", "")
-		logger.Printf("Node %s is less than an hour old and will be ignored.", node.Name)
-		return
-	}
-
-	// Define and execute recovery steps
-	recoverySteps := map[string]func(context.Context, *kubernetes.Clientset, string) bool{
-		"ssh_and_reboot":     k8sutils.SshAndRebootNode,
-		"hard_reboot":        k8sutils.HardRebootViaHarvester,
-		"delete_via_rancher": k8sutils.DeleteNodeViaRancher,
-	}
-
-	allSuccessful := true
-	for stepName, stepFunc := range recoverySteps {
-		logger.Printf("Starting recovery step '%s' for node %s...", stepName, node.Name)
-		stepStartTime := time.Now()
-		metrics.RecoveryAttempts.WithLabelValues(node.Name, stepName).Inc()
-		health.RegisterNodeState(node.Name, stepName, "in_progress", "")
-
-		stepFunc(ctx, clientset, node.Name) // Execute the recovery step
-		if k8sutils.WaitForNodeRecovery(ctx, clientset, node) {
-			logger.Printf("Error waiting for node recovery: %v", err)
-			allSuccessful = false
-			break
-		} else if ready {
-			metrics.RecoverySuccesses.WithLabelValues(node.Name, stepName).Inc()
-			metrics.RecoveryLatencies.WithLabelValues(node.Name, stepName).Observe(time.Since(stepStartTime).Seconds())
-			logger.Printf("Recovery step '%s' successful, node %s has recovered.", stepName, node.Name)
-			health.RegisterNodeState(node.Name, stepName, "success", "")
-			break // Exit the recovery loop if the node has recovered
-		} else {
-			metrics.RecoveryFailures.WithLabelValues(node.Name, stepName).Inc()
-			metrics.RecoveryLatencies.WithLabelValues(node.Name, stepName).Observe(time.Since(stepStartTime).Seconds())
-			health.RegisterNodeState(node.Name, stepName, "failure", "")
-			allSuccessful = false // Mark as unsuccessful if any step fails
+		log.Warnf("Failed to record attempt of step '%s' for node %s: %v", step.name, node.Name, err)
+	}
+	stepStartTime := health.Now()
+	target := metricsTarget(ctx, cluster, node)
+	metrics.RecoveryAttempts.WithLabelValues(target.Labels(step.name)...).Inc()
+
+	ctx, span := tracing.Tracer().Start(ctx, "recovery.step", trace.WithAttributes(
+		attribute.String("recovery.step", step.name),
+		attribute.String("recovery.attempt_id", attemptID),
+	))
+
+	stepCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	verifyCtx, cancelVerify := context.WithCancel(stepCtx)
+	defer cancelVerify()
+	skipped := registerStep(cluster, node.Name, cancel, cancelVerify)
+	defer unregisterStep(cluster, node.Name)
+
+	// A rebooted node may come back even when the step reports a failure, so verify anyway,
+	// unless the kill switch was engaged while the step ran. A failed replacement is not
+	// waited for.
+	runCtx, runSpan := tracing.Tracer().Start(stepCtx, step.name)
+	ran := step.run(runCtx, clientset, node.Name)
+	runSpan.SetAttributes(attribute.Bool("recovery.step_succeeded", ran))
+	runSpan.End()
+	if haltReason() != "" {
+		cancelVerify()
+	}
+
+	recovered := false
+	if ran || !step.replaces {
+		verifyCtx, verifySpan := tracing.Tracer().Start(verifyCtx, step.wait)
+		recovered = step.verify(verifyCtx, clientset, node)
+		verifySpan.SetAttributes(attribute.Bool("recovery.node_recovered", recovered))
+		verifySpan.End()
+	}
+
+	var stepErr error
+	switch {
+	case recovered:
+	case skipped.Load():
+		stepErr = fmt.Errorf("step %s skipped by an operator", step.name)
+	case verifyCtx.Err() != nil && Draining():
+		stepErr = fmt.Errorf("step %s %w by shutdown", step.name, health.ErrInterrupted)
+	case verifyCtx.Err() != nil && stepCtx.Err() == nil:
+		stepErr = fmt.Errorf("step %s %w by the kill switch", step.name, health.ErrInterrupted)
+	case !ran:
+		stepErr = fmt.Errorf("step %s failed and the node did not recover", step.name)
+	default:
+		stepErr = fmt.Errorf("node did not recover after step %s", step.name)
+	}
+
+	metrics.RecoveryLatencies.WithLabelValues(target.Labels(step.name)...).Observe(health.Since(stepStartTime).Seconds())
+	attempt, _ := health.FinishAttempt(cluster, node.Name, attemptID, stepErr)
+	tracing.End(span, stepErr)
+	if errors.Is(stepErr, health.ErrInterrupted) {
+		log.Printf("Recovery step '%s' for node %s stopped: %v", step.name, node.Name, stepErr)
+		if attempt.ID != "" {
+			markInterrupted(ctx, clientset, node.Name, attempt)
+		}
+		return false
+	}
+	if stepErr != nil {
+		metrics.RecoveryFailures.WithLabelValues(target.Labels(step.name)...).Inc()
+		log.Printf("Recovery step '%s' for node %s failed: %v", step.name, node.Name, stepErr)
+		return false
+	}
+	metrics.RecoverySuccesses.WithLabelValues(target.Labels(step.name)...).Inc()
+	log.Printf("Recovery step '%s' successful, node %s has recovered.", step.name, node.Name)
+	return true
+}
+
+// AttemptRecovery checks node readiness and performs recovery if necessary, returning once
+// the remediation, if any, ended.
+func AttemptRecovery(ctx context.Context, clientset kubernetes.Interface, node *v1.Node) {
+	if remediate := Evaluate(ctx, clientset, node); remediate != nil {
+		remediate()
+	}
+}
+
+// Evaluate checks node readiness and returns the remediation to run when the node needs
+// one, or nil. The remediation holds a slot of the cluster's budgets until it returns, so
+// it must be run. The whole attempt uses the configuration snapshot of ctx, or the active
+// configuration when it carries none, so a reload never applies halfway through an attempt.
+func Evaluate(ctx context.Context, clientset kubernetes.Interface, node *v1.Node) (remediate func()) {
+	start := health.Now()
+	cfg := config.FromContext(ctx)
+	ctx = config.WithSnapshot(ctx, cfg)
+	cluster := health.ClusterFromContext(ctx)
+	ctx = logging.WithField(ctx, logging.FieldNode, node.Name)
+	log := logging.FromContext(ctx)
+	ctx, span := tracing.Tracer().Start(ctx, "AttemptRecovery", trace.WithAttributes(
+		attribute.String("k8s.cluster.name", cluster),
+		attribute.String("k8s.node.name", node.Name),
+	))
+	defer func() {
+		if remediate == nil {
+			span.End()
+		}
+	}()
+
+	// Decide on the latest version of the node, the informer's may lag behind.
+	current, err := clientset.CoreV1().Nodes().Get(ctx, node.Name, metav1.GetOptions{})
+	if err != nil {
+		log.Printf("Error getting node %s: %v", node.Name, err)
+		return nil
+	}
+	node = current
+	restoreInterrupted(ctx, clientset, cluster, node)
+
+	decision := decide(ctx, clientset, cluster, node)
+	span.SetAttributes(
+		attribute.String("recovery.decision", string(decision.Action)),
+		attribute.String("recovery.decision_reason", decision.Reason),
+		attribute.String("recovery.rule", decision.Rule),
+	)
+	log.Debugf("Decided %s for node %s (%s): %s", decision.Action, node.Name, decision.Reason, strings.Join(decision.Reasons, " "))
+	switch decision.Action {
+	case policy.ActionNone:
+		if decision.Reason == policy.ReasonReady {
+			transition(ctx, cluster, node.Name, health.StatusHealthy, "")
 		}
+		return nil
+	case policy.ActionSuppress:
+		suppress(ctx, cluster, node.Name, decision.Reason)
+		return nil
+	}
+
+	// Another remediation may have used up the budget since the decision.
+	if reason := acquireBudget(cfg, cluster); reason != "" {
+		suppress(ctx, cluster, node.Name, reason)
+		return nil
+	}
+	if !startWork() {
+		releaseBudget(cluster)
+		suppress(ctx, cluster, node.Name, policy.ReasonShutdown)
+		return nil
+	}
+	metrics.RemediationsInFlight.WithLabelValues(cluster).Inc()
+	transition(ctx, cluster, node.Name, health.StatusPending, "")
+
+	return func() {
+		defer span.End()
+		defer releaseBudget(cluster)
+		defer finishWork()
+		defer metrics.RemediationsInFlight.WithLabelValues(cluster).Dec()
+		climbLadder(ctx, clientset, cluster, node, decision, start)
 	}
+}
+
+// climbLadder climbs the recovery ladder of the decision until a step recovers the node, the
+// remediation is halted or the ladder is exhausted.
+func climbLadder(ctx context.Context, clientset kubernetes.Interface, cluster string, node *v1.Node, decision policy.Decision, start time.Time) {
+	cfg := config.FromContext(ctx)
+	log := logging.FromContext(ctx)
+	span := trace.SpanFromContext(ctx)
 
-	overallRecoveryDuration := time.Since(overallStartTime)
-	metrics.RecoveryTime.WithLabelValues(node.Name).Observe(overallRecoveryDuration.Seconds())
-	if !allSuccessful {
-		logger.Printf("Failed to fully recover node %s, manual intervention required.", node.Name)
-		metrics.NodeDowntime.WithLabelValues(node.Name).Observe(overallRecoveryDuration.Seconds())
-		health.RegisterNodeState(node.Name, "overall_recovery", "manual_intervention_required", "")
+	target := metricsTarget(ctx, cluster, node)
+	metrics.Incidents.WithLabelValues(target.Labels()...).Inc()
+	ladder := recoveryLadder(ctx, decision.Ladder)
+	if rule := findRule(cfg, decision.Rule); rule != nil {
+		// A rule may remediate a Ready node, which then has to stop matching to recover.
+		// A replacement node is a new node, so its wait needs no rule check.
+		for i := range ladder {
+			if ladder[i].wait == "wait_for_recovery" {
+				ladder[i].verify = untilRuleCleared(rule, ladder[i].verify)
+			}
+		}
 	}
+	for i, step := range ladder {
+		if reason := haltReason(); reason != "" {
+			suppress(ctx, cluster, node.Name, reason)
+			return
+		}
+		if runStep(ctx, clientset, cluster, node, step) {
+			transition(ctx, cluster, node.Name, health.StatusRecovered, step.name)
+			metrics.RecoveryTime.WithLabelValues(target.Labels()...).Observe(health.Since(start).Seconds())
+			if since := notReadySince(node); !since.IsZero() {
+				metrics.NodeDowntime.WithLabelValues(target.Labels()...).Observe(health.Since(since).Seconds())
+			}
+			return
+		}
+		if reason := haltReason(); reason != "" {
+			suppress(ctx, cluster, node.Name, reason)
+			return
+		}
+		if i < len(ladder)-1 {
+			transition(ctx, cluster, node.Name, health.StatusEscalated, "step "+step.name+" failed")
+		}
+	}
+
+	metrics.RecoveryTime.WithLabelValues(target.Labels()...).Observe(health.Since(start).Seconds())
+	log.Printf("Failed to fully recover node %s, manual intervention required.", node.Name)
+	metrics.ManualInterventions.WithLabelValues(target.Labels()...).Inc()
+	transition(ctx, cluster, node.Name, health.StatusManualIntervention, "all recovery steps failed")
+	span.SetStatus(codes.Error, "manual intervention required")
 }
@@ -0,0 +1,69 @@
+package recovery
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/supporttools/k8s-node-killer/pkg/health"
+	"github.com/supporttools/k8s-node-killer/pkg/logging"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+// InterruptedAnnotation holds, as JSON, the attempt of a recovery step that the kill switch
+// or a shutdown stopped. Node states live in memory, so the annotation is how the attempt
+// survives a restart of the controller; the next evaluation of the node restores it and
+// removes the annotation.
+const InterruptedAnnotation = "k8s-node-killer.support.tools/interrupted"
+
+// interruptedPatchTimeout bounds the annotation updates. Marking a step interrupted runs
+// while the controller shuts down, after the context of the step was cancelled.
+const interruptedPatchTimeout = 3 * time.Second
+
+// markInterrupted records an interrupted attempt in the annotation of the node.
+func markInterrupted(ctx context.Context, clientset kubernetes.Interface, nodeName string, attempt health.Attempt) {
+	value, err := json.Marshal(attempt)
+	if err == nil {
+		err = patchInterrupted(ctx, clientset, nodeName, string(value))
+	}
+	if err != nil {
+		logging.FromContext(ctx).Warnf("Failed to record the interrupted step '%s' on node %s: %v", attempt.Step, nodeName, err)
+	}
+}
+
+// restoreInterrupted adds the interrupted attempt recorded on the node, if any, to its state
+// and removes the annotation.
+func restoreInterrupted(ctx context.Context, clientset kubernetes.Interface, cluster string, node *v1.Node) {
+	value, ok := node.Annotations[InterruptedAnnotation]
+	if !ok {
+		return
+	}
+	log := logging.FromContext(ctx)
+	var attempt health.Attempt
+	if err := json.Unmarshal([]byte(value), &attempt); err != nil || attempt.ID == "" {
+		log.Warnf("Ignoring invalid %s annotation of node %s: %q", InterruptedAnnotation, node.Name, value)
+	} else {
+		health.RestoreAttempt(cluster, node.Name, attempt)
+		log.Printf("Restored attempt %s of node %s from a previous run: %s.", attempt.ID, node.Name, attempt.Error)
+	}
+	if err := patchInterrupted(ctx, clientset, node.Name, nil); err != nil {
+		log.Warnf("Failed to remove the %s annotation of node %s: %v", InterruptedAnnotation, node.Name, err)
+	}
+}
+
+// patchInterrupted sets the annotation to value, or removes it when value is nil.
+func patchInterrupted(ctx context.Context, clientset kubernetes.Interface, nodeName string, value interface{}) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{"annotations": map[string]interface{}{InterruptedAnnotation: value}},
+	})
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), interruptedPatchTimeout)
+	defer cancel()
+	_, err = clientset.CoreV1().Nodes().Patch(ctx, nodeName, types.MergePatchType, patch, metav1.PatchOptions{})
+	return err
+}
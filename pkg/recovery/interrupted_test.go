@@ -0,0 +1,76 @@
+package recovery
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/supporttools/k8s-node-killer/pkg/health"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestInterruptedAttemptSurvivesRestart(t *testing.T) {
+	const cluster = "interrupted-test"
+	t.Cleanup(func() { health.ForgetCluster(cluster) })
+	ctx := context.Background()
+	clientset := fake.NewSimpleClientset(&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1"}})
+
+	// A step stopped by a shutdown, whose context is already cancelled.
+	health.Transition(cluster, "node-1", health.StatusPending, "")
+	id, err := health.StartAttempt(cluster, "node-1", "reboot")
+	if err != nil {
+		t.Fatalf("StartAttempt: %v", err)
+	}
+	attempt, _ := health.FinishAttempt(cluster, "node-1", id, fmt.Errorf("step reboot %w by shutdown", health.ErrInterrupted))
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	markInterrupted(cancelled, clientset, "node-1", attempt)
+
+	// The next run of the controller starts without any node state.
+	health.ForgetCluster(cluster)
+	node, err := clientset.CoreV1().Nodes().Get(ctx, "node-1", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := node.Annotations[InterruptedAnnotation]; !ok {
+		t.Fatalf("node not annotated, annotations %v", node.Annotations)
+	}
+	restoreInterrupted(ctx, clientset, cluster, node)
+	restoreInterrupted(ctx, clientset, cluster, node) // The informer may lag behind the removal
+
+	state, _ := health.GetNodeState(cluster, "node-1")
+	if len(state.Attempts) != 1 {
+		t.Fatalf("attempts after the restart = %+v, want the interrupted one", state.Attempts)
+	}
+	restored := state.Attempts[0]
+	if restored.ID != id || restored.Result != health.ResultInterrupted || restored.Step != "reboot" || restored.FinishedAt == nil || !restored.FinishedAt.Equal(*attempt.FinishedAt) {
+		t.Errorf("restored attempt = %+v, want %+v", restored, attempt)
+	}
+
+	node, err = clientset.CoreV1().Nodes().Get(ctx, "node-1", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value, ok := node.Annotations[InterruptedAnnotation]; ok {
+		t.Errorf("annotation %q left on the node after restoring it", value)
+	}
+}
+
+func TestRestoreAttemptKeepsHistoryOrdered(t *testing.T) {
+	const cluster = "restore-test"
+	t.Cleanup(func() { health.ForgetCluster(cluster) })
+
+	health.Transition(cluster, "node-1", health.StatusPending, "")
+	id, _ := health.StartAttempt(cluster, "node-1", "restart_kubelet")
+	health.FinishAttempt(cluster, "node-1", id, nil)
+	earlier := time.Now().Add(-time.Hour)
+	health.RestoreAttempt(cluster, "node-1", health.Attempt{ID: "old", Step: "reboot", StartedAt: earlier, FinishedAt: &earlier, Result: health.ResultInterrupted})
+
+	state, _ := health.GetNodeState(cluster, "node-1")
+	if len(state.Attempts) != 2 || state.Attempts[0].ID != "old" || state.Attempts[1].ID != id {
+		t.Errorf("attempts = %+v, want the restored one first", state.Attempts)
+	}
+}
@@ -0,0 +1,134 @@
+package recovery
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/supporttools/k8s-node-killer/pkg/config"
+	"github.com/supporttools/k8s-node-killer/pkg/health"
+	"github.com/supporttools/k8s-node-killer/pkg/logging"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// runningStep is a recovery step in progress that an operator may skip or the kill switch
+// may interrupt.
+type runningStep struct {
+	cancel       context.CancelFunc // Cancels the whole step
+	cancelVerify context.CancelFunc // Cancels only the wait for the node to recover
+	skipped      *atomic.Bool
+	started      time.Time
+}
+
+var (
+	runningStepsMu sync.Mutex
+	runningSteps   = make(map[string]runningStep) // Keyed by cluster/node
+)
+
+// registerStep makes the step running on a node skippable through SkipStep and
+// interruptible through InterruptAll. The returned flag is set when the step was skipped.
+func registerStep(cluster, nodeName string, cancel, cancelVerify context.CancelFunc) *atomic.Bool {
+	runningStepsMu.Lock()
+	defer runningStepsMu.Unlock()
+
+	skipped := &atomic.Bool{}
+	runningSteps[cluster+"/"+nodeName] = runningStep{cancel: cancel, cancelVerify: cancelVerify, skipped: skipped, started: health.Now()}
+	return skipped
+}
+
+func unregisterStep(cluster, nodeName string) {
+	runningStepsMu.Lock()
+	defer runningStepsMu.Unlock()
+
+	delete(runningSteps, cluster+"/"+nodeName)
+}
+
+// LongestRunningStep returns the node of the cluster whose recovery step has been running the
+// longest, and for how long. The duration is zero when no step is running.
+func LongestRunningStep(cluster string) (string, time.Duration) {
+	runningStepsMu.Lock()
+	defer runningStepsMu.Unlock()
+
+	node, longest := "", time.Duration(0)
+	for key, step := range runningSteps {
+		name, ok := strings.CutPrefix(key, cluster+"/")
+		if running := health.Since(step.started); ok && running > longest {
+			node, longest = name, running
+		}
+	}
+	return node, longest
+}
+
+// SkipStep abandons the recovery step running on a node, so the ladder moves on to the
+// next rung. It reports whether a step was running.
+func SkipStep(cluster, nodeName string) bool {
+	runningStepsMu.Lock()
+	defer runningStepsMu.Unlock()
+
+	step, ok := runningSteps[cluster+"/"+nodeName]
+	if !ok {
+		return false
+	}
+	step.skipped.Store(true)
+	step.cancel()
+	return true
+}
+
+// InterruptAll stops waiting for nodes to recover from their running steps. Actions already
+// sent to a node, such as a reboot or a drain, are left to complete: only the wait after
+// them is a safe point to stop at.
+func InterruptAll() {
+	runningStepsMu.Lock()
+	defer runningStepsMu.Unlock()
+
+	for _, step := range runningSteps {
+		step.cancelVerify()
+	}
+}
+
+// RunStep runs the named recovery step against a node immediately, bypassing the policy,
+// the budgets and the rest of the ladder. It is used by operators through the admin API.
+func RunStep(ctx context.Context, clientset kubernetes.Interface, node *v1.Node, stepName string) error {
+	ctx = config.WithSnapshot(ctx, config.FromContext(ctx))
+	var step recoveryStep
+	for _, candidate := range recoverySteps(ctx) {
+		if candidate.name == stepName {
+			step = candidate
+			break
+		}
+	}
+	if step.run == nil {
+		return fmt.Errorf("unknown recovery step %q", stepName)
+	}
+
+	if !startWork() {
+		return fmt.Errorf("the controller is shutting down")
+	}
+	defer finishWork()
+
+	cluster := health.ClusterFromContext(ctx)
+	ctx = logging.WithField(ctx, logging.FieldNode, node.Name)
+	if err := health.Transition(cluster, node.Name, health.StatusPending, "triggered by an operator"); err != nil {
+		return err
+	}
+	if runStep(ctx, clientset, cluster, node, step) {
+		transition(ctx, cluster, node.Name, health.StatusRecovered, step.name)
+		return nil
+	}
+	if reason := haltReason(); reason != "" {
+		suppress(ctx, cluster, node.Name, reason)
+		return fmt.Errorf("step %s on node %s stopped: %s", step.name, node.Name, reason)
+	}
+	transition(ctx, cluster, node.Name, health.StatusEscalated, "operator-triggered step "+step.name+" failed")
+	return fmt.Errorf("node %s did not recover after step %s", node.Name, step.name)
+}
+
+// IsKnownStep reports whether name is a recovery step that RunStep can run.
+func IsKnownStep(name string) bool {
+	return slices.Contains(config.RecoverySteps, name)
+}
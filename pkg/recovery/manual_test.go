@@ -0,0 +1,30 @@
+package recovery
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLongestRunningStep(t *testing.T) {
+	if node, running := LongestRunningStep("steps-test"); running != 0 {
+		t.Fatalf("step on node %s running for %s before any started", node, running)
+	}
+	for _, name := range []string{"node-1", "node-2"} {
+		registerStep("steps-test", name, func() {}, func() {})
+		t.Cleanup(func() { unregisterStep("steps-test", name) })
+	}
+	registerStep("other-cluster", "node-3", func() {}, func() {})
+	t.Cleanup(func() { unregisterStep("other-cluster", "node-3") })
+
+	runningStepsMu.Lock()
+	for key, started := range map[string]time.Duration{"steps-test/node-2": time.Hour, "other-cluster/node-3": 2 * time.Hour} {
+		step := runningSteps[key]
+		step.started = time.Now().Add(-started)
+		runningSteps[key] = step
+	}
+	runningStepsMu.Unlock()
+
+	if node, running := LongestRunningStep("steps-test"); node != "node-2" || running < time.Hour || running > 2*time.Hour {
+		t.Errorf("longest running step on node %s for %s, want node-2 for an hour", node, running)
+	}
+}
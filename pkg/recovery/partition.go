@@ -0,0 +1,90 @@
+package recovery
+
+import (
+	"context"
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/supporttools/k8s-node-killer/pkg/config"
+)
+
+// detectPartition returns why a NotReady node more likely lost contact with the controller
+// than failed, or an empty string when the node looks genuinely down:
+//   - the API server of the cluster does not answer the controller
+//   - many nodes of the cluster went NotReady within the same window as the node, as
+//     happens when the controller or the Rancher proxy it talks through loses connectivity
+//
+// The direct probe of the node, when enabled, is the third signal; the policy engine weighs
+// its result.
+func detectPartition(ctx context.Context, clientset kubernetes.Interface, node *v1.Node) string {
+	pc := config.FromContext(ctx).Policy.Partition
+	if nodeReady(node) {
+		return ""
+	}
+
+	if err := apiServerAnswers(ctx, clientset, pc); err != nil {
+		return fmt.Sprintf("the API server does not answer the controller: %v", err)
+	}
+
+	if pc.MaxNotReadyRatio > 0 {
+		// Served from the API server's watch cache, cheap enough to run per node.
+		nodes, err := clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{ResourceVersion: "0"})
+		if err != nil {
+			return fmt.Sprintf("the controller cannot list the nodes: %v", err)
+		}
+		if reason := suspectPartition(nodes.Items, node, pc); reason != "" {
+			return reason
+		}
+	}
+	return ""
+}
+
+// apiServerAnswers asks the API server for its version within the probe timeout. Fake
+// clientsets, as the simulator's, have no REST client; their version reactors answer instead.
+func apiServerAnswers(ctx context.Context, clientset kubernetes.Interface, pc config.PartitionConfig) error {
+	client := clientset.Discovery().RESTClient()
+	if client == nil {
+		_, err := clientset.Discovery().ServerVersion()
+		return err
+	}
+	probeCtx, cancel := context.WithTimeout(ctx, pc.ProbeTimeout)
+	defer cancel()
+	return client.Get().AbsPath("/version").Do(probeCtx).Error()
+}
+
+// suspectPartition returns why the nodes of a cluster going NotReady together with the given
+// node suggest a partition rather than failing nodes, or an empty string. Nodes count when
+// they are still NotReady and went NotReady within the window of the node doing so, so the
+// suppression lasts as long as the partition rather than the window.
+func suspectPartition(nodes []v1.Node, node *v1.Node, pc config.PartitionConfig) string {
+	if pc.MaxNotReadyRatio <= 0 || len(nodes) == 0 || len(nodes) < pc.MinNodes {
+		return ""
+	}
+	since := notReadySince(node)
+	together := 0
+	for i := range nodes {
+		if nodeReady(&nodes[i]) {
+			continue
+		}
+		if gap := notReadySince(&nodes[i]).Sub(since); gap >= -pc.Window && gap <= pc.Window {
+			together++
+		}
+	}
+	if float64(together)/float64(len(nodes)) > pc.MaxNotReadyRatio {
+		return fmt.Sprintf("%d of %d nodes went NotReady within %s of each other and are still NotReady", together, len(nodes), pc.Window)
+	}
+	return ""
+}
+
+// nodeReady reports whether the node's Ready condition is True.
+func nodeReady(node *v1.Node) bool {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == v1.NodeReady {
+			return condition.Status == v1.ConditionTrue
+		}
+	}
+	return false
+}
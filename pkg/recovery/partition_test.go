@@ -0,0 +1,64 @@
+package recovery
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/supporttools/k8s-node-killer/pkg/config"
+)
+
+// partitionNode returns a node whose Ready condition changed to status at since.
+func partitionNode(name string, status v1.ConditionStatus, since time.Time) v1.Node {
+	return v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Status: v1.NodeStatus{Conditions: []v1.NodeCondition{{
+			Type:               v1.NodeReady,
+			Status:             status,
+			LastTransitionTime: metav1.NewTime(since),
+		}}},
+	}
+}
+
+func TestSuspectPartition(t *testing.T) {
+	pc := config.PartitionConfig{MaxNotReadyRatio: 0.5, MinNodes: 3, Window: 5 * time.Minute}
+	start := time.Now().Add(-2 * time.Hour) // Far longer ago than the window
+
+	// Four of five nodes went NotReady a minute apart, two hours ago, and never came back.
+	var nodes []v1.Node
+	for i := 0; i < 4; i++ {
+		nodes = append(nodes, partitionNode(fmt.Sprintf("node-%d", i), v1.ConditionUnknown, start.Add(time.Duration(i)*time.Minute)))
+	}
+	nodes = append(nodes, partitionNode("node-4", v1.ConditionTrue, start.Add(-24*time.Hour)))
+	for i := 0; i < 4; i++ {
+		if reason := suspectPartition(nodes, &nodes[i], pc); reason == "" {
+			t.Errorf("%s not suspected partitioned two hours into the partition", nodes[i].Name)
+		}
+	}
+
+	// The partition healed, then a single node failed on its own.
+	for i := 0; i < 4; i++ {
+		nodes[i] = partitionNode(nodes[i].Name, v1.ConditionTrue, start.Add(time.Hour))
+	}
+	nodes[0] = partitionNode("node-0", v1.ConditionFalse, start.Add(90*time.Minute))
+	if reason := suspectPartition(nodes, &nodes[0], pc); reason != "" {
+		t.Errorf("a single failing node suspected partitioned: %s", reason)
+	}
+
+	// Nodes failing one after another, further apart than the window, do not count together.
+	for i := 1; i < 4; i++ {
+		nodes[i] = partitionNode(nodes[i].Name, v1.ConditionFalse, start.Add(time.Duration(90+10*i)*time.Minute))
+	}
+	if reason := suspectPartition(nodes, &nodes[3], pc); reason != "" {
+		t.Errorf("nodes failing %s apart suspected partitioned: %s", 10*time.Minute, reason)
+	}
+
+	// Clusters smaller than MinNodes are not checked.
+	small := []v1.Node{partitionNode("a", v1.ConditionUnknown, start), partitionNode("b", v1.ConditionUnknown, start)}
+	if reason := suspectPartition(small, &small[0], pc); reason != "" {
+		t.Errorf("cluster of %d nodes suspected partitioned: %s", len(small), reason)
+	}
+}
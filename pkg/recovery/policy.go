@@ -0,0 +1,103 @@
+package recovery
+
+import (
+	"sync"
+	"time"
+
+	"github.com/supporttools/k8s-node-killer/pkg/config"
+	"github.com/supporttools/k8s-node-killer/pkg/health"
+	"github.com/supporttools/k8s-node-killer/pkg/policy"
+)
+
+// budget tracks the remediations of a single cluster against the configured budgets.
+type budget struct {
+	inFlight int
+	started  []time.Time // Start times of remediations within the last hour
+}
+
+var (
+	budgetsMu sync.Mutex
+	budgets   = make(map[string]*budget) // Keyed by cluster
+)
+
+// acquireBudget reserves a remediation slot for the cluster. It returns a non-empty reason
+// when the cluster's concurrency or hourly budget is exhausted.
+func acquireBudget(cfg *config.AppConfig, cluster string) string {
+	budgetsMu.Lock()
+	defer budgetsMu.Unlock()
+
+	b, ok := budgets[cluster]
+	if !ok {
+		b = &budget{}
+		budgets[cluster] = b
+	}
+
+	cutoff := health.Now().Add(-time.Hour)
+	recent := b.started[:0]
+	for _, t := range b.started {
+		if t.After(cutoff) {
+			recent = append(recent, t)
+		}
+	}
+	b.started = recent
+
+	limits := cfg.Policy.Budgets
+	if limits.MaxConcurrent > 0 && b.inFlight >= limits.MaxConcurrent {
+		return policy.ReasonMaxConcurrent
+	}
+	if limits.MaxPerHour > 0 && len(b.started) >= limits.MaxPerHour {
+		return policy.ReasonMaxPerHour
+	}
+
+	b.inFlight++
+	b.started = append(b.started, health.Now())
+	return ""
+}
+
+// releaseBudget frees a remediation slot reserved with acquireBudget.
+func releaseBudget(cluster string) {
+	budgetsMu.Lock()
+	defer budgetsMu.Unlock()
+
+	if b, ok := budgets[cluster]; ok && b.inFlight > 0 {
+		b.inFlight--
+	}
+}
+
+// ForgetCluster drops the budget usage of a cluster.
+func ForgetCluster(cluster string) {
+	budgetsMu.Lock()
+	defer budgetsMu.Unlock()
+
+	delete(budgets, cluster)
+}
+
+// InFlight returns the number of remediations currently running in the cluster.
+func InFlight(cluster string) int {
+	budgetsMu.Lock()
+	defer budgetsMu.Unlock()
+
+	if b, ok := budgets[cluster]; ok {
+		return b.inFlight
+	}
+	return 0
+}
+
+// budgetUsage returns the remediation activity of the cluster counted against its budgets.
+func budgetUsage(cluster string) policy.BudgetUsage {
+	budgetsMu.Lock()
+	defer budgetsMu.Unlock()
+
+	b, ok := budgets[cluster]
+	if !ok {
+		return policy.BudgetUsage{}
+	}
+	usage := policy.BudgetUsage{InFlight: b.inFlight}
+	cutoff := health.Now().Add(-time.Hour)
+	for _, t := range b.started {
+		if t.After(cutoff) {
+			usage.StartedLastHour++
+		}
+	}
+	return usage
+}
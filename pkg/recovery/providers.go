@@ -0,0 +1,40 @@
+package recovery
+
+import (
+	"context"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/supporttools/k8s-node-killer/pkg/config"
+	"github.com/supporttools/k8s-node-killer/pkg/health"
+)
+
+// Step stands in for a recovery step: Run takes the action against the node and Verify waits
+// for the node to recover from it, or to be replaced.
+type Step struct {
+	Run    func(ctx context.Context, clientset kubernetes.Interface, nodeName string) bool
+	Verify func(ctx context.Context, clientset kubernetes.Interface, node *v1.Node) bool
+}
+
+// Providers stand in for the systems remediations act through, SSH, Harvester, Redfish,
+// Rancher and Cluster API, and for the direct probes of nodes. The simulator scripts them.
+type Providers struct {
+	Steps map[string]Step                                                                    // By step name; steps left out are unavailable
+	Probe func(ctx context.Context, node *v1.Node, pc config.ProbeConfig) health.ProbeResult // Probes for real when nil
+}
+
+type providersKey struct{}
+
+// WithProviders returns a context whose remediations act through the given providers
+// rather than the real ones.
+func WithProviders(ctx context.Context, providers *Providers) context.Context {
+	return context.WithValue(ctx, providersKey{}, providers)
+}
+
+// providersFromContext returns the providers of ctx, or nil when remediations act through
+// the real ones.
+func providersFromContext(ctx context.Context) *Providers {
+	providers, _ := ctx.Value(providersKey{}).(*Providers)
+	return providers
+}
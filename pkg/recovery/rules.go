@@ -0,0 +1,101 @@
+package recovery
+
+import (
+	"context"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/supporttools/k8s-node-killer/pkg/config"
+	"github.com/supporttools/k8s-node-killer/pkg/health"
+	"github.com/supporttools/k8s-node-killer/pkg/logging"
+	"github.com/supporttools/k8s-node-killer/pkg/metrics"
+	"github.com/supporttools/k8s-node-killer/pkg/policy"
+)
+
+// rulePollInterval is how often a node matched by a rule is re-evaluated after a step.
+const rulePollInterval = 5 * time.Second
+
+// findRule returns the compiled policy rule with the given name, or nil.
+func findRule(cfg *config.AppConfig, name string) *config.Rule {
+	for _, rule := range cfg.Policy.CompiledRules() {
+		if rule.Name == name {
+			return rule
+		}
+	}
+	return nil
+}
+
+// rulesUsePods reports whether any policy rule refers to the pods of a node.
+func rulesUsePods(cfg *config.AppConfig) bool {
+	for _, rule := range cfg.Policy.CompiledRules() {
+		if rule.UsesPods() {
+			return true
+		}
+	}
+	return false
+}
+
+// nodePods lists the pods scheduled on a node.
+func nodePods(ctx context.Context, clientset kubernetes.Interface, nodeName string) ([]v1.Pod, error) {
+	pods, err := clientset.CoreV1().Pods(metav1.NamespaceAll).List(ctx, metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("spec.nodeName", nodeName).String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pods.Items, nil
+}
+
+// recordRuleEvaluations counts the rule evaluations of a decision.
+func recordRuleEvaluations(decision policy.Decision) {
+	for _, result := range decision.Rules {
+		metrics.RuleEvaluations.WithLabelValues(decision.Cluster, result.Rule, result.Result).Inc()
+	}
+}
+
+// untilRuleCleared wraps the verify function of a step run because a rule matched the node:
+// the node only counts as recovered once it is Ready and the rule no longer matches it,
+// within the recovery wait time.
+func untilRuleCleared(rule *config.Rule, verify func(context.Context, kubernetes.Interface, *v1.Node) bool) func(context.Context, kubernetes.Interface, *v1.Node) bool {
+	return func(ctx context.Context, clientset kubernetes.Interface, node *v1.Node) bool {
+		if !verify(ctx, clientset, node) {
+			return false
+		}
+		cfg := config.FromContext(ctx)
+		log := logging.FromContext(ctx)
+		deadline := health.Now().Add(time.Duration(cfg.RecoveryWaitTimeMinutes) * time.Minute)
+
+		for {
+			current, err := clientset.CoreV1().Nodes().Get(ctx, node.Name, metav1.GetOptions{})
+			if err == nil {
+				var pods []v1.Pod
+				if rule.UsesPods() {
+					pods, err = nodePods(ctx, clientset, node.Name)
+				}
+				if err == nil {
+					matched, err := rule.Matches(current, pods)
+					if err == nil && !matched {
+						log.Printf("Rule %s no longer matches node %s.", rule.Name, node.Name)
+						return true
+					}
+					if err != nil {
+						log.Printf("Error evaluating rule %s against node %s: %v", rule.Name, node.Name, err)
+					}
+				}
+			}
+			if err != nil && ctx.Err() == nil {
+				log.Printf("Error checking rule %s for node %s: %v", rule.Name, node.Name, err)
+			}
+
+			remaining := deadline.Sub(health.Now())
+			if remaining <= 0 || !health.Sleep(ctx, min(remaining, rulePollInterval)) {
+				log.Printf("Rule %s still matches node %s.", rule.Name, node.Name)
+				return false
+			}
+		}
+	}
+}
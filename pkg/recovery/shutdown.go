@@ -0,0 +1,70 @@
+package recovery
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/supporttools/k8s-node-killer/pkg/health"
+	"github.com/supporttools/k8s-node-killer/pkg/policy"
+)
+
+var (
+	draining atomic.Bool
+	active   atomic.Int64 // Remediations and operator-triggered steps running
+)
+
+// Draining reports whether the controller is shutting down and refuses new remediations.
+func Draining() bool {
+	return draining.Load()
+}
+
+// startWork registers a running remediation with Drain. It returns false, registering
+// nothing, once the controller is shutting down.
+func startWork() bool {
+	active.Add(1)
+	if draining.Load() {
+		active.Add(-1)
+		return false
+	}
+	return true
+}
+
+func finishWork() {
+	active.Add(-1)
+}
+
+// haltReason returns why running remediations must stop at their next safe point, or an
+// empty string when they may go on.
+func haltReason() string {
+	if Draining() {
+		return policy.ReasonShutdown
+	}
+	if engaged, _ := health.KillSwitch(); engaged {
+		return policy.ReasonKillSwitch
+	}
+	return ""
+}
+
+// Drain stops new remediations, interrupts the waits of running steps and waits until
+// every running remediation returned or ctx is done. Like the kill switch, it leaves
+// actions already sent to a node to complete. It returns the number of remediations still
+// running.
+func Drain(ctx context.Context) int {
+	draining.Store(true)
+	InterruptAll()
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		running := int(active.Load())
+		if running == 0 {
+			return 0
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return running
+		}
+	}
+}
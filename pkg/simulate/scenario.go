@@ -0,0 +1,152 @@
+// Package simulate replays a scripted timeline of node condition changes against the
+// recovery code the controller runs, on a simulated clock and a fake clientset, with scripted
+// recovery step providers in place of SSH, Harvester, Redfish, Rancher and Cluster API. Its
+// output, the sequence of decisions and actions, is deterministic, so policy and recovery
+// changes can be regression-tested by diffing it against a known good run.
+package simulate
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+
+	"github.com/supporttools/k8s-node-killer/pkg/config"
+)
+
+// defaultStart is when scenarios without a start time begin, a Monday.
+var defaultStart = time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// Step results a provider may script.
+const (
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+)
+
+// Scenario is a simulation read from a YAML file.
+type Scenario struct {
+	Name      string                `json:"name"`
+	Start     time.Time             `json:"start"`     // Defaults to 2024-01-01T00:00:00Z
+	Duration  Duration              `json:"duration"`  // How long to simulate
+	Config    json.RawMessage       `json:"config"`    // Same keys as the config file; the environment still applies
+	Nodes     []Node                `json:"nodes"`     // Nodes existing at the start, Ready unless stated otherwise
+	Timeline  []Event               `json:"timeline"`  // Applied in order of At
+	Providers map[string][]Response `json:"providers"` // Scripted responses of each recovery step
+}
+
+// Node is a node existing at the start of the scenario.
+type Node struct {
+	Name        string            `json:"name"`
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations"`
+	Age         Duration          `json:"age"`   // Age at the start; defaults to a day
+	Ready       *bool             `json:"ready"` // Defaults to true
+	Pods        []v1.Pod          `json:"pods"`  // Scheduled on the node, visible to rules
+	Probe       *Probe            `json:"probe"` // Answers to the direct probes; the host answers nothing when unset
+}
+
+// Probe scripts the answers of a node to the direct liveness probes.
+type Probe struct {
+	SSH     bool  `json:"ssh"`
+	Kubelet bool  `json:"kubelet"`
+	HTTP    *bool `json:"http"`
+}
+
+// Event changes the simulated world at a point of the timeline. Node events are followed by
+// an evaluation of the node, as the informer would trigger.
+type Event struct {
+	At          Duration                   `json:"at"`          // Offset from the start
+	Node        string                     `json:"node"`        // Node the condition, annotations and probe apply to
+	Condition   *v1.NodeCondition          `json:"condition"`   // Set on the node, replacing the condition of the same type
+	Annotations map[string]string          `json:"annotations"` // Merged into the node's; an empty value removes the annotation
+	Probe       *Probe                     `json:"probe"`       // Replaces the node's probe answers
+	KillSwitch  *bool                      `json:"killSwitch"`  // Engages or releases the kill switch
+	APIServer   string                     `json:"apiServer"`   // "down" makes the API server unreachable, "up" restores it
+	Budget      *config.Budgets            `json:"budget"`      // Replaces the remediation budgets
+	Windows     []config.MaintenanceWindow `json:"windows"`     // Replaces the maintenance windows when set
+}
+
+// Response scripts the outcome of a recovery step. Responses of a step are used in order,
+// the last one matching a node being reused once the others are used up. Steps without a
+// response fail and leave the node NotReady.
+type Response struct {
+	Node         string    `json:"node"`         // Only used for this node; any node when empty
+	Result       string    `json:"result"`       // What the step reports, success or failure; defaults to success
+	RecoverAfter *Duration `json:"recoverAfter"` // The node turns Ready this long after the step started; never when unset
+}
+
+// Duration is a time.Duration written as a Go duration string such as "30m".
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return fmt.Errorf("duration must be a string such as \"30m\", got %s", string(data))
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// LoadScenario parses and checks a YAML or JSON scenario. Unknown keys are errors.
+func LoadScenario(data []byte) (*Scenario, error) {
+	var s Scenario
+	if err := yaml.UnmarshalStrict(data, &s); err != nil {
+		return nil, fmt.Errorf("parse scenario: %w", err)
+	}
+	if s.Start.IsZero() {
+		s.Start = defaultStart
+	}
+	if s.Duration <= 0 {
+		return nil, fmt.Errorf("duration must be positive")
+	}
+
+	names := make(map[string]bool)
+	for i, node := range s.Nodes {
+		if node.Name == "" {
+			return nil, fmt.Errorf("nodes[%d]: name cannot be empty", i)
+		}
+		if names[node.Name] {
+			return nil, fmt.Errorf("nodes[%d]: duplicate name %q", i, node.Name)
+		}
+		names[node.Name] = true
+	}
+	for i, event := range s.Timeline {
+		if event.At < 0 || event.At > s.Duration {
+			return nil, fmt.Errorf("timeline[%d]: at must be within the duration of the scenario", i)
+		}
+		if (event.Condition != nil || event.Annotations != nil || event.Probe != nil) && !names[event.Node] {
+			return nil, fmt.Errorf("timeline[%d]: unknown node %q", i, event.Node)
+		}
+		if event.APIServer != "" && event.APIServer != "up" && event.APIServer != "down" {
+			return nil, fmt.Errorf("timeline[%d]: invalid apiServer %q; must be up or down", i, event.APIServer)
+		}
+	}
+	for step, responses := range s.Providers {
+		known := false
+		for _, name := range config.RecoverySteps {
+			known = known || name == step
+		}
+		if !known {
+			return nil, fmt.Errorf("providers: unknown recovery step %q", step)
+		}
+		for i, response := range responses {
+			if response.Result != "" && response.Result != ResultSuccess && response.Result != ResultFailure {
+				return nil, fmt.Errorf("providers.%s[%d]: invalid result %q; must be success or failure", step, i, response.Result)
+			}
+			if response.Node != "" && !names[response.Node] {
+				return nil, fmt.Errorf("providers.%s[%d]: unknown node %q", step, i, response.Node)
+			}
+		}
+	}
+	return &s, nil
+}
@@ -0,0 +1,625 @@
+package simulate
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	"github.com/supporttools/k8s-node-killer/pkg/config"
+	"github.com/supporttools/k8s-node-killer/pkg/health"
+	"github.com/supporttools/k8s-node-killer/pkg/policy"
+	"github.com/supporttools/k8s-node-killer/pkg/recovery"
+)
+
+// cluster is the name of the simulated cluster.
+const cluster = "simulation"
+
+// Kinds of output entries.
+const (
+	KindEvent    = "event"    // A timeline event was applied
+	KindDecision = "decision" // The decision on a node changed
+	KindStep     = "step"     // A recovery step started or finished
+	KindOutcome  = "outcome"  // A remediation ended
+)
+
+// Entry is a line of the simulation output.
+type Entry struct {
+	Offset  Duration `json:"offset"` // Time since the start of the scenario
+	Node    string   `json:"node,omitempty"`
+	Kind    string   `json:"kind"`
+	Action  string   `json:"action,omitempty"` // Decision action
+	Reason  string   `json:"reason,omitempty"` // Decision reason or step error
+	Step    string   `json:"step,omitempty"`
+	Result  string   `json:"result,omitempty"` // Step or remediation result
+	Message string   `json:"message,omitempty"`
+	Reasons []string `json:"reasons,omitempty"` // Explanation of the decision
+}
+
+// String formats the entry as a line of text.
+func (e Entry) String() string {
+	fields := []string{fmt.Sprintf("+%-9s", time.Duration(e.Offset)), e.Kind}
+	if e.Node != "" {
+		fields = append(fields, e.Node)
+	}
+	for _, f := range []struct{ key, value string }{
+		{"action", e.Action}, {"step", e.Step}, {"result", e.Result}, {"reason", e.Reason},
+	} {
+		if f.value != "" {
+			fields = append(fields, f.key+"="+f.value)
+		}
+	}
+	if e.Message != "" {
+		fields = append(fields, e.Message)
+	}
+	return strings.Join(fields, " ")
+}
+
+// event is something happening at a point of the simulated timeline.
+type event struct {
+	at        time.Time
+	priority  int // Orders events at the same time: timeline events before evaluations
+	seq       int
+	apply     func()
+	cancelled bool
+}
+
+// Event priorities.
+const (
+	priorityTimeline = iota
+	priorityNode     // A node comes back after a recovery step
+	priorityWake     // A remediation waiting on the clock wakes up
+	priorityEvaluation
+)
+
+type eventQueue []*event
+
+func (q eventQueue) Len() int { return len(q) }
+func (q eventQueue) Less(i, j int) bool {
+	if !q[i].at.Equal(q[j].at) {
+		return q[i].at.Before(q[j].at)
+	}
+	if q[i].priority != q[j].priority {
+		return q[i].priority < q[j].priority
+	}
+	return q[i].seq < q[j].seq
+}
+func (q eventQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *eventQueue) Push(x interface{}) { *q = append(*q, x.(*event)) }
+func (q *eventQueue) Pop() interface{} {
+	old := *q
+	e := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return e
+}
+
+// pollInterval is how often the scripted steps check whether their node is Ready, as the
+// real waits poll the API server.
+const pollInterval = 5 * time.Second
+
+// sleeper is a remediation waiting on the simulated clock.
+type sleeper struct {
+	ctx   context.Context
+	node  string // Node being remediated
+	wake  chan bool
+	alarm *event
+}
+
+// Simulator runs a scenario through the recovery code the controller runs, with scripted
+// providers and a simulated clock. Each remediation runs in its own goroutine, as the
+// controller's do, but only one goroutine runs at a time: a remediation has the simulator
+// until it waits on the clock or returns, so the output is deterministic. It is not safe for
+// concurrent use, and only one simulation may run at a time in a process.
+type Simulator struct {
+	scenario  *Scenario
+	cfg       *config.AppConfig
+	clientset *fake.Clientset
+	providers *recovery.Providers
+
+	now      time.Time
+	queue    eventQueue
+	seq      int
+	probes   map[string]*Probe
+	consumed map[string]map[int]bool
+	last     map[string]policy.Decision
+	reported map[string]bool // Attempts whose outcome is in the output, by ID
+	apiDown  bool
+	entries  []Entry
+	ended    bool
+
+	ctx      context.Context // Of the remediations
+	running  map[string]bool // Nodes being remediated, which the workers skip
+	current  string          // Node of the remediation that has the simulator
+	sleepers []*sleeper      // In the order they started waiting
+	yielded  chan bool       // A remediation waits, or returned when true
+}
+
+// New prepares a simulation of a scenario: its configuration is loaded and validated like
+// a config file, and its nodes and pods are created in a fake clientset.
+func New(scenario *Scenario) (*Simulator, error) {
+	cfg, err := config.Load(scenario.Config)
+	if err != nil {
+		return nil, err
+	}
+	// Only the policy is validated: the simulation never talks to a provider, so their
+	// settings do not matter.
+	if err := config.ValidatePolicy(&cfg.Policy); err != nil {
+		return nil, fmt.Errorf("policy: %w", err)
+	}
+	if cfg.RescanInterval <= 0 || cfg.RecoveryWaitTimeMinutes <= 0 {
+		return nil, fmt.Errorf("rescanInterval and recoveryWaitTimeMinutes must be positive")
+	}
+
+	s := &Simulator{
+		scenario:  scenario,
+		cfg:       &cfg,
+		clientset: fake.NewSimpleClientset(),
+		now:       scenario.Start,
+		probes:    make(map[string]*Probe),
+		consumed:  make(map[string]map[int]bool),
+		last:      make(map[string]policy.Decision),
+		reported:  make(map[string]bool),
+		running:   make(map[string]bool),
+		yielded:   make(chan bool),
+	}
+	s.providers = &recovery.Providers{Steps: make(map[string]recovery.Step), Probe: s.probe}
+	for _, step := range config.RecoverySteps {
+		replaces := step == config.StepDeleteViaRancher || step == config.StepRemediateViaCAPI
+		s.providers.Steps[step] = recovery.Step{Run: s.run(step), Verify: s.verify(replaces)}
+	}
+	s.clientset.PrependReactor("get", "version", s.serverVersion)
+	s.clientset.PrependReactor("list", "pods", s.listPods)
+
+	ctx := context.Background()
+	for _, n := range scenario.Nodes {
+		age := time.Duration(n.Age)
+		if age == 0 {
+			age = 24 * time.Hour
+		}
+		created := metav1.NewTime(scenario.Start.Add(-age))
+		ready := v1.NodeCondition{Type: v1.NodeReady, Status: v1.ConditionTrue, LastTransitionTime: created}
+		if n.Ready != nil && !*n.Ready {
+			ready.Status, ready.LastTransitionTime = v1.ConditionFalse, metav1.NewTime(scenario.Start)
+		}
+		node := &v1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: n.Name, Labels: n.Labels, Annotations: n.Annotations, CreationTimestamp: created},
+			Status:     v1.NodeStatus{Conditions: []v1.NodeCondition{ready}},
+		}
+		if _, err := s.clientset.CoreV1().Nodes().Create(ctx, node, metav1.CreateOptions{}); err != nil {
+			return nil, fmt.Errorf("create node %s: %w", n.Name, err)
+		}
+		for i := range n.Pods {
+			pod := n.Pods[i].DeepCopy()
+			pod.Spec.NodeName = n.Name
+			if pod.Namespace == "" {
+				pod.Namespace = metav1.NamespaceDefault
+			}
+			if _, err := s.clientset.CoreV1().Pods(pod.Namespace).Create(ctx, pod, metav1.CreateOptions{}); err != nil {
+				return nil, fmt.Errorf("create pod %s of node %s: %w", pod.Name, n.Name, err)
+			}
+		}
+		s.probes[n.Name] = n.Probe
+	}
+	return s, nil
+}
+
+// Run simulates the scenario and returns what happened, in order. The node states,
+// decisions, budgets and kill switch of the process are reset first, and the clock of the
+// process is the simulated one while it runs.
+func (s *Simulator) Run() []Entry {
+	health.ForgetCluster(cluster)
+	policy.ForgetCluster(cluster)
+	recovery.ForgetCluster(cluster)
+	health.SetKillSwitch("")
+	health.SetClock(simulatedClock{s})
+	defer health.SetKillSwitch("")
+	defer health.SetClock(nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s.ctx = health.WithCluster(recovery.WithProviders(ctx, s.providers), cluster)
+
+	start := s.scenario.Start
+	end := start.Add(time.Duration(s.scenario.Duration))
+	timeline := append([]Event(nil), s.scenario.Timeline...)
+	sort.SliceStable(timeline, func(i, j int) bool { return timeline[i].At < timeline[j].At })
+	for i := range timeline {
+		e := timeline[i]
+		s.schedule(start.Add(time.Duration(e.At)), priorityTimeline, func() { s.applyEvent(e) })
+	}
+	for t := start; !t.After(end); t = t.Add(s.cfg.RescanInterval) {
+		s.schedule(t, priorityEvaluation, s.rescan)
+	}
+
+	for s.queue.Len() > 0 {
+		e := heap.Pop(&s.queue).(*event)
+		if e.at.After(end) {
+			break
+		}
+		if e.cancelled {
+			continue
+		}
+		s.now = e.at
+		e.apply()
+		s.wakeInterrupted()
+	}
+
+	// The scenario is over: halt the remediations still running at their safe point, as the
+	// kill switch does, without recording it.
+	s.ended = true
+	health.SetKillSwitch("end of simulation")
+	recovery.InterruptAll()
+	s.wakeInterrupted()
+	return s.entries
+}
+
+// schedule runs apply at the given time of the simulated timeline.
+func (s *Simulator) schedule(at time.Time, priority int, apply func()) *event {
+	s.seq++
+	e := &event{at: at, priority: priority, seq: s.seq, apply: apply}
+	heap.Push(&s.queue, e)
+	return e
+}
+
+// record appends an entry to the output.
+func (s *Simulator) record(e Entry) {
+	if s.ended {
+		return
+	}
+	e.Offset = Duration(s.now.Sub(s.scenario.Start))
+	s.entries = append(s.entries, e)
+}
+
+// applyEvent applies a timeline event.
+func (s *Simulator) applyEvent(e Event) {
+	var changes []string
+	if e.KillSwitch != nil {
+		source := ""
+		if *e.KillSwitch {
+			source = "simulation"
+		}
+		health.SetKillSwitch(source)
+		changes = append(changes, fmt.Sprintf("kill switch engaged=%t", *e.KillSwitch))
+	}
+	if e.APIServer != "" {
+		s.apiDown = e.APIServer == "down"
+		changes = append(changes, "API server "+e.APIServer)
+	}
+	if e.Budget != nil || e.Windows != nil {
+		// Like a reload, a new configuration leaves the running remediations on the old one.
+		cfg := *s.cfg
+		if e.Budget != nil {
+			cfg.Policy.Budgets = *e.Budget
+			changes = append(changes, fmt.Sprintf("budgets maxConcurrent=%d maxPerHour=%d", e.Budget.MaxConcurrent, e.Budget.MaxPerHour))
+		}
+		if e.Windows != nil {
+			cfg.Policy.Windows = e.Windows
+			changes = append(changes, fmt.Sprintf("%d maintenance windows", len(e.Windows)))
+		}
+		s.cfg = &cfg
+	}
+	if e.Probe != nil {
+		s.probes[e.Node] = e.Probe
+		changes = append(changes, fmt.Sprintf("probe ssh=%t kubelet=%t", e.Probe.SSH, e.Probe.Kubelet))
+	}
+	if e.Condition != nil || e.Annotations != nil {
+		node := s.getNode(e.Node)
+		if e.Condition != nil {
+			setCondition(node, *e.Condition, s.now)
+			changes = append(changes, fmt.Sprintf("condition %s=%s", e.Condition.Type, e.Condition.Status))
+		}
+		for key, value := range e.Annotations {
+			if node.Annotations == nil {
+				node.Annotations = make(map[string]string)
+			}
+			if value == "" {
+				delete(node.Annotations, key)
+			} else {
+				node.Annotations[key] = value
+			}
+			changes = append(changes, fmt.Sprintf("annotation %s=%q", key, value))
+		}
+		s.updateNode(node)
+	}
+
+	s.record(Entry{Node: e.Node, Kind: KindEvent, Message: strings.Join(changes, ", ")})
+	if e.KillSwitch != nil && *e.KillSwitch {
+		recovery.InterruptAll()
+	}
+	if e.Node != "" {
+		s.schedule(s.now, priorityEvaluation, func() { s.evaluate(e.Node) })
+	}
+}
+
+// rescan evaluates every node, as the periodic rescan does.
+func (s *Simulator) rescan() {
+	for _, n := range s.scenario.Nodes {
+		s.evaluate(n.Name)
+	}
+}
+
+// evaluate evaluates a node as the controller's workers do: a node being remediated is
+// skipped, and a remediation runs in its own goroutine.
+func (s *Simulator) evaluate(name string) {
+	if s.running[name] {
+		return
+	}
+	ctx := config.WithSnapshot(s.ctx, s.cfg)
+	remediate := recovery.Evaluate(ctx, s.clientset, s.getNode(name))
+
+	if decision, ok := policy.GetDecision(cluster, name); ok {
+		last, seen := s.last[name]
+		if !seen || last.Action != decision.Action || last.Reason != decision.Reason || last.StartStep != decision.StartStep {
+			s.record(Entry{Node: name, Kind: KindDecision, Action: string(decision.Action), Reason: decision.Reason, Step: decision.StartStep, Reasons: decision.Reasons})
+		}
+		s.last[name] = decision
+	}
+	if remediate == nil {
+		return
+	}
+
+	s.running[name] = true
+	s.current = name
+	go func() {
+		remediate()
+		s.yielded <- true
+	}()
+	s.await(name)
+}
+
+// await lets the remediation of a node run until it waits on the clock or returns. Once it
+// returned, the node is queued for evaluation again, as the workers do.
+func (s *Simulator) await(name string) {
+	if returned := <-s.yielded; !returned {
+		return
+	}
+	s.observe()
+	delete(s.running, name)
+	state, _ := health.GetNodeState(cluster, name)
+	s.record(Entry{Node: name, Kind: KindOutcome, Result: string(state.Status), Reason: state.Reason})
+	s.schedule(s.now, priorityEvaluation, func() { s.evaluate(name) })
+}
+
+// wake ends the wait of a remediation, which then has the simulator until it waits again or
+// returns.
+func (s *Simulator) wake(sl *sleeper, elapsed bool) {
+	s.sleepers = slices.DeleteFunc(s.sleepers, func(other *sleeper) bool { return other == sl })
+	sl.alarm.cancelled = true
+	s.current = sl.node
+	sl.wake <- elapsed
+	s.await(sl.node)
+}
+
+// wakeInterrupted wakes the remediations whose wait was interrupted, one at a time in the
+// order they started waiting.
+func (s *Simulator) wakeInterrupted() {
+	for {
+		i := slices.IndexFunc(s.sleepers, func(sl *sleeper) bool { return sl.ctx.Err() != nil })
+		if i < 0 {
+			return
+		}
+		s.wake(s.sleepers[i], false)
+	}
+}
+
+// simulatedClock is the clock of the simulation. Waiting on it hands the simulator back.
+type simulatedClock struct {
+	s *Simulator
+}
+
+func (c simulatedClock) Now() time.Time {
+	return c.s.now
+}
+
+func (c simulatedClock) Sleep(ctx context.Context, d time.Duration) bool {
+	s := c.s
+	if ctx.Err() != nil {
+		return false
+	}
+	sl := &sleeper{ctx: ctx, node: s.current, wake: make(chan bool)}
+	sl.alarm = s.schedule(s.now.Add(d), priorityWake, func() { s.wake(sl, true) })
+	s.sleepers = append(s.sleepers, sl)
+	s.yielded <- false
+	return <-sl.wake
+}
+
+// observe records the outcome of the attempts that ended since it was last called.
+func (s *Simulator) observe() {
+	for _, n := range s.scenario.Nodes {
+		state, _ := health.GetNodeState(cluster, n.Name)
+		for _, attempt := range state.Attempts {
+			if attempt.Result == health.ResultInProgress || s.reported[attempt.ID] {
+				continue
+			}
+			s.reported[attempt.ID] = true
+			s.record(Entry{Node: n.Name, Kind: KindStep, Step: attempt.Step, Result: attempt.Result, Reason: attempt.Error})
+		}
+	}
+}
+
+// run returns the scripted action of a recovery step: the provider reports the scripted
+// result, and the node turns Ready at the scripted time.
+func (s *Simulator) run(step string) func(context.Context, kubernetes.Interface, string) bool {
+	return func(_ context.Context, _ kubernetes.Interface, name string) bool {
+		s.observe() // The previous step ended before this one started
+		response := s.response(step, name)
+		s.record(Entry{Node: name, Kind: KindStep, Step: step, Result: "started", Message: "provider reports " + response.Result})
+		if response.RecoverAfter != nil {
+			s.schedule(s.now.Add(time.Duration(*response.RecoverAfter)), priorityNode, func() { s.recover(name, step) })
+		}
+		return response.Result == ResultSuccess
+	}
+}
+
+// recover turns a node Ready after a recovery step. A rebooted or replaced node starts
+// afresh, without the problems it reported.
+func (s *Simulator) recover(name, step string) {
+	node := s.getNode(name)
+	if step != config.StepRestartKubelet {
+		for _, condition := range node.Status.Conditions {
+			if condition.Type != v1.NodeReady && condition.Status == v1.ConditionTrue {
+				setCondition(node, v1.NodeCondition{Type: condition.Type, Status: v1.ConditionFalse}, s.now)
+			}
+		}
+	}
+	setCondition(node, v1.NodeCondition{Type: v1.NodeReady, Status: v1.ConditionTrue, Reason: "KubeletReady"}, s.now)
+	s.updateNode(node)
+}
+
+// verify returns the wait of a recovery step, which polls the node until it is Ready, like
+// the real waits, for the recovery wait time or, for steps replacing the node, the
+// replacement timeout.
+func (s *Simulator) verify(replaces bool) func(context.Context, kubernetes.Interface, *v1.Node) bool {
+	return func(ctx context.Context, clientset kubernetes.Interface, node *v1.Node) bool {
+		cfg := config.FromContext(ctx)
+		wait := time.Duration(cfg.RecoveryWaitTimeMinutes) * time.Minute
+		if replaces {
+			wait = cfg.ReplacementTimeout
+		}
+		deadline := health.Now().Add(wait)
+		for {
+			if current, err := clientset.CoreV1().Nodes().Get(ctx, node.Name, metav1.GetOptions{}); err == nil && isReady(current) {
+				return true
+			}
+			remaining := deadline.Sub(health.Now())
+			if remaining <= 0 || !health.Sleep(ctx, min(remaining, pollInterval)) {
+				return false
+			}
+		}
+	}
+}
+
+// response returns the scripted response of a step for a node.
+func (s *Simulator) response(step, name string) Response {
+	responses := s.scenario.Providers[step]
+	if s.consumed[step] == nil {
+		s.consumed[step] = make(map[int]bool)
+	}
+	lastMatch := -1
+	for i, response := range responses {
+		if response.Node != "" && response.Node != name {
+			continue
+		}
+		lastMatch = i
+		if !s.consumed[step][i] {
+			s.consumed[step][i] = true
+			return withDefaults(response)
+		}
+	}
+	if lastMatch >= 0 {
+		return withDefaults(responses[lastMatch])
+	}
+	return Response{Result: ResultFailure}
+}
+
+func withDefaults(r Response) Response {
+	if r.Result == "" {
+		r.Result = ResultSuccess
+	}
+	return r
+}
+
+// probe returns the scripted answers of a node to the direct probes.
+func (s *Simulator) probe(_ context.Context, node *v1.Node, pc config.ProbeConfig) health.ProbeResult {
+	result := health.ProbeResult{ProbedAt: s.now, Address: node.Name}
+	script := s.probes[node.Name]
+	if script == nil {
+		script = &Probe{}
+	}
+	result.SSH, result.Kubelet = script.SSH, script.Kubelet
+	if pc.HTTPURL != "" {
+		ok := script.HTTP != nil && *script.HTTP
+		result.HTTP = &ok
+	}
+	if !result.SSH {
+		result.Errors = append(result.Errors, "ssh: no answer")
+	}
+	if !result.Kubelet {
+		result.Errors = append(result.Errors, "kubelet: no answer")
+	}
+	return result
+}
+
+// serverVersion answers the API server check of the partition detection, failing while the
+// scenario has the API server down.
+func (s *Simulator) serverVersion(k8stesting.Action) (bool, runtime.Object, error) {
+	if s.apiDown {
+		return true, nil, errors.New("connection refused")
+	}
+	return false, nil, nil
+}
+
+// listPods lists pods honouring the spec.nodeName field selector, which the fake clientset
+// ignores, sorted by namespace and name.
+func (s *Simulator) listPods(action k8stesting.Action) (bool, runtime.Object, error) {
+	obj, err := s.clientset.Tracker().List(v1.SchemeGroupVersion.WithResource("pods"), v1.SchemeGroupVersion.WithKind("Pod"), action.GetNamespace())
+	if err != nil {
+		return true, nil, err
+	}
+	list := obj.(*v1.PodList)
+	selector := action.(k8stesting.ListAction).GetListRestrictions().Fields
+	list.Items = slices.DeleteFunc(list.Items, func(pod v1.Pod) bool {
+		return !selector.Matches(fields.Set{"spec.nodeName": pod.Spec.NodeName})
+	})
+	sort.Slice(list.Items, func(i, j int) bool {
+		return list.Items[i].Namespace+"/"+list.Items[i].Name < list.Items[j].Namespace+"/"+list.Items[j].Name
+	})
+	return true, list, nil
+}
+
+func (s *Simulator) getNode(name string) *v1.Node {
+	node, err := s.clientset.CoreV1().Nodes().Get(context.Background(), name, metav1.GetOptions{})
+	if err != nil {
+		// Nodes are never deleted from the fake clientset.
+		panic(fmt.Sprintf("simulated node %s vanished: %v", name, err))
+	}
+	return node
+}
+
+func (s *Simulator) updateNode(node *v1.Node) {
+	if _, err := s.clientset.CoreV1().Nodes().Update(context.Background(), node, metav1.UpdateOptions{}); err != nil {
+		panic(fmt.Sprintf("update simulated node %s: %v", node.Name, err))
+	}
+}
+
+// setCondition sets a condition on a node, replacing the one of the same type. The
+// transition time only moves when the status changes, as the kubelet does.
+func setCondition(node *v1.Node, condition v1.NodeCondition, now time.Time) {
+	condition.LastHeartbeatTime = metav1.NewTime(now)
+	for i := range node.Status.Conditions {
+		existing := &node.Status.Conditions[i]
+		if existing.Type != condition.Type {
+			continue
+		}
+		condition.LastTransitionTime = existing.LastTransitionTime
+		if existing.Status != condition.Status {
+			condition.LastTransitionTime = metav1.NewTime(now)
+		}
+		*existing = condition
+		return
+	}
+	condition.LastTransitionTime = metav1.NewTime(now)
+	node.Status.Conditions = append(node.Status.Conditions, condition)
+}
+
+// isReady reports whether the node's Ready condition is True.
+func isReady(node *v1.Node) bool {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == v1.NodeReady {
+			return condition.Status == v1.ConditionTrue
+		}
+	}
+	return false
+}
@@ -0,0 +1,90 @@
+package simulate
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/supporttools/k8s-node-killer/pkg/recovery"
+)
+
+// TestScenarios runs every scenario in the scenarios directory and compares its output to
+// the golden file next to it.
+func TestScenarios(t *testing.T) {
+	files, err := filepath.Glob("../../scenarios/*.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no scenarios found")
+	}
+	for _, file := range files {
+		t.Run(strings.TrimSuffix(filepath.Base(file), ".yaml"), func(t *testing.T) {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			golden := strings.TrimSuffix(file, ".yaml") + ".txt"
+			expected, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			scenario, err := LoadScenario(data)
+			if err != nil {
+				t.Fatalf("LoadScenario: %v", err)
+			}
+			simulator, err := New(scenario)
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+			var got []string
+			for _, entry := range simulator.Run() {
+				got = append(got, entry.String())
+			}
+
+			want := strings.Split(strings.TrimSuffix(string(expected), "\n"), "\n")
+			for i := 0; i < len(want) || i < len(got); i++ {
+				var w, g string
+				if i < len(want) {
+					w = want[i]
+				}
+				if i < len(got) {
+					g = got[i]
+				}
+				if w != g {
+					t.Fatalf("output differs from %s at line %d, regenerate it with go run ./cmd/simulate if the change is intended\n  want: %s\n  got:  %s", golden, i+1, w, g)
+				}
+			}
+		})
+	}
+}
+
+// TestRunStopsRemediations checks that a scenario ending while a step waits for its node
+// leaves no remediation running, nor its budget taken, for the next simulation.
+func TestRunStopsRemediations(t *testing.T) {
+	scenario, err := LoadScenario([]byte(`
+duration: 10m
+config:
+  rescanInterval: 5m
+  recoveryWaitTimeMinutes: 10
+nodes:
+  - name: worker-1
+    ready: false
+`))
+	if err != nil {
+		t.Fatalf("LoadScenario: %v", err)
+	}
+	simulator, err := New(scenario)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	entries := simulator.Run()
+
+	if last := entries[len(entries)-1]; last.Kind != KindStep || last.Result != "started" {
+		t.Errorf("last entry = %q, want the first step still waiting", last)
+	}
+	if running := recovery.InFlight(cluster); running != 0 {
+		t.Errorf("%d remediations running after the scenario, want 0", running)
+	}
+}